@@ -8,11 +8,18 @@ import (
 	"syscall"
 	"time"
 
+	"fintrack/internal/budget"
+	"fintrack/internal/category"
 	"fintrack/internal/common"
 	"fintrack/internal/expense"
+	"fintrack/internal/report"
+	"fintrack/internal/user"
+	"fintrack/internal/workspace"
+	"fintrack/pkg/auth"
 	"fintrack/pkg/config"
 	"fintrack/pkg/database"
 	"fintrack/pkg/middleware"
+	"fintrack/pkg/storage"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -29,13 +36,58 @@ func main() {
 		logger.Fatal("Failed to connect to database", zap.Error(err))
 	}
 
-	if err := db.AutoMigrate(&common.User{}, &common.Expense{}); err != nil {
+	redis, err := database.NewRedisClient(cfg.RedisURL)
+	if err != nil {
+		logger.Fatal("Failed to connect to Redis", zap.Error(err))
+	}
+
+	if err := db.AutoMigrate(&common.User{}, &common.Expense{}, &common.RecurringExpense{}, &common.Budget{}, &common.ExchangeRate{}, &common.ImportMapping{}, &common.ImportBatch{}, &common.Report{}, &common.ExpenseVersion{}, &common.APIKey{}, &common.Workspace{}, &common.WorkspaceMember{}, &common.ExpenseSplit{}, &common.Settlement{}, &common.Category{}, &common.Tag{}, &common.Attachment{}, &common.CategoryRule{}); err != nil {
 		logger.Fatal("Failed to migrate database", zap.Error(err))
 	}
 
+	if err := common.MigrateExpenseAmounts(db); err != nil {
+		logger.Fatal("Failed to migrate expense amounts", zap.Error(err))
+	}
+
+	if err := workspace.Migrate(db); err != nil {
+		logger.Fatal("Failed to migrate workspaces", zap.Error(err))
+	}
+
+	if err := category.Migrate(db); err != nil {
+		logger.Fatal("Failed to migrate categories", zap.Error(err))
+	}
+
+	if err := expense.MigrateSearch(db); err != nil {
+		logger.Fatal("Failed to migrate expense search", zap.Error(err))
+	}
+
+	budgetService := budget.NewService(db, redis, logger)
+	budgetHandler := budget.NewHandler(budgetService, logger)
+
 	expenseService := expense.NewService(db)
+	expenseService.AddListener(budgetService)
+	expenseService.AddListener(report.NewInvalidator(db, logger))
 	expenseHandler := expense.NewHandler(expenseService, logger)
 
+	// Attachment storage; without an S3 bucket blobs are kept under BLOB_DIR
+	var blobs storage.BlobStore = storage.NewFileStore(cfg.BlobDir)
+	if cfg.S3Bucket != "" {
+		blobs = storage.NewS3Store(storage.S3Config{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+		})
+	}
+	attachmentService := expense.NewAttachmentService(db, blobs, int64(cfg.AttachmentMaxSize), logger)
+	expenseService.AddListener(attachmentService)
+
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	defer stopScheduler()
+	go expense.NewScheduler(expenseService, logger, cfg.RecurringInterval).Run(schedulerCtx)
+	go expense.NewAttachmentSweeper(attachmentService, logger, cfg.AttachmentSweep).Run(schedulerCtx)
+
 	router := gin.New()
 	router.Use(middleware.LoggingMiddleware(logger))
 	router.Use(middleware.CORSMiddleware())
@@ -47,10 +99,27 @@ func main() {
 
 	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
+	keys, err := auth.LoadKeySet(cfg.JWKSURL, cfg.JWKSFile, cfg.JWKSCacheTTL)
+	if err != nil {
+		logger.Fatal("Failed to load JWKS", zap.Error(err))
+	}
+	authMiddleware := middleware.AuthMiddleware(keys, auth.NewRevocationList(redis), user.NewAPIKeyStore(db))
 	api := router.Group("/api/v1")
 	protected := api.Group("/expenses")
-	protected.Use(middleware.AuthMiddleware(cfg.JWTSecret))
+	protected.Use(authMiddleware, middleware.RequireScopes(auth.ScopeExpensesRead, auth.ScopeExpensesWrite))
+	protected.Use(middleware.WorkspaceMiddleware(workspace.NewResolver(db)), middleware.RequireWorkspaceWrite())
 	expenseHandler.SetupRoutes(protected)
+	expense.NewAttachmentHandler(attachmentService, logger).SetupRoutes(protected)
+
+	categories := api.Group("/categories")
+	categories.Use(authMiddleware, middleware.RequireScopes(auth.ScopeExpensesRead, auth.ScopeExpensesWrite))
+	categories.Use(middleware.WorkspaceMiddleware(workspace.NewResolver(db)), middleware.RequireWorkspaceWrite())
+	category.NewHandler(category.NewService(db), logger).SetupRoutes(categories)
+
+	budgets := api.Group("/budgets")
+	budgets.Use(authMiddleware, middleware.RequireScopes(auth.ScopeBudgetsRead, auth.ScopeBudgetsWrite))
+	budgets.Use(middleware.WorkspaceMiddleware(workspace.NewResolver(db)), middleware.RequireWorkspaceWrite())
+	budgetHandler.SetupRoutes(budgets)
 
 	srv := &http.Server{
 		Addr:    ":" + cfg.Port,
@@ -69,6 +138,7 @@ func main() {
 	<-quit
 
 	logger.Info("Shutting down server...")
+	stopScheduler()
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
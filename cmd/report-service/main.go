@@ -10,6 +10,9 @@ import (
 
 	"fintrack/internal/common"
 	"fintrack/internal/report"
+	"fintrack/internal/user"
+	"fintrack/internal/workspace"
+	"fintrack/pkg/auth"
 	"fintrack/pkg/config"
 	"fintrack/pkg/database"
 	"fintrack/pkg/middleware"
@@ -34,13 +37,37 @@ func main() {
 		logger.Fatal("Failed to connect to Redis", zap.Error(err))
 	}
 
-	if err := db.AutoMigrate(&common.User{}, &common.Expense{}, &common.Report{}); err != nil {
+	if err := db.AutoMigrate(&common.User{}, &common.Expense{}, &common.Report{}, &common.ExchangeRate{}, &common.ExpenseVersion{}, &common.ReportJob{}, &common.APIKey{}, &common.Workspace{}, &common.WorkspaceMember{}, &common.Category{}, &common.Tag{}); err != nil {
 		logger.Fatal("Failed to migrate database", zap.Error(err))
 	}
 
+	if err := workspace.Migrate(db); err != nil {
+		logger.Fatal("Failed to migrate workspaces", zap.Error(err))
+	}
+
 	reportService := report.NewService(db, redis, logger)
+
+	if cfg.ExchangeRatesFile != "" {
+		count, err := reportService.LoadExchangeRatesFile(cfg.ExchangeRatesFile)
+		if err != nil {
+			logger.Fatal("Failed to load exchange rates", zap.Error(err))
+		}
+		logger.Info("Loaded exchange rates", zap.Int("count", count), zap.String("file", cfg.ExchangeRatesFile))
+	}
 	reportHandler := report.NewHandler(reportService, logger)
 
+	keys, err := auth.LoadKeySet(cfg.JWKSURL, cfg.JWKSFile, cfg.JWKSCacheTTL)
+	if err != nil {
+		logger.Fatal("Failed to load JWKS", zap.Error(err))
+	}
+
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	workersDone := make(chan struct{})
+	go func() {
+		report.NewWorkerPool(reportService, logger, cfg.ReportWorkers, cfg.ReportJobPoll, cfg.ReportJobAttempts).Run(workersCtx)
+		close(workersDone)
+	}()
+
 	router := gin.New()
 	router.Use(middleware.LoggingMiddleware(logger))
 	router.Use(middleware.CORSMiddleware())
@@ -54,7 +81,10 @@ func main() {
 
 	api := router.Group("/api/v1")
 	protected := api.Group("/reports")
-	protected.Use(middleware.AuthMiddleware(cfg.JWTSecret))
+	protected.Use(middleware.AuthMiddleware(keys, auth.NewRevocationList(redis), user.NewAPIKeyStore(db)))
+	protected.Use(middleware.RequireScopes(auth.ScopeReportsRead, auth.ScopeReportsWrite))
+	// Reports are derived data, so viewers may have them generated too
+	protected.Use(middleware.WorkspaceMiddleware(workspace.NewResolver(db)))
 	reportHandler.SetupRoutes(protected)
 
 	srv := &http.Server{
@@ -81,5 +111,12 @@ func main() {
 		logger.Fatal("Server forced to shutdown", zap.Error(err))
 	}
 
+	// Let running jobs finish; an interrupted one is retried after its lease.
+	stopWorkers()
+	select {
+	case <-workersDone:
+	case <-ctx.Done():
+	}
+
 	logger.Info("Server exited")
 }
\ No newline at end of file
@@ -10,8 +10,11 @@ import (
 
 	"fintrack/internal/common"
 	"fintrack/internal/user"
+	"fintrack/internal/workspace"
+	"fintrack/pkg/auth"
 	"fintrack/pkg/config"
 	"fintrack/pkg/database"
+	"fintrack/pkg/mail"
 	"fintrack/pkg/middleware"
 
 	"github.com/gin-gonic/gin"
@@ -33,17 +36,57 @@ func main() {
 		logger.Fatal("Failed to connect to database", zap.Error(err))
 	}
 
+	// Connect to Redis
+	redis, err := database.NewRedisClient(cfg.RedisURL)
+	if err != nil {
+		logger.Fatal("Failed to connect to Redis", zap.Error(err))
+	}
+	revocations := auth.NewRevocationList(redis)
+
 	// Auto-migrate models
-	if err := db.AutoMigrate(&common.User{}); err != nil {
+	if err := db.AutoMigrate(&common.User{}, &common.RefreshToken{}, &common.SigningKey{}, &common.UserToken{}, &common.TOTPCredential{}, &common.RecoveryCode{}, &common.AuditEvent{}, &common.APIKey{}, &common.Workspace{}, &common.WorkspaceMember{}, &common.WorkspaceInvitation{}); err != nil {
 		logger.Fatal("Failed to migrate database", zap.Error(err))
 	}
 
+	if err := workspace.Migrate(db); err != nil {
+		logger.Fatal("Failed to migrate workspaces", zap.Error(err))
+	}
+
+	// Bootstrap administrators; each must have registered already
+	missing, err := user.GrantAdmin(db, cfg.AdminEmails)
+	if err != nil {
+		logger.Fatal("Failed to grant admin roles", zap.Error(err))
+	}
+	for _, email := range missing {
+		logger.Warn("Admin email has no account yet", zap.String("email", email))
+	}
+
+	// Signing keys
+	keys, err := user.NewKeyManager(db, cfg.SigningAlgorithm, cfg.KeyRotation, cfg.KeyOverlap)
+	if err != nil {
+		logger.Fatal("Failed to configure signing keys", zap.Error(err))
+	}
+	rotatorCtx, stopRotator := context.WithCancel(context.Background())
+	defer stopRotator()
+	go user.NewKeyRotator(keys, logger, time.Minute).Run(rotatorCtx)
+
+	// Mail delivery; without an SMTP relay messages are written to MAIL_DIR or logged
+	var mailer mail.Mailer = mail.NewFileMailer(cfg.MailDir, cfg.MailFrom, logger)
+	if cfg.SMTPAddr != "" {
+		mailer = mail.NewSMTPMailer(cfg.SMTPAddr, cfg.MailFrom, cfg.SMTPUsername, cfg.SMTPPassword)
+	}
+
 	// Initialize services
-	userService := user.NewService(db, cfg.JWTSecret)
+	userService := user.NewService(db, keys, revocations, auth.NewAttemptCounter(redis, user.LoginFailureWindow), mailer, cfg.AppURL)
 	userHandler := user.NewHandler(userService, logger)
+	workspaceHandler := workspace.NewHandler(workspace.NewService(db, mailer, cfg.AppURL), logger)
 
 	// Setup router
 	router := gin.New()
+	// Client IPs feed login throttling, so only trust forwarding headers from known proxies
+	if err := router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		logger.Fatal("Invalid trusted proxies", zap.Error(err))
+	}
 	router.Use(middleware.LoggingMiddleware(logger))
 	router.Use(middleware.CORSMiddleware())
 	router.Use(gin.Recovery())
@@ -56,9 +99,27 @@ func main() {
 	// Metrics endpoint
 	router.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
+	// Public keys for verifying access tokens
+	router.GET("/.well-known/jwks.json", userHandler.GetJWKS)
+
 	// API routes
 	api := router.Group("/api/v1")
-	userHandler.SetupRoutes(api.Group("/users"))
+	users := api.Group("/users")
+	userHandler.SetupRoutes(users)
+
+	// Account management needs a login session; API keys are not accepted
+	protected := users.Group("")
+	protected.Use(middleware.AuthMiddleware(keys, revocations, nil))
+	userHandler.SetupProtectedRoutes(protected)
+
+	workspaces := api.Group("/workspaces")
+	workspaces.Use(middleware.AuthMiddleware(keys, revocations, nil))
+	workspaceHandler.SetupRoutes(workspaces)
+
+	// Administration needs a login session whose roles grant each route's permission
+	admin := api.Group("/admin")
+	admin.Use(middleware.AuthMiddleware(keys, revocations, nil))
+	userHandler.SetupAdminRoutes(admin)
 
 	// Start server
 	srv := &http.Server{
@@ -79,6 +140,7 @@ func main() {
 	<-quit
 
 	logger.Info("Shutting down server...")
+	stopRotator()
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
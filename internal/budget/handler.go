@@ -0,0 +1,192 @@
+package budget
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+	"fintrack/internal/common"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type Handler struct {
+	service *Service
+	logger  *zap.Logger
+}
+
+func NewHandler(service *Service, logger *zap.Logger) *Handler {
+	return &Handler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+func (h *Handler) CreateBudget(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	userID := c.GetUint("user_id")
+
+	var req common.BudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	budget, err := h.service.CreateBudget(workspaceID, userID, req)
+	if err != nil {
+		h.logger.Error("Failed to create budget", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, budget)
+}
+
+func (h *Handler) GetBudgets(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+
+	budgets, err := h.service.GetBudgets(workspaceID)
+	if err != nil {
+		h.logger.Error("Failed to get budgets", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"budgets": budgets})
+}
+
+func (h *Handler) GetBudget(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	budgetID, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	budget, err := h.service.GetBudget(workspaceID, budgetID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Budget not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to get budget", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, budget)
+}
+
+func (h *Handler) UpdateBudget(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	budgetID, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	var req common.BudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	budget, err := h.service.UpdateBudget(workspaceID, budgetID, req)
+	if err != nil {
+		h.logger.Error("Failed to update budget", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, budget)
+}
+
+func (h *Handler) DeleteBudget(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	budgetID, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteBudget(workspaceID, budgetID); err != nil {
+		h.logger.Error("Failed to delete budget", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Budget deleted successfully"})
+}
+
+func (h *Handler) GetStatuses(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	date, ok := parseDate(c)
+	if !ok {
+		return
+	}
+
+	statuses, err := h.service.GetStatuses(workspaceID, date)
+	if err != nil {
+		h.logger.Error("Failed to get budget status", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"budgets": statuses})
+}
+
+func (h *Handler) GetStatus(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	budgetID, ok := parseID(c)
+	if !ok {
+		return
+	}
+	date, ok := parseDate(c)
+	if !ok {
+		return
+	}
+
+	status, err := h.service.GetStatus(workspaceID, budgetID, date)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Budget not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to get budget status", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
+
+func parseID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid budget ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// parseDate reads the optional ?date=YYYY-MM-DD, defaulting to today.
+func parseDate(c *gin.Context) (time.Time, bool) {
+	value := c.Query("date")
+	if value == "" {
+		return time.Now().UTC(), true
+	}
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date"})
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+func (h *Handler) SetupRoutes(router *gin.RouterGroup) {
+	router.POST("", h.CreateBudget)
+	router.GET("", h.GetBudgets)
+	router.GET("/status", h.GetStatuses)
+	router.GET("/:id", h.GetBudget)
+	router.PUT("/:id", h.UpdateBudget)
+	router.DELETE("/:id", h.DeleteBudget)
+	router.GET("/:id/status", h.GetStatus)
+}
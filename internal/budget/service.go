@@ -0,0 +1,407 @@
+package budget
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"fintrack/internal/common"
+	"fintrack/pkg/notify"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	EventThresholdReached = "budget_threshold_reached"
+	EventExceeded         = "budget_exceeded"
+
+	// thresholdPercent is the share of the limit that triggers the first alert.
+	thresholdPercent = 80
+)
+
+var (
+	ErrNonPositiveLimit = errors.New("limit must be greater than zero")
+	ErrInvalidCurrency  = errors.New("currency must be a three-letter ISO 4217 code")
+)
+
+type Service struct {
+	db     *gorm.DB
+	redis  *redis.Client
+	logger *zap.Logger
+}
+
+// Status is a budget's position within the period containing a given date.
+// Limit already includes Rollover.
+type Status struct {
+	Budget      common.Budget `json:"budget"`
+	PeriodStart time.Time     `json:"period_start"`
+	PeriodEnd   time.Time     `json:"period_end"`
+	Limit       common.Money  `json:"limit"`
+	Rollover    common.Money  `json:"rollover"`
+	Spent       common.Money  `json:"spent"`
+	Remaining   common.Money  `json:"remaining"`
+	Percent     float64       `json:"percent"`
+	Unconverted int           `json:"unconverted,omitempty"`
+}
+
+type alert struct {
+	BudgetID    uint         `json:"budget_id"`
+	Category    string       `json:"category"`
+	Period      string       `json:"period"`
+	PeriodStart string       `json:"period_start"`
+	Spent       common.Money `json:"spent"`
+	Limit       common.Money `json:"limit"`
+	Currency    string       `json:"currency"`
+	Percent     float64      `json:"percent"`
+}
+
+func NewService(db *gorm.DB, redis *redis.Client, logger *zap.Logger) *Service {
+	return &Service{
+		db:     db,
+		redis:  redis,
+		logger: logger,
+	}
+}
+
+// CreateBudget adds a budget to the workspace; userID is the member creating it.
+func (s *Service) CreateBudget(workspaceID, userID uint, req common.BudgetRequest) (*common.Budget, error) {
+	budget := common.Budget{WorkspaceID: workspaceID, UserID: userID}
+	if err := s.applyRequest(&budget, req, common.WorkspaceBaseCurrency(s.db, workspaceID)); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(&budget).Error; err != nil {
+		return nil, err
+	}
+
+	return &budget, nil
+}
+
+func (s *Service) GetBudgets(workspaceID uint) ([]common.Budget, error) {
+	var budgets []common.Budget
+	err := s.db.Where("workspace_id = ?", workspaceID).Order("created_at").Find(&budgets).Error
+	return budgets, err
+}
+
+func (s *Service) GetBudget(workspaceID, budgetID uint) (*common.Budget, error) {
+	var budget common.Budget
+	if err := s.db.Where("id = ? AND workspace_id = ?", budgetID, workspaceID).First(&budget).Error; err != nil {
+		return nil, err
+	}
+	return &budget, nil
+}
+
+func (s *Service) UpdateBudget(workspaceID, budgetID uint, req common.BudgetRequest) (*common.Budget, error) {
+	budget, err := s.GetBudget(workspaceID, budgetID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.applyRequest(budget, req, budget.Limit.Currency); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Save(budget).Error; err != nil {
+		return nil, err
+	}
+
+	return budget, nil
+}
+
+func (s *Service) DeleteBudget(workspaceID, budgetID uint) error {
+	return s.db.Where("id = ? AND workspace_id = ?", budgetID, workspaceID).Delete(&common.Budget{}).Error
+}
+
+func (s *Service) applyRequest(budget *common.Budget, req common.BudgetRequest, fallbackCurrency string) error {
+	currency := strings.ToUpper(strings.TrimSpace(req.Currency))
+	if currency == "" {
+		currency = fallbackCurrency
+	}
+	if !common.IsCurrencyCode(currency) {
+		return ErrInvalidCurrency
+	}
+
+	limit, err := req.Limit.In(currency)
+	if err != nil {
+		return err
+	}
+	if !limit.IsPositive() {
+		return ErrNonPositiveLimit
+	}
+
+	category := strings.Join(strings.Fields(req.Category), " ")
+	if strings.EqualFold(category, common.BudgetAllCategories) {
+		category = common.BudgetAllCategories
+	}
+
+	budget.Category = category
+	budget.Period = req.Period
+	budget.Limit = limit
+	budget.Rollover = req.Rollover
+	return nil
+}
+
+// GetStatuses returns the status of every budget for the period containing date.
+func (s *Service) GetStatuses(workspaceID uint, date time.Time) ([]Status, error) {
+	budgets, err := s.GetBudgets(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	converter := common.NewConverter(s.db)
+	statuses := make([]Status, 0, len(budgets))
+	for _, budget := range budgets {
+		status, err := s.status(budget, date, converter)
+		if err != nil {
+			return nil, err
+		}
+		statuses = append(statuses, *status)
+	}
+	return statuses, nil
+}
+
+func (s *Service) GetStatus(workspaceID, budgetID uint, date time.Time) (*Status, error) {
+	budget, err := s.GetBudget(workspaceID, budgetID)
+	if err != nil {
+		return nil, err
+	}
+	return s.status(*budget, date, common.NewConverter(s.db))
+}
+
+func (s *Service) status(budget common.Budget, date time.Time, converter *common.Converter) (*Status, error) {
+	start, end := PeriodBounds(budget.Period, date)
+
+	spent, unconverted, err := s.spent(budget, start, end, converter)
+	if err != nil {
+		return nil, err
+	}
+
+	rollover := common.Zero(budget.Limit.Currency)
+	if budget.Rollover && budget.CreatedAt.Before(start) {
+		prevStart, prevEnd := PeriodBounds(budget.Period, start.AddDate(0, 0, -1))
+		prevSpent, _, err := s.spent(budget, prevStart, prevEnd, converter)
+		if err != nil {
+			return nil, err
+		}
+		if rollover, err = budget.Limit.Sub(prevSpent); err != nil {
+			return nil, err
+		}
+	}
+
+	limit, err := budget.Limit.Add(rollover)
+	if err != nil {
+		return nil, err
+	}
+	remaining, err := limit.Sub(spent)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Status{
+		Budget:      budget,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Limit:       limit,
+		Rollover:    rollover,
+		Spent:       spent,
+		Remaining:   remaining,
+		Percent:     percent(spent, limit),
+		Unconverted: unconverted,
+	}, nil
+}
+
+// spent sums the budget's matching expenses in [start, end) in the budget's
+// currency, whichever member recorded them. Expenses without an exchange
+// rate are counted, not summed.
+func (s *Service) spent(budget common.Budget, start, end time.Time, converter *common.Converter) (common.Money, int, error) {
+	query := s.db.Where("workspace_id = ? AND date >= ? AND date < ?", budget.WorkspaceID, start, end)
+	if budget.Category != common.BudgetAllCategories {
+		query = query.Where("LOWER(category) = ?", strings.ToLower(budget.Category))
+	}
+
+	var expenses []common.Expense
+	if err := query.Select("amount_minor", "amount_currency", "date").Find(&expenses).Error; err != nil {
+		return common.Money{}, 0, err
+	}
+
+	total := common.Zero(budget.Limit.Currency)
+	unconverted := 0
+	for _, expense := range expenses {
+		amount, err := converter.Convert(expense.Amount, budget.Limit.Currency, expense.Date)
+		if errors.Is(err, common.ErrRateNotFound) {
+			unconverted++
+			continue
+		}
+		if err != nil {
+			return common.Money{}, 0, err
+		}
+		if total, err = total.Add(amount); err != nil {
+			return common.Money{}, 0, err
+		}
+	}
+	return total, unconverted, nil
+}
+
+// ExpenseChanged publishes budget alerts to the workspace's members when a
+// write moves a budget's spend across 80% or 100% of its limit. It
+// implements expense.ChangeListener.
+func (s *Service) ExpenseChanged(userID uint, before, after *common.Expense) {
+	var workspaceID uint
+	for _, e := range []*common.Expense{before, after} {
+		if e != nil {
+			workspaceID = e.WorkspaceID
+		}
+	}
+	if err := s.checkThresholds(workspaceID, before, after); err != nil {
+		s.logger.Error("Failed to check budget thresholds", zap.Uint("workspace_id", workspaceID), zap.Error(err))
+	}
+}
+
+func (s *Service) checkThresholds(workspaceID uint, before, after *common.Expense) error {
+	budgets, err := s.GetBudgets(workspaceID)
+	if err != nil {
+		return err
+	}
+	var recipients []uint
+
+	converter := common.NewConverter(s.db)
+	for _, budget := range budgets {
+		var dates []time.Time
+		for _, e := range []*common.Expense{before, after} {
+			if e != nil && matches(budget, e) {
+				dates = append(dates, e.Date)
+			}
+		}
+		checked := make(map[time.Time]bool)
+
+		for _, date := range dates {
+			start, end := PeriodBounds(budget.Period, date)
+			if checked[start] {
+				continue
+			}
+			checked[start] = true
+
+			status, err := s.status(budget, date, converter)
+			if err != nil {
+				return err
+			}
+
+			added, err := s.contribution(budget, after, start, end, converter)
+			if err != nil {
+				return err
+			}
+			removed, err := s.contribution(budget, before, start, end, converter)
+			if err != nil {
+				return err
+			}
+			delta, err := added.Sub(removed)
+			if err != nil {
+				return err
+			}
+
+			previous, err := status.Spent.Sub(delta)
+			if err != nil {
+				return err
+			}
+			if recipients == nil {
+				if recipients, err = s.members(workspaceID); err != nil {
+					return err
+				}
+			}
+			s.publishCrossings(recipients, *status, previous)
+		}
+	}
+	return nil
+}
+
+// contribution is what expense adds to the budget's spend in [start, end).
+func (s *Service) contribution(budget common.Budget, expense *common.Expense, start, end time.Time, converter *common.Converter) (common.Money, error) {
+	zero := common.Zero(budget.Limit.Currency)
+	if expense == nil || !matches(budget, expense) || expense.Date.Before(start) || !expense.Date.Before(end) {
+		return zero, nil
+	}
+
+	amount, err := converter.Convert(expense.Amount, budget.Limit.Currency, expense.Date)
+	if errors.Is(err, common.ErrRateNotFound) {
+		return zero, nil
+	}
+	return amount, err
+}
+
+func (s *Service) publishCrossings(userIDs []uint, status Status, previous common.Money) {
+	event := crossedEvent(previous.Minor, status.Spent.Minor, status.Limit.Minor)
+	if event == "" {
+		return
+	}
+
+	data := alert{
+		BudgetID:    status.Budget.ID,
+		Category:    status.Budget.Category,
+		Period:      status.Budget.Period,
+		PeriodStart: status.PeriodStart.Format("2006-01-02"),
+		Spent:       status.Spent,
+		Limit:       status.Limit,
+		Currency:    status.Limit.Currency,
+		Percent:     status.Percent,
+	}
+	for _, userID := range userIDs {
+		if err := notify.Publish(context.Background(), s.redis, userID, event, data); err != nil {
+			s.logger.Warn("Failed to publish budget alert", zap.String("event", event), zap.Error(err))
+		}
+	}
+}
+
+// members lists who is alerted about the workspace's budgets.
+func (s *Service) members(workspaceID uint) ([]uint, error) {
+	var userIDs []uint
+	err := s.db.Model(&common.WorkspaceMember{}).Where("workspace_id = ?", workspaceID).Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
+// crossedEvent names the alert for spend moving from previous to spent against
+// limit, or returns "" if no threshold was crossed upwards.
+func crossedEvent(previous, spent, limit int64) string {
+	if limit <= 0 {
+		return ""
+	}
+	crossed := func(pct int64) bool {
+		return previous*100 < limit*pct && spent*100 >= limit*pct
+	}
+
+	switch {
+	case crossed(100):
+		return EventExceeded
+	case crossed(thresholdPercent):
+		return EventThresholdReached
+	}
+	return ""
+}
+
+func matches(budget common.Budget, expense *common.Expense) bool {
+	return budget.Category == common.BudgetAllCategories || strings.EqualFold(budget.Category, expense.Category)
+}
+
+// PeriodBounds returns the [start, end) window of period that contains date.
+// Weeks start on Monday.
+func PeriodBounds(period string, date time.Time) (time.Time, time.Time) {
+	day := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	switch period {
+	case common.PeriodWeekly:
+		start := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		return start, start.AddDate(0, 0, 7)
+	case common.PeriodYearly:
+		start := time.Date(day.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(1, 0, 0)
+	default:
+		start := time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	}
+}
+
+func percent(spent, limit common.Money) float64 {
+	if limit.Minor <= 0 {
+		return 0
+	}
+	return float64(spent.Minor*10000/limit.Minor) / 100
+}
@@ -0,0 +1,128 @@
+package budget
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+	"fintrack/internal/common"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&common.User{}, &common.Workspace{}, &common.WorkspaceMember{}, &common.Expense{}, &common.Budget{}, &common.ExchangeRate{})
+	return db
+}
+
+func TestBudgetService_GetStatusWithRollover(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db, nil, zap.NewNop())
+
+	budget, err := service.CreateBudget(1, 1, common.BudgetRequest{
+		Category: "Food",
+		Period:   common.PeriodMonthly,
+		Limit:    "200",
+		Rollover: true,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	db.Model(budget).Update("created_at", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	db.Create(&[]common.Expense{
+		{WorkspaceID: 1, UserID: 1, Amount: common.MustParseMoney("150", "USD"), Category: "Food", Date: time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)},
+		{WorkspaceID: 1, UserID: 1, Amount: common.MustParseMoney("90", "USD"), Category: "Food", Date: time.Date(2024, 2, 3, 0, 0, 0, 0, time.UTC)},
+		{WorkspaceID: 1, UserID: 1, Amount: common.MustParseMoney("500", "USD"), Category: "Rent", Date: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+	})
+
+	status, err := service.GetStatus(1, budget.ID, time.Date(2024, 2, 15, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if status.Rollover.String() != "50.00" || status.Limit.String() != "250.00" {
+		t.Errorf("Expected 50.00 rolled into a 250.00 limit, got %s and %s", status.Rollover, status.Limit)
+	}
+	if status.Spent.String() != "90.00" || status.Remaining.String() != "160.00" || status.Percent != 36 {
+		t.Errorf("Expected 90.00 spent, 160.00 remaining, 36%%, got %s, %s, %v", status.Spent, status.Remaining, status.Percent)
+	}
+}
+
+func TestBudgetService_CountsTheWholeWorkspace(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db, nil, zap.NewNop())
+
+	db.Create(&common.Workspace{ID: 7, Name: "Household", OwnerID: 1, BaseCurrency: "EUR"})
+	budget, err := service.CreateBudget(7, 1, common.BudgetRequest{Category: "Food", Period: common.PeriodMonthly, Limit: "300"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if budget.Limit.Currency != "EUR" {
+		t.Errorf("Expected the workspace's base currency, got %s", budget.Limit.Currency)
+	}
+
+	day := time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)
+	db.Create(&[]common.Expense{
+		{WorkspaceID: 7, UserID: 1, Amount: common.MustParseMoney("40", "EUR"), Category: "Food", Date: day},
+		{WorkspaceID: 7, UserID: 2, Amount: common.MustParseMoney("25", "EUR"), Category: "Food", Date: day},
+		{WorkspaceID: 8, UserID: 1, Amount: common.MustParseMoney("99", "EUR"), Category: "Food", Date: day},
+	})
+
+	status, err := service.GetStatus(7, budget.ID, day)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if status.Spent.String() != "65.00" {
+		t.Errorf("Expected both members' 65.00 and nothing from other workspaces, got %s", status.Spent)
+	}
+	if _, err := service.GetBudget(8, budget.ID); err != gorm.ErrRecordNotFound {
+		t.Errorf("Expected the budget to be hidden from other workspaces, got %v", err)
+	}
+}
+
+func TestBudgetService_LimitUsesRequestCurrency(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db, nil, zap.NewNop())
+
+	for _, tc := range []struct {
+		body  string
+		minor int64
+	}{
+		{`{"category": "Food", "period": "monthly", "limit": "150.125", "currency": "KWD"}`, 150125},
+		{`{"category": "Food", "period": "monthly", "limit": 20000, "currency": "JPY"}`, 20000},
+	} {
+		var req common.BudgetRequest
+		if err := json.Unmarshal([]byte(tc.body), &req); err != nil {
+			t.Fatalf("Expected no error decoding %s, got %v", tc.body, err)
+		}
+		budget, err := service.CreateBudget(1, 1, req)
+		if err != nil {
+			t.Fatalf("Expected no error for %s, got %v", tc.body, err)
+		}
+		if budget.Limit.Minor != tc.minor {
+			t.Errorf("Expected %d minor units for %s, got %d", tc.minor, tc.body, budget.Limit.Minor)
+		}
+	}
+}
+
+func TestCrossedEvent(t *testing.T) {
+	cases := []struct {
+		previous, spent, limit int64
+		want                   string
+	}{
+		{7000, 8000, 10000, EventThresholdReached},
+		{8000, 9000, 10000, ""},
+		{9000, 10000, 10000, EventExceeded},
+		{5000, 12000, 10000, EventExceeded},
+		{12000, 5000, 10000, ""},
+		{0, 100, 0, ""},
+	}
+
+	for _, tc := range cases {
+		if got := crossedEvent(tc.previous, tc.spent, tc.limit); got != tc.want {
+			t.Errorf("crossedEvent(%d, %d, %d): expected %q, got %q", tc.previous, tc.spent, tc.limit, tc.want, got)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package category
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"fintrack/internal/common"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type Handler struct {
+	service *Service
+	logger  *zap.Logger
+}
+
+func NewHandler(service *Service, logger *zap.Logger) *Handler {
+	return &Handler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+func (h *Handler) GetCategories(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+
+	categories, err := h.service.ListCategories(workspaceID)
+	if err != nil {
+		h.logger.Error("Failed to get categories", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"categories": categories})
+}
+
+func (h *Handler) GetCategory(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	categoryID, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	category, err := h.service.GetCategory(workspaceID, categoryID)
+	if err != nil {
+		h.fail(c, "Failed to get category", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+func (h *Handler) CreateCategory(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+
+	var req common.CategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	category, err := h.service.CreateCategory(workspaceID, req)
+	if err != nil {
+		h.fail(c, "Failed to create category", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, category)
+}
+
+func (h *Handler) UpdateCategory(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	categoryID, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	var req common.UpdateCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	category, err := h.service.UpdateCategory(workspaceID, categoryID, req)
+	if err != nil {
+		h.fail(c, "Failed to update category", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+func (h *Handler) DeleteCategory(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	categoryID, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteCategory(workspaceID, categoryID); err != nil {
+		h.fail(c, "Failed to delete category", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
+}
+
+func (h *Handler) MergeCategory(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	categoryID, ok := parseID(c)
+	if !ok {
+		return
+	}
+
+	var req common.MergeCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	category, err := h.service.MergeCategory(workspaceID, categoryID, req.IntoID)
+	if err != nil {
+		h.fail(c, "Failed to merge category", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+func (h *Handler) fail(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, ErrCategoryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrCategoryExists), errors.Is(err, ErrHasChildren), errors.Is(err, ErrCategoryInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		h.logger.Error(message, zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
+
+func parseID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (h *Handler) SetupRoutes(router *gin.RouterGroup) {
+	router.GET("", h.GetCategories)
+	router.POST("", h.CreateCategory)
+	router.GET("/:id", h.GetCategory)
+	router.PATCH("/:id", h.UpdateCategory)
+	router.DELETE("/:id", h.DeleteCategory)
+	router.POST("/:id/merge", h.MergeCategory)
+}
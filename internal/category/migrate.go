@@ -0,0 +1,49 @@
+package category
+
+import (
+	"fintrack/internal/common"
+	"gorm.io/gorm"
+)
+
+// Migrate files expenses and recurring expenses recorded before the catalog
+// existed under catalog categories, creating any their names call for. Names
+// differing only in case or spacing end up in one category. It must run
+// after workspace.Migrate and is a no-op once done.
+func Migrate(db *gorm.DB) error {
+	for _, model := range []interface{}{&common.Expense{}, &common.RecurringExpense{}} {
+		if !db.Migrator().HasTable(model) {
+			continue
+		}
+
+		var rows []struct {
+			WorkspaceID uint
+			Category    string
+		}
+		err := db.Unscoped().Model(model).
+			Select("DISTINCT workspace_id, category").
+			Where("category_id IS NULL AND workspace_id <> 0").
+			Order("workspace_id, category").
+			Scan(&rows).Error
+		if err != nil {
+			return err
+		}
+
+		for _, row := range rows {
+			name := row.Category
+			if Normalize(name) == "" {
+				name = "Uncategorized"
+			}
+			category, err := Resolve(db, row.WorkspaceID, name)
+			if err != nil {
+				return err
+			}
+			err = db.Unscoped().Model(model).
+				Where("workspace_id = ? AND category = ? AND category_id IS NULL", row.WorkspaceID, row.Category).
+				Updates(map[string]interface{}{"category_id": category.ID, "category": category.Name}).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
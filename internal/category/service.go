@@ -0,0 +1,494 @@
+package category
+
+import (
+	"errors"
+	"strings"
+	"fintrack/internal/common"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrCategoryNotFound = errors.New("category not found")
+	ErrCategoryExists   = errors.New("a category with this name already exists")
+	ErrInvalidParent    = errors.New("parent must be another top-level category")
+	ErrHasChildren      = errors.New("category has subcategories; move or merge them first")
+	ErrCategoryInUse    = errors.New("category is used by expenses or rules; merge it into another one instead")
+	ErrMergeIntoSelf    = errors.New("cannot merge a category into itself")
+)
+
+// Default is a seeded top-level category and its subcategories.
+type Default struct {
+	Name     string
+	Color    string
+	Icon     string
+	Children []string
+}
+
+// Defaults is the catalog every workspace starts with.
+var Defaults = []Default{
+	{Name: "Food", Color: "#f97316", Icon: "utensils", Children: []string{"Groceries", "Restaurants", "Coffee"}},
+	{Name: "Transport", Color: "#3b82f6", Icon: "car", Children: []string{"Fuel", "Public Transport", "Taxi", "Parking"}},
+	{Name: "Housing", Color: "#8b5cf6", Icon: "home", Children: []string{"Rent", "Utilities", "Maintenance"}},
+	{Name: "Health", Color: "#ef4444", Icon: "heart", Children: []string{"Pharmacy", "Doctor"}},
+	{Name: "Entertainment", Color: "#ec4899", Icon: "film", Children: []string{"Subscriptions", "Events"}},
+	{Name: "Shopping", Color: "#14b8a6", Icon: "shopping-bag", Children: []string{"Clothing", "Electronics"}},
+	{Name: "Travel", Color: "#0ea5e9", Icon: "plane", Children: []string{"Flights", "Lodging"}},
+	{Name: "Bills", Color: "#64748b", Icon: "file-text"},
+	{Name: "Education", Color: "#eab308", Icon: "book"},
+	{Name: "Gifts", Color: "#d946ef", Icon: "gift"},
+	{Name: "Uncategorized", Color: "#9ca3af", Icon: "tag"},
+}
+
+// Tree is a top-level category with its subcategories.
+type Tree struct {
+	common.Category
+	Children []common.Category `json:"children"`
+}
+
+// Normalize trims name and collapses inner whitespace.
+func Normalize(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+func nameKey(name string) string {
+	return strings.ToLower(Normalize(name))
+}
+
+// Seed adds Defaults to a workspace that has never had any categories.
+// Deleted categories count, so a catalog the user emptied stays empty.
+func Seed(db *gorm.DB, workspaceID uint) error {
+	var count int64
+	if err := db.Unscoped().Model(&common.Category{}).Where("workspace_id = ?", workspaceID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, d := range Defaults {
+			parent := common.Category{WorkspaceID: workspaceID, Name: d.Name, NameKey: nameKey(d.Name), Color: d.Color, Icon: d.Icon}
+			// A concurrent seed got there first; its rows are identical.
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&parent)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return nil
+			}
+			for _, name := range d.Children {
+				child := common.Category{WorkspaceID: workspaceID, ParentID: &parent.ID, Name: name, NameKey: nameKey(name), Color: d.Color, Icon: d.Icon}
+				if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&child).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Resolve finds the workspace category named name, ignoring case and extra
+// spaces, and creates it as a top-level category when there is none, so
+// free-text names from clients and imports always land in the catalog.
+func Resolve(db *gorm.DB, workspaceID uint, name string) (*common.Category, error) {
+	key := nameKey(name)
+	if key == "" {
+		return nil, errors.New("category cannot be empty")
+	}
+
+	category, err := findByKey(db, workspaceID, key)
+	if err != nil || category != nil {
+		return category, err
+	}
+
+	if err := Seed(db, workspaceID); err != nil {
+		return nil, err
+	}
+	if category, err := findByKey(db, workspaceID, key); err != nil || category != nil {
+		return category, err
+	}
+
+	created, err := create(db, workspaceID, common.CategoryRequest{Name: name})
+	if errors.Is(err, ErrCategoryExists) {
+		// Created concurrently.
+		return findByKey(db, workspaceID, key)
+	}
+	return created, err
+}
+
+// Get returns a category of the workspace by ID.
+func Get(db *gorm.DB, workspaceID, categoryID uint) (*common.Category, error) {
+	var category common.Category
+	err := db.Where("id = ? AND workspace_id = ?", categoryID, workspaceID).First(&category).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCategoryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// RootNames maps every category ID of the workspace, deleted ones included,
+// to the name of its top-level category, for rolling totals up.
+func RootNames(db *gorm.DB, workspaceID uint) (map[uint]string, error) {
+	var categories []common.Category
+	if err := db.Unscoped().Where("workspace_id = ?", workspaceID).Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint]common.Category, len(categories))
+	for _, c := range categories {
+		byID[c.ID] = c
+	}
+	roots := make(map[uint]string, len(categories))
+	for _, c := range categories {
+		roots[c.ID] = c.Name
+		if c.ParentID != nil {
+			if parent, ok := byID[*c.ParentID]; ok {
+				roots[c.ID] = parent.Name
+			}
+		}
+	}
+	return roots, nil
+}
+
+func findByKey(db *gorm.DB, workspaceID uint, key string) (*common.Category, error) {
+	var category common.Category
+	err := db.Where("workspace_id = ? AND name_key = ?", workspaceID, key).First(&category).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+func create(db *gorm.DB, workspaceID uint, req common.CategoryRequest) (*common.Category, error) {
+	name := Normalize(req.Name)
+	if name == "" {
+		return nil, errors.New("name cannot be empty")
+	}
+	if err := checkParent(db, workspaceID, 0, req.ParentID); err != nil {
+		return nil, err
+	}
+
+	category := common.Category{
+		WorkspaceID: workspaceID,
+		ParentID:    req.ParentID,
+		Name:        name,
+		NameKey:     nameKey(name),
+		Color:       req.Color,
+		Icon:        req.Icon,
+	}
+
+	// A deleted category keeps its name; bring it back instead.
+	var deleted common.Category
+	err := db.Unscoped().Where("workspace_id = ? AND name_key = ? AND deleted_at IS NOT NULL", workspaceID, category.NameKey).First(&deleted).Error
+	if err == nil {
+		category.ID = deleted.ID
+		category.CreatedAt = deleted.CreatedAt
+		if err := db.Unscoped().Select("*").Save(&category).Error; err != nil {
+			return nil, err
+		}
+		return &category, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&category)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrCategoryExists
+	}
+	return &category, nil
+}
+
+// checkParent ensures parentID, when set, is a top-level category of the
+// workspace other than categoryID.
+func checkParent(db *gorm.DB, workspaceID, categoryID uint, parentID *uint) error {
+	if parentID == nil {
+		return nil
+	}
+	if *parentID == categoryID {
+		return ErrInvalidParent
+	}
+	parent, err := Get(db, workspaceID, *parentID)
+	if errors.Is(err, ErrCategoryNotFound) {
+		return ErrInvalidParent
+	}
+	if err != nil {
+		return err
+	}
+	if parent.ParentID != nil {
+		return ErrInvalidParent
+	}
+	return nil
+}
+
+type Service struct {
+	db *gorm.DB
+}
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{db: db}
+}
+
+// ListCategories returns the workspace catalog as a tree sorted by name,
+// seeding the defaults on first use.
+func (s *Service) ListCategories(workspaceID uint) ([]Tree, error) {
+	if err := Seed(s.db, workspaceID); err != nil {
+		return nil, err
+	}
+
+	var categories []common.Category
+	if err := s.db.Where("workspace_id = ?", workspaceID).Order("name_key").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	trees := []Tree{}
+	index := make(map[uint]int)
+	for _, c := range categories {
+		if c.ParentID == nil {
+			index[c.ID] = len(trees)
+			trees = append(trees, Tree{Category: c, Children: []common.Category{}})
+		}
+	}
+	for _, c := range categories {
+		if c.ParentID == nil {
+			continue
+		}
+		if i, ok := index[*c.ParentID]; ok {
+			trees[i].Children = append(trees[i].Children, c)
+		}
+	}
+	return trees, nil
+}
+
+func (s *Service) GetCategory(workspaceID, categoryID uint) (*common.Category, error) {
+	return Get(s.db, workspaceID, categoryID)
+}
+
+func (s *Service) CreateCategory(workspaceID uint, req common.CategoryRequest) (*common.Category, error) {
+	if err := Seed(s.db, workspaceID); err != nil {
+		return nil, err
+	}
+	if existing, err := findByKey(s.db, workspaceID, nameKey(req.Name)); err != nil || existing != nil {
+		if err == nil {
+			err = ErrCategoryExists
+		}
+		return nil, err
+	}
+	return create(s.db, workspaceID, req)
+}
+
+// UpdateCategory applies the fields set in req. Renaming re-points the
+// expenses, recurring expenses and budgets filed under the category, and
+// renaming or moving it marks the workspace's reports stale.
+func (s *Service) UpdateCategory(workspaceID, categoryID uint, req common.UpdateCategoryRequest) (*common.Category, error) {
+	category, err := Get(s.db, workspaceID, categoryID)
+	if err != nil {
+		return nil, err
+	}
+
+	renamed, moved := false, false
+	previousName := category.Name
+	if req.Name != nil {
+		name := Normalize(*req.Name)
+		if name == "" {
+			return nil, errors.New("name cannot be empty")
+		}
+		if nameKey(name) != category.NameKey {
+			existing, err := findByKey(s.db, workspaceID, nameKey(name))
+			if err != nil {
+				return nil, err
+			}
+			if existing != nil {
+				return nil, ErrCategoryExists
+			}
+		}
+		renamed = name != category.Name
+		category.Name = name
+		category.NameKey = nameKey(name)
+	}
+	if req.ParentID != nil {
+		var parentID *uint
+		if *req.ParentID != 0 {
+			parentID = req.ParentID
+			if err := checkParent(s.db, workspaceID, category.ID, parentID); err != nil {
+				return nil, err
+			}
+			var children int64
+			if err := s.db.Model(&common.Category{}).Where("parent_id = ?", category.ID).Count(&children).Error; err != nil {
+				return nil, err
+			}
+			if children > 0 {
+				return nil, ErrHasChildren
+			}
+		}
+		moved = !sameParent(category.ParentID, parentID)
+		category.ParentID = parentID
+	}
+	if req.Color != nil {
+		category.Color = *req.Color
+	}
+	if req.Icon != nil {
+		category.Icon = *req.Icon
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Deleted rows keep their name, so a new one may only reuse it by
+		// taking the row over; clear it out of the way first.
+		if renamed {
+			err := tx.Unscoped().Where("workspace_id = ? AND name_key = ? AND id <> ? AND deleted_at IS NOT NULL", workspaceID, category.NameKey, category.ID).
+				Delete(&common.Category{}).Error
+			if err != nil {
+				return err
+			}
+		}
+		if err := tx.Select("*").Save(category).Error; err != nil {
+			return err
+		}
+		if renamed {
+			if err := repoint(tx, workspaceID, category.ID, previousName, category); err != nil {
+				return err
+			}
+		}
+		if renamed || moved {
+			return markReportsStale(tx, workspaceID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// DeleteCategory removes an unused category without subcategories.
+func (s *Service) DeleteCategory(workspaceID, categoryID uint) error {
+	category, err := Get(s.db, workspaceID, categoryID)
+	if err != nil {
+		return err
+	}
+
+	var children int64
+	if err := s.db.Model(&common.Category{}).Where("parent_id = ?", category.ID).Count(&children).Error; err != nil {
+		return err
+	}
+	if children > 0 {
+		return ErrHasChildren
+	}
+
+	for _, model := range []interface{}{&common.Expense{}, &common.RecurringExpense{}, &common.CategoryRule{}} {
+		if !s.db.Migrator().HasTable(model) {
+			continue
+		}
+		var used int64
+		if err := s.db.Model(model).Where("category_id = ?", category.ID).Count(&used).Error; err != nil {
+			return err
+		}
+		if used > 0 {
+			return ErrCategoryInUse
+		}
+	}
+
+	return s.db.Delete(category).Error
+}
+
+// MergeCategory files everything under categoryID under intoID instead and
+// deletes categoryID. Its subcategories move to intoID, which must then be
+// top-level.
+func (s *Service) MergeCategory(workspaceID, categoryID, intoID uint) (*common.Category, error) {
+	if categoryID == intoID {
+		return nil, ErrMergeIntoSelf
+	}
+	source, err := Get(s.db, workspaceID, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	target, err := Get(s.db, workspaceID, intoID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var children []uint
+		if err := tx.Model(&common.Category{}).Where("parent_id = ?", source.ID).Pluck("id", &children).Error; err != nil {
+			return err
+		}
+		if len(children) > 0 {
+			if target.ParentID != nil {
+				return ErrInvalidParent
+			}
+			if err := tx.Model(&common.Category{}).Where("id IN ?", children).Update("parent_id", target.ID).Error; err != nil {
+				return err
+			}
+		}
+		if err := repoint(tx, workspaceID, source.ID, source.Name, target); err != nil {
+			return err
+		}
+		if err := tx.Delete(source).Error; err != nil {
+			return err
+		}
+		return markReportsStale(tx, workspaceID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return target, nil
+}
+
+// repoint files the expenses and recurring expenses under fromID under to,
+// and has rules file them there too. Budgets match categories by name, so
+// those on fromName follow as well.
+func repoint(tx *gorm.DB, workspaceID, fromID uint, fromName string, to *common.Category) error {
+	for _, model := range []interface{}{&common.Expense{}, &common.RecurringExpense{}} {
+		err := tx.Model(model).
+			Where("workspace_id = ? AND category_id = ?", workspaceID, fromID).
+			Updates(map[string]interface{}{"category_id": to.ID, "category": to.Name}).Error
+		if err != nil {
+			return err
+		}
+	}
+	if tx.Migrator().HasTable(&common.CategoryRule{}) {
+		err := tx.Model(&common.CategoryRule{}).
+			Where("workspace_id = ? AND category_id = ?", workspaceID, fromID).
+			Update("category_id", to.ID).Error
+		if err != nil {
+			return err
+		}
+	}
+	if !tx.Migrator().HasTable(&common.Budget{}) {
+		return nil
+	}
+	return tx.Model(&common.Budget{}).
+		Where("workspace_id = ? AND LOWER(category) = ?", workspaceID, strings.ToLower(fromName)).
+		Update("category", to.Name).Error
+}
+
+// markReportsStale makes reports rebuild after category names or the
+// hierarchy changed, since both appear in their data.
+func markReportsStale(tx *gorm.DB, workspaceID uint) error {
+	if tx.Migrator().HasTable(&common.ExpenseVersion{}) {
+		if err := common.BumpExpenseVersion(tx, workspaceID); err != nil {
+			return err
+		}
+	}
+	if !tx.Migrator().HasTable(&common.Report{}) {
+		return nil
+	}
+	return tx.Model(&common.Report{}).Where("workspace_id = ?", workspaceID).Update("stale", true).Error
+}
+
+func sameParent(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
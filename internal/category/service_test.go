@@ -0,0 +1,162 @@
+package category
+
+import (
+	"testing"
+	"time"
+	"fintrack/internal/common"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&common.Category{}, &common.Expense{}, &common.RecurringExpense{}, &common.Report{}, &common.ExpenseVersion{}, &common.Budget{})
+	return db
+}
+
+func TestCategoryService_SeedAndResolve(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db)
+
+	trees, err := service.ListCategories(1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(trees) != len(Defaults) {
+		t.Fatalf("Expected %d seeded top-level categories, got %d", len(Defaults), len(trees))
+	}
+	for _, tree := range trees {
+		if tree.Name == "Food" && len(tree.Children) != 3 {
+			t.Errorf("Expected Food to have 3 subcategories, got %d", len(tree.Children))
+		}
+	}
+
+	food, err := Resolve(db, 1, "  food ")
+	if err != nil || food.Name != "Food" {
+		t.Fatalf("Expected \"  food \" to resolve to Food, got %+v, %v", food, err)
+	}
+	pets, err := Resolve(db, 1, "Pet  Supplies")
+	if err != nil || pets.Name != "Pet Supplies" || pets.ParentID != nil {
+		t.Fatalf("Expected a new top-level Pet Supplies category, got %+v, %v", pets, err)
+	}
+	if again, _ := Resolve(db, 1, "PET SUPPLIES"); again.ID != pets.ID {
+		t.Errorf("Expected the same category, got %d and %d", pets.ID, again.ID)
+	}
+
+	if _, err := service.CreateCategory(1, common.CategoryRequest{Name: "pet supplies"}); err != ErrCategoryExists {
+		t.Errorf("Expected ErrCategoryExists, got %v", err)
+	}
+	groceries, _ := Resolve(db, 1, "Groceries")
+	if _, err := service.CreateCategory(1, common.CategoryRequest{Name: "Snacks", ParentID: &groceries.ID}); err != ErrInvalidParent {
+		t.Errorf("Expected ErrInvalidParent for a nested subcategory, got %v", err)
+	}
+	if _, err := Get(db, 2, food.ID); err != ErrCategoryNotFound {
+		t.Errorf("Expected another workspace's category to be hidden, got %v", err)
+	}
+
+	// Deleting every category must not bring the defaults back.
+	db.Where("workspace_id = ?", 1).Delete(&common.Category{})
+	if trees, _ := service.ListCategories(1); len(trees) != 0 {
+		t.Errorf("Expected an emptied catalog to stay empty, got %d categories", len(trees))
+	}
+}
+
+func TestCategoryService_RenameMergeAndDelete(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db)
+
+	groceries, _ := Resolve(db, 1, "Groceries")
+	supermarket, _ := Resolve(db, 1, "Supermarket")
+	date := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for _, c := range []*common.Category{groceries, supermarket, supermarket} {
+		db.Create(&common.Expense{WorkspaceID: 1, UserID: 1, Amount: common.MustParseMoney("10", "USD"), Category: c.Name, CategoryID: &c.ID, Date: date})
+		date = date.AddDate(0, 0, 1)
+	}
+	db.Create(&common.Report{WorkspaceID: 1, UserID: 1, Type: "monthly", Period: "2024-03", GeneratedAt: time.Now()})
+	budget := common.Budget{WorkspaceID: 1, UserID: 1, Category: "supermarket", Period: "monthly", Limit: common.MustParseMoney("100", "USD")}
+	other := common.Budget{WorkspaceID: 2, UserID: 2, Category: "Supermarket", Period: "monthly", Limit: common.MustParseMoney("100", "USD")}
+	db.Create(&budget)
+	db.Create(&other)
+
+	name := "Supermarkets"
+	renamed, err := service.UpdateCategory(1, supermarket.ID, common.UpdateCategoryRequest{Name: &name})
+	if err != nil || renamed.Name != "Supermarkets" {
+		t.Fatalf("Expected the rename to succeed, got %+v, %v", renamed, err)
+	}
+	var count int64
+	db.Model(&common.Expense{}).Where("category = ?", "Supermarkets").Count(&count)
+	if count != 2 {
+		t.Errorf("Expected 2 expenses to follow the rename, got %d", count)
+	}
+	db.First(&budget, budget.ID)
+	db.First(&other, other.ID)
+	if budget.Category != "Supermarkets" || other.Category != "Supermarket" {
+		t.Errorf("Expected only this workspace's budget to follow the rename, got %q and %q", budget.Category, other.Category)
+	}
+	var report common.Report
+	db.First(&report)
+	if !report.Stale {
+		t.Error("Expected the rename to mark reports stale")
+	}
+
+	if err := service.DeleteCategory(1, supermarket.ID); err != ErrCategoryInUse {
+		t.Errorf("Expected ErrCategoryInUse, got %v", err)
+	}
+	food, _ := Resolve(db, 1, "Food")
+	if err := service.DeleteCategory(1, food.ID); err != ErrHasChildren {
+		t.Errorf("Expected ErrHasChildren, got %v", err)
+	}
+
+	if _, err := service.MergeCategory(1, supermarket.ID, groceries.ID); err != nil {
+		t.Fatalf("Expected the merge to succeed, got %v", err)
+	}
+	db.Model(&common.Expense{}).Where("category_id = ? AND category = ?", groceries.ID, "Groceries").Count(&count)
+	if count != 3 {
+		t.Errorf("Expected all 3 expenses filed under Groceries, got %d", count)
+	}
+	db.First(&budget, budget.ID)
+	if budget.Category != "Groceries" {
+		t.Errorf("Expected the budget to follow the merge, got %q", budget.Category)
+	}
+	if _, err := Get(db, 1, supermarket.ID); err != ErrCategoryNotFound {
+		t.Errorf("Expected the merged category to be gone, got %v", err)
+	}
+
+	roots, _ := RootNames(db, 1)
+	if roots[groceries.ID] != "Food" || roots[food.ID] != "Food" {
+		t.Errorf("Expected Groceries to roll up into Food, got %q", roots[groceries.ID])
+	}
+
+	// A merged-away name can be used again.
+	again, err := service.CreateCategory(1, common.CategoryRequest{Name: "supermarkets", Color: "#00ff00"})
+	if err != nil || again.ID != supermarket.ID || again.Color != "#00ff00" {
+		t.Errorf("Expected the deleted category to be restored, got %+v, %v", again, err)
+	}
+}
+
+func TestMigrateFilesExistingExpenses(t *testing.T) {
+	db := setupTestDB()
+	date := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for _, name := range []string{"Food", "food ", "Travel Stuff", "travel  stuff"} {
+		db.Create(&common.Expense{WorkspaceID: 1, UserID: 1, Amount: common.MustParseMoney("10", "USD"), Category: name, Date: date})
+		date = date.AddDate(0, 0, 1)
+	}
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var expenses []common.Expense
+	db.Order("id").Find(&expenses)
+	for i, expense := range expenses {
+		if expense.CategoryID == nil {
+			t.Fatalf("Expected expense %d to be filed, got no category ID", i)
+		}
+	}
+	if expenses[0].Category != "Food" || *expenses[0].CategoryID != *expenses[1].CategoryID || expenses[1].Category != "Food" {
+		t.Errorf("Expected Food and food to share the seeded Food category, got %+v and %+v", expenses[0], expenses[1])
+	}
+	if *expenses[2].CategoryID != *expenses[3].CategoryID || expenses[3].Category != "Travel Stuff" {
+		t.Errorf("Expected both spellings of Travel Stuff in one category, got %q and %q", expenses[2].Category, expenses[3].Category)
+	}
+}
@@ -0,0 +1,66 @@
+package common
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	MaxMetadataKeys  = 50
+	MaxMetadataBytes = 4096
+)
+
+var ErrMetadataTooLarge = fmt.Errorf("metadata is limited to %d keys and %d bytes", MaxMetadataKeys, MaxMetadataBytes)
+
+// Metadata is a free-form JSON object attached to an expense, such as a trip
+// ID or a tax reference. It is stored as JSON text so it works on any
+// database.
+type Metadata map[string]interface{}
+
+// Validate reports whether m fits the size limits.
+func (m Metadata) Validate() error {
+	if len(m) > MaxMetadataKeys {
+		return ErrMetadataTooLarge
+	}
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	if len(raw) > MaxMetadataBytes {
+		return ErrMetadataTooLarge
+	}
+	return nil
+}
+
+func (m Metadata) Value() (driver.Value, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return string(raw), nil
+}
+
+func (m *Metadata) Scan(src interface{}) error {
+	var raw []byte
+	switch v := src.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case string:
+		raw = []byte(v)
+	case []byte:
+		raw = v
+	default:
+		return errors.New("metadata must be JSON text")
+	}
+	if len(raw) == 0 {
+		*m = nil
+		return nil
+	}
+	return json.Unmarshal(raw, m)
+}
@@ -0,0 +1,31 @@
+package common
+
+import (
+	"gorm.io/gorm"
+)
+
+// MigrateExpenseAmounts moves legacy float64 amounts into the fixed-point
+// amount_minor/amount_currency columns and drops the old column. It must run
+// after AutoMigrate has created the new columns and is a no-op once done.
+// Legacy rows are assumed to be in DefaultCurrency.
+func MigrateExpenseAmounts(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&Expense{}, "amount") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		scale := 1
+		for i := 0; i < CurrencyExponent(DefaultCurrency); i++ {
+			scale *= 10
+		}
+
+		if err := tx.Exec(
+			"UPDATE expenses SET amount_minor = CAST(ROUND(amount * ?) AS BIGINT), amount_currency = ? WHERE amount IS NOT NULL",
+			scale, DefaultCurrency,
+		).Error; err != nil {
+			return err
+		}
+
+		return tx.Migrator().DropColumn(&Expense{}, "amount")
+	})
+}
@@ -1,39 +1,397 @@
 package common
 
 import (
+	"encoding/json"
+	"strings"
 	"time"
 	"gorm.io/gorm"
 )
 
 type User struct {
-	ID        uint           `json:"id" gorm:"primaryKey"`
-	Email     string         `json:"email" gorm:"unique;not null"`
-	Password  string         `json:"-" gorm:"not null"`
-	Name      string         `json:"name" gorm:"not null"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	ID              uint           `json:"id" gorm:"primaryKey"`
+	Email           string         `json:"email" gorm:"unique;not null"`
+	Password        string         `json:"-" gorm:"not null"`
+	Name            string         `json:"name" gorm:"not null"`
+	BaseCurrency    string         `json:"base_currency" gorm:"size:3;not null;default:USD"`
+	EmailVerified   bool           `json:"email_verified" gorm:"not null;default:false"`
+	EmailVerifiedAt *time.Time     `json:"email_verified_at,omitempty"`
+	LockedUntil     *time.Time     `json:"locked_until,omitempty"`
+	Roles           string         `json:"-" gorm:"not null;default:''"`
+	DisabledAt      *time.Time     `json:"disabled_at,omitempty"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
+// RoleList returns the account roles, which Roles holds space-separated.
+func (u User) RoleList() []string {
+	return strings.Fields(u.Roles)
+}
+
+func (u User) Disabled() bool {
+	return u.DisabledAt != nil
+}
+
+// MarshalJSON exposes Roles as a list.
+func (u User) MarshalJSON() ([]byte, error) {
+	type user User
+	return json.Marshal(struct {
+		user
+		Roles []string `json:"roles"`
+	}{user(u), u.RoleList()})
+}
+
+// Expense belongs to a workspace; UserID is the member who recorded it.
 type Expense struct {
+	ID                 uint           `json:"id" gorm:"primaryKey"`
+	WorkspaceID        uint           `json:"workspace_id" gorm:"not null;default:0;index"`
+	UserID             uint           `json:"user_id" gorm:"not null"`
+	Amount             Money          `json:"amount" gorm:"embedded;embeddedPrefix:amount_"`
+	Description        string         `json:"description"`
+	Category           string         `json:"category" gorm:"not null"`
+	CategoryID         *uint          `json:"category_id,omitempty" gorm:"index"`
+	Date               time.Time      `json:"date" gorm:"not null;uniqueIndex:idx_expense_recurrence_date,priority:2"`
+	RecurringExpenseID *uint          `json:"recurring_expense_id,omitempty" gorm:"uniqueIndex:idx_expense_recurrence_date,priority:1"` // set when materialized from a rule
+	Tags               []Tag          `json:"tags,omitempty" gorm:"many2many:expense_tags"`
+	Metadata           Metadata       `json:"metadata,omitempty" gorm:"type:text"`
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	DeletedAt          gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// MarshalJSON keeps amount a plain number for existing clients and exposes the
+// currency alongside it.
+func (e Expense) MarshalJSON() ([]byte, error) {
+	type expense Expense
+	return json.Marshal(struct {
+		expense
+		Currency string `json:"currency"`
+	}{expense(e), e.Amount.Currency})
+}
+
+const (
+	FrequencyDaily   = "daily"
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+	FrequencyYearly  = "yearly"
+)
+
+// RecurringExpense is a rule that materializes an Expense every Interval
+// Frequency units from StartDate until EndDate or Count occurrences.
+// NextRun is nil once the rule is exhausted.
+type RecurringExpense struct {
 	ID          uint           `json:"id" gorm:"primaryKey"`
-	UserID      uint           `json:"user_id" gorm:"not null"`
-	Amount      float64        `json:"amount" gorm:"not null"`
+	WorkspaceID uint           `json:"workspace_id" gorm:"not null;default:0;index"`
+	UserID      uint           `json:"user_id" gorm:"not null;index"`
+	Amount      Money          `json:"amount" gorm:"embedded;embeddedPrefix:amount_"`
 	Description string         `json:"description"`
 	Category    string         `json:"category" gorm:"not null"`
-	Date        time.Time      `json:"date" gorm:"not null"`
+	CategoryID  *uint          `json:"category_id,omitempty" gorm:"index"`
+	Frequency   string         `json:"frequency" gorm:"not null"`
+	Interval    int            `json:"interval" gorm:"not null;default:1"`
+	StartDate   time.Time      `json:"start_date" gorm:"not null"`
+	EndDate     *time.Time     `json:"end_date,omitempty"`
+	Count       *int           `json:"count,omitempty"`
+	Occurrences int            `json:"occurrences" gorm:"not null;default:0"`
+	LastRun     *time.Time     `json:"last_run,omitempty"`
+	NextRun     *time.Time     `json:"next_run,omitempty" gorm:"index"`
 	CreatedAt   time.Time      `json:"created_at"`
 	UpdatedAt   time.Time      `json:"updated_at"`
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
+func (r RecurringExpense) MarshalJSON() ([]byte, error) {
+	type recurringExpense RecurringExpense
+	return json.Marshal(struct {
+		recurringExpense
+		Currency string `json:"currency"`
+	}{recurringExpense(r), r.Amount.Currency})
+}
+
+// BudgetAllCategories is the Budget.Category value that matches every expense.
+const BudgetAllCategories = "all"
+
+const (
+	PeriodWeekly  = "weekly"
+	PeriodMonthly = "monthly"
+	PeriodYearly  = "yearly"
+)
+
+// Budget caps a workspace's spending in a category (or all categories) per
+// period; UserID is the member who created it. With Rollover, the previous
+// period's unspent or overspent amount is carried into the current one.
+type Budget struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	WorkspaceID uint           `json:"workspace_id" gorm:"not null;default:0;index"`
+	UserID      uint           `json:"user_id" gorm:"not null;index"`
+	Category    string         `json:"category" gorm:"not null"`
+	Period      string         `json:"period" gorm:"not null"`
+	Limit       Money          `json:"limit" gorm:"embedded;embeddedPrefix:limit_"`
+	Rollover    bool           `json:"rollover" gorm:"not null;default:false"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+func (b Budget) MarshalJSON() ([]byte, error) {
+	type budget Budget
+	return json.Marshal(struct {
+		budget
+		Currency string `json:"currency"`
+	}{budget(b), b.Limit.Currency})
+}
+
+// Category is an entry in a workspace's category catalog. Categories nest
+// one level deep: a subcategory's parent is always top-level. Names are
+// unique within the workspace regardless of case and spacing; NameKey holds
+// the normalized form. Expenses keep the name alongside CategoryID.
+type Category struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	WorkspaceID uint           `json:"workspace_id" gorm:"not null;uniqueIndex:idx_category_workspace_name"`
+	ParentID    *uint          `json:"parent_id,omitempty" gorm:"index"`
+	Name        string         `json:"name" gorm:"size:64;not null"`
+	NameKey     string         `json:"-" gorm:"size:64;not null;uniqueIndex:idx_category_workspace_name"`
+	Color       string         `json:"color" gorm:"size:7"`
+	Icon        string         `json:"icon" gorm:"size:32"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// Tag labels expenses across categories, such as a trip or "tax-deductible".
+// Like categories, names are unique within the workspace regardless of case
+// and spacing.
+type Tag struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	WorkspaceID uint      `json:"-" gorm:"not null;uniqueIndex:idx_tag_workspace_name"`
+	Name        string    `json:"name" gorm:"size:32;not null"`
+	NameKey     string    `json:"-" gorm:"size:32;not null;uniqueIndex:idx_tag_workspace_name"`
+	CreatedAt   time.Time `json:"-"`
+}
+
+// CategoryRule files new expenses that match all of its conditions under
+// CategoryID and adds its tags. Rules are tried in ascending Priority order
+// and the first match wins. Amount bounds are minor units of Currency and
+// only match expenses in that currency.
+type CategoryRule struct {
+	ID                  uint      `json:"id" gorm:"primaryKey"`
+	WorkspaceID         uint      `json:"workspace_id" gorm:"not null;index"`
+	Priority            int       `json:"priority" gorm:"not null;default:0"`
+	DescriptionContains string    `json:"description_contains,omitempty" gorm:"size:255"`
+	DescriptionPattern  string    `json:"description_pattern,omitempty" gorm:"size:255"`
+	Merchant            string    `json:"merchant,omitempty" gorm:"size:128"`
+	MinAmount           *int64    `json:"-"`
+	MaxAmount           *int64    `json:"-"`
+	Currency            string    `json:"currency,omitempty" gorm:"size:3"`
+	CategoryID          *uint     `json:"category_id,omitempty"`
+	Tags                []Tag     `json:"tags,omitempty" gorm:"many2many:category_rule_tags"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// MarshalJSON shows the amount bounds as plain numbers like expense amounts.
+func (r CategoryRule) MarshalJSON() ([]byte, error) {
+	type categoryRule CategoryRule
+	bound := func(minor *int64) *Money {
+		if minor == nil {
+			return nil
+		}
+		m := NewMoney(*minor, r.Currency)
+		return &m
+	}
+	return json.Marshal(struct {
+		categoryRule
+		MinAmount *Money `json:"min_amount,omitempty"`
+		MaxAmount *Money `json:"max_amount,omitempty"`
+	}{categoryRule(r), bound(r.MinAmount), bound(r.MaxAmount)})
+}
+
+// Attachment is a file such as a receipt kept with an expense. Its content
+// lives in the blob store under BlobKey, and images that could be decoded
+// also have a JPEG thumbnail under ThumbnailKey.
+type Attachment struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	WorkspaceID  uint      `json:"workspace_id" gorm:"not null;index"`
+	ExpenseID    uint      `json:"expense_id" gorm:"not null;index"`
+	UserID       uint      `json:"user_id" gorm:"not null"`
+	FileName     string    `json:"file_name" gorm:"size:255;not null"`
+	ContentType  string    `json:"content_type" gorm:"size:64;not null"`
+	Size         int64     `json:"size" gorm:"not null"`
+	BlobKey      string    `json:"-" gorm:"size:255;not null"`
+	ThumbnailKey string    `json:"-" gorm:"size:255"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (a Attachment) MarshalJSON() ([]byte, error) {
+	type attachment Attachment
+	return json.Marshal(struct {
+		attachment
+		Thumbnail bool `json:"thumbnail"`
+	}{attachment(a), a.ThumbnailKey != ""})
+}
+
+// ExpenseSplit is what UserID owes PayerID of an expense. The splits of one
+// expense always sum to its amount; the payer's own part is included.
+type ExpenseSplit struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	ExpenseID   uint      `json:"expense_id" gorm:"not null;uniqueIndex:idx_expense_split_user"`
+	WorkspaceID uint      `json:"workspace_id" gorm:"not null;index"`
+	PayerID     uint      `json:"payer_id" gorm:"not null"`
+	UserID      uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_expense_split_user"`
+	Method      string    `json:"method" gorm:"size:16;not null"`
+	Amount      Money     `json:"amount" gorm:"embedded;embeddedPrefix:amount_"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (s ExpenseSplit) MarshalJSON() ([]byte, error) {
+	type expenseSplit ExpenseSplit
+	return json.Marshal(struct {
+		expenseSplit
+		Currency string `json:"currency"`
+	}{expenseSplit(s), s.Amount.Currency})
+}
+
+// Settlement records FromUserID paying ToUserID back outside the app.
+type Settlement struct {
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	WorkspaceID uint           `json:"workspace_id" gorm:"not null;index"`
+	FromUserID  uint           `json:"from_user_id" gorm:"not null"`
+	ToUserID    uint           `json:"to_user_id" gorm:"not null"`
+	Amount      Money          `json:"amount" gorm:"embedded;embeddedPrefix:amount_"`
+	Date        time.Time      `json:"date" gorm:"not null"`
+	Note        string         `json:"note"`
+	CreatedByID uint           `json:"created_by_id" gorm:"not null"`
+	CreatedAt   time.Time      `json:"created_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+func (s Settlement) MarshalJSON() ([]byte, error) {
+	type settlement Settlement
+	return json.Marshal(struct {
+		settlement
+		Currency string `json:"currency"`
+	}{settlement(s), s.Amount.Currency})
+}
+
+// ImportMapping tells the CSV importer which columns hold which fields. Columns
+// are matched by header name (case-insensitive) or by 1-based position; an
+// empty column name means the field is absent.
+type ImportMapping struct {
+	ID                uint      `json:"id" gorm:"primaryKey"`
+	UserID            uint      `json:"user_id" gorm:"uniqueIndex;not null"`
+	Delimiter         string    `json:"delimiter" gorm:"size:1;not null"`
+	HasHeader         bool      `json:"has_header" gorm:"not null"`
+	DateColumn        string    `json:"date_column" gorm:"not null"`
+	DateFormat        string    `json:"date_format" gorm:"not null"`
+	AmountColumn      string    `json:"amount_column" gorm:"not null"`
+	DebitColumn       string    `json:"debit_column"`
+	CreditColumn      string    `json:"credit_column"`
+	DescriptionColumn string    `json:"description_column" gorm:"not null"`
+	CategoryColumn    string    `json:"category_column" gorm:"not null"`
+	CurrencyColumn    string    `json:"currency_column" gorm:"not null"`
+	DecimalComma      bool      `json:"decimal_comma" gorm:"not null"`
+	NegativeIsExpense bool      `json:"negative_is_expense" gorm:"not null"`
+	DefaultCategory   string    `json:"default_category" gorm:"not null"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+const (
+	ImportStatusPreview   = "preview"
+	ImportStatusCommitted = "committed"
+)
+
+// ImportBatch holds a parsed statement between preview and commit. Rows is
+// the JSON-encoded preview, checked for duplicates against WorkspaceID.
+type ImportBatch struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	WorkspaceID uint      `json:"workspace_id" gorm:"not null;default:0;index"`
+	UserID      uint      `json:"user_id" gorm:"not null;index"`
+	Format      string    `json:"format" gorm:"not null"`
+	Filename    string    `json:"filename"`
+	Status      string    `json:"status" gorm:"not null"`
+	Rows        string    `json:"-" gorm:"type:text"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Report summarises a workspace's expenses; UserID is the member who last
+// had it generated.
 type Report struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	WorkspaceID uint   `json:"workspace_id" gorm:"not null;default:0;index"`
+	UserID      uint   `json:"user_id" gorm:"not null"`
+	Type        string `json:"type" gorm:"not null"`   // weekly, monthly, quarterly, annual, range
+	Period      string `json:"period" gorm:"not null"` // 2024-W05, 2024-01, 2024-Q1, 2024, 2024-01-10..2024-02-20
+	Data        string `json:"data" gorm:"type:jsonb"`
+	// SourceFrom and SourceTo bound the expense dates the data depends on,
+	// including the previous period it is compared against.
+	SourceFrom    time.Time `json:"-" gorm:"index"`
+	SourceTo      time.Time `json:"-" gorm:"index"`
+	SourceVersion int64     `json:"source_version"`
+	Stale         bool      `json:"stale" gorm:"not null"`
+	GeneratedAt   time.Time `json:"generated_at"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+const (
+	ReportJobPending = "pending"
+	ReportJobRunning = "running"
+	ReportJobDone    = "done"
+	ReportJobFailed  = "failed"
+)
+
+// ReportJob is a queued request to build a report. Failed attempts are retried
+// from RunAfter until the attempt limit is reached.
+type ReportJob struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	WorkspaceID uint       `json:"workspace_id" gorm:"not null;default:0;index"`
+	UserID      uint       `json:"user_id" gorm:"not null;index"`
+	Type        string     `json:"type" gorm:"not null"`
+	Period      string     `json:"period" gorm:"not null"`
+	PeriodStart time.Time  `json:"period_start" gorm:"not null"`
+	PeriodEnd   time.Time  `json:"period_end" gorm:"not null"`
+	Status      string     `json:"status" gorm:"not null;index:idx_report_job_queue"`
+	Attempts    int        `json:"attempts" gorm:"not null"`
+	Error       string     `json:"error,omitempty"`
+	ReportID    *uint      `json:"report_id,omitempty"`
+	RunAfter    time.Time  `json:"run_after" gorm:"not null;index:idx_report_job_queue"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// ReportJobRequest selects a report period. Fields the type does not use are
+// ignored; zero values default to the current period.
+type ReportJobRequest struct {
+	Type    string `json:"type" binding:"required,oneof=weekly monthly quarterly annual range"`
+	Year    int    `json:"year"`
+	Month   int    `json:"month"`
+	Quarter int    `json:"quarter"`
+	Week    int    `json:"week"`
+	From    string `json:"from"`
+	To      string `json:"to"`
+}
+
+// ExpenseVersion counts writes to a workspace's expenses so readers of
+// derived data can tell which writes it reflects.
+type ExpenseVersion struct {
+	WorkspaceID uint      `json:"workspace_id" gorm:"primaryKey;autoIncrement:false"`
+	Version     int64     `json:"version" gorm:"not null"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ExchangeRate records that one unit of Base was worth Rate units of Quote on
+// Date. Rate is kept as a decimal string so it round-trips without loss.
+type ExchangeRate struct {
 	ID        uint      `json:"id" gorm:"primaryKey"`
-	UserID    uint      `json:"user_id" gorm:"not null"`
-	Type      string    `json:"type" gorm:"not null"` // monthly, annual
-	Period    string    `json:"period" gorm:"not null"` // 2024-01, 2024
-	Data      string    `json:"data" gorm:"type:jsonb"`
+	Base      string    `json:"base" gorm:"size:3;not null;uniqueIndex:idx_exchange_rate_pair_date"`
+	Quote     string    `json:"quote" gorm:"size:3;not null;uniqueIndex:idx_exchange_rate_pair_date"`
+	Date      time.Time `json:"date" gorm:"not null;uniqueIndex:idx_exchange_rate_pair_date"`
+	Rate      string    `json:"rate" gorm:"type:decimal(24,12);not null"`
 	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 type LoginRequest struct {
@@ -42,19 +400,419 @@ type LoginRequest struct {
 }
 
 type RegisterRequest struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
-	Name     string `json:"name" binding:"required"`
+	Email        string `json:"email" binding:"required,email"`
+	Password     string `json:"password" binding:"required,min=6"`
+	Name         string `json:"name" binding:"required"`
+	BaseCurrency string `json:"base_currency"`
 }
 
 type ExpenseRequest struct {
-	Amount      float64 `json:"amount" binding:"required,gt=0"`
-	Description string  `json:"description"`
-	Category    string  `json:"category" binding:"required"`
-	Date        string  `json:"date" binding:"required"`
+	Amount      Amount `json:"amount"`
+	Currency    string `json:"currency"`
+	Description string `json:"description"`
+	// With neither Category nor CategoryID, a new expense is filed by the
+	// workspace's rules and an updated one keeps its category.
+	Category   string `json:"category"`
+	CategoryID *uint  `json:"category_id"`
+	Date       string `json:"date" binding:"required"`
+	// Tags and Metadata are left unchanged on update when omitted; send an
+	// empty list or object to clear them.
+	Tags     []string `json:"tags" binding:"max=20,dive,max=32"`
+	Metadata Metadata `json:"metadata"`
+}
+
+type CategoryRuleRequest struct {
+	Priority            int      `json:"priority"`
+	DescriptionContains string   `json:"description_contains" binding:"max=255"`
+	DescriptionPattern  string   `json:"description_pattern" binding:"max=255"`
+	Merchant            string   `json:"merchant" binding:"max=128"`
+	MinAmount           *Amount  `json:"min_amount"`
+	MaxAmount           *Amount  `json:"max_amount"`
+	Currency            string   `json:"currency"`
+	CategoryID          *uint    `json:"category_id"`
+	Tags                []string `json:"tags" binding:"max=20,dive,max=32"`
+}
+
+type CategoryRequest struct {
+	Name     string `json:"name" binding:"required,max=64"`
+	ParentID *uint  `json:"parent_id"`
+	Color    string `json:"color" binding:"omitempty,hexcolor"`
+	Icon     string `json:"icon" binding:"max=32"`
+}
+
+// UpdateCategoryRequest changes only the fields present. A parent_id of 0
+// makes the category top-level.
+type UpdateCategoryRequest struct {
+	Name     *string `json:"name" binding:"omitempty,min=1,max=64"`
+	ParentID *uint   `json:"parent_id"`
+	Color    *string `json:"color" binding:"omitempty,hexcolor"`
+	Icon     *string `json:"icon" binding:"omitempty,max=32"`
+}
+
+type MergeCategoryRequest struct {
+	IntoID uint `json:"into_id" binding:"required"`
+}
+
+const (
+	SplitEqual      = "equal"
+	SplitExact      = "exact"
+	SplitPercentage = "percentage"
+	SplitShares     = "shares"
+)
+
+// SplitRequest divides an expense between workspace members. PaidBy defaults
+// to the member who recorded the expense. Each share sets the field its
+// method uses: Amount for exact, Percent for percentage and Shares for
+// shares.
+type SplitRequest struct {
+	Method string       `json:"method" binding:"required,oneof=equal exact percentage shares"`
+	PaidBy uint         `json:"paid_by"`
+	Shares []SplitShare `json:"shares" binding:"required,min=1,dive"`
+}
+
+type SplitShare struct {
+	UserID  uint        `json:"user_id" binding:"required"`
+	Amount  Amount      `json:"amount"`
+	Percent json.Number `json:"percent"`
+	Shares  int64       `json:"shares" binding:"min=0"`
+}
+
+type SettlementRequest struct {
+	FromUserID uint   `json:"from_user_id" binding:"required"`
+	ToUserID   uint   `json:"to_user_id" binding:"required"`
+	Amount     Amount `json:"amount"`
+	Currency   string `json:"currency"`
+	Date       string `json:"date"`
+	Note       string `json:"note" binding:"max=200"`
 }
 
+type RecurringExpenseRequest struct {
+	Amount      Amount `json:"amount"`
+	Currency    string `json:"currency"`
+	Description string `json:"description"`
+	Category    string `json:"category" binding:"required_without=CategoryID"`
+	CategoryID  *uint  `json:"category_id"`
+	Frequency   string `json:"frequency" binding:"required,oneof=daily weekly monthly yearly"`
+	Interval    int    `json:"interval" binding:"min=0"`
+	StartDate   string `json:"start_date" binding:"required"`
+	EndDate     string `json:"end_date"`
+	Count       *int   `json:"count" binding:"omitempty,min=1"`
+}
+
+type BudgetRequest struct {
+	Category string `json:"category" binding:"required"`
+	Period   string `json:"period" binding:"required,oneof=weekly monthly yearly"`
+	Limit    Amount `json:"limit"`
+	Currency string `json:"currency"`
+	Rollover bool   `json:"rollover"`
+}
+
+// UpdateProfileRequest changes only the fields present. Changing the email
+// needs CurrentPassword.
+type UpdateProfileRequest struct {
+	Name            *string `json:"name" binding:"omitempty,min=1"`
+	Email           *string `json:"email" binding:"omitempty,email"`
+	BaseCurrency    *string `json:"base_currency"`
+	CurrentPassword string  `json:"current_password"`
+}
+
+type DisableUserRequest struct {
+	Reason string `json:"reason" binding:"max=500"`
+}
+
+// UserRolesRequest replaces an account's roles; an empty list makes it an
+// ordinary user.
+type UserRolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=6"`
+}
+
+type APIKeyRequest struct {
+	Name      string   `json:"name" binding:"required,max=100"`
+	Scopes    []string `json:"scopes" binding:"required,min=1"`
+	ExpiresAt string   `json:"expires_at"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// AuthResponse carries a short-lived access token in Token and a refresh
+// token to obtain the next one.
 type AuthResponse struct {
-	Token string `json:"token"`
-	User  User   `json:"user"`
-}
\ No newline at end of file
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	User         User   `json:"user"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// LoginChallenge is returned by login instead of tokens when the account has
+// two-factor authentication enabled.
+type LoginChallenge struct {
+	MFARequired    bool   `json:"mfa_required"`
+	ChallengeToken string `json:"challenge_token"`
+	ExpiresIn      int    `json:"expires_in"`
+}
+
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code" binding:"required"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type DisableTwoFactorRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type TwoFactorSetup struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=6"`
+}
+
+// RefreshToken is stored by the SHA-256 of its value. Every token issued from
+// one login shares a FamilyID; each is single use and replaced on refresh.
+type RefreshToken struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	UserID       uint       `json:"user_id" gorm:"not null;index"`
+	FamilyID     string     `json:"-" gorm:"size:32;not null;index"`
+	TokenHash    string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	ExpiresAt    time.Time  `json:"expires_at" gorm:"not null"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	ReplacedByID *uint      `json:"-"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// SigningKey is a key pair the user service signs access tokens with. The
+// newest key without RetiredAt signs; retired keys stay published in the JWKS
+// until ExpiresAt so tokens they signed can still be verified.
+type SigningKey struct {
+	ID         string     `json:"kid" gorm:"primaryKey;size:32"`
+	Algorithm  string     `json:"alg" gorm:"size:16;not null"`
+	PrivateKey string     `json:"-" gorm:"type:text;not null"`
+	PublicKey  string     `json:"-" gorm:"type:text;not null"`
+	RetiredAt  *time.Time `json:"retired_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" gorm:"index"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"index"`
+}
+
+const (
+	TokenPurposeVerifyEmail   = "verify_email"
+	TokenPurposeResetPassword = "reset_password"
+)
+
+// UserToken is a single-use, expiring secret mailed to a user, stored by the
+// SHA-256 of its value like RefreshToken.
+type UserToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	Purpose   string     `json:"purpose" gorm:"size:32;not null"`
+	TokenHash string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// TOTPCredential is a user's authenticator secret. It only guards login once
+// Enabled, which happens after the user proves they can produce codes.
+// LastUsedStep stops a code from being accepted twice.
+type TOTPCredential struct {
+	UserID       uint      `json:"user_id" gorm:"primaryKey"`
+	Secret       string    `json:"-" gorm:"size:64;not null"`
+	Enabled      bool      `json:"enabled" gorm:"not null;default:false"`
+	LastUsedStep int64     `json:"-" gorm:"not null;default:0"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// RecoveryCode is a single-use fallback for a lost authenticator, stored by
+// the SHA-256 of its normalized value.
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	CodeHash  string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+const (
+	AuditAccountLocked   = "account_locked"
+	AuditIPThrottled     = "ip_throttled"
+	AuditPasswordChanged = "password_changed"
+	AuditEmailChanged    = "email_changed"
+	AuditAccountDeleted  = "account_deleted"
+	AuditAccountDisabled = "account_disabled"
+	AuditAccountEnabled  = "account_enabled"
+	AuditRolesChanged    = "roles_changed"
+)
+
+// AuditEvent records a security-relevant event. UserID is nil for events not
+// tied to a known account.
+type AuditEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    *uint     `json:"user_id,omitempty" gorm:"index"`
+	Event     string    `json:"event" gorm:"size:64;not null;index"`
+	IP        string    `json:"ip,omitempty" gorm:"size:64"`
+	Detail    string    `json:"detail,omitempty" gorm:"type:text"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// APIKey is a long-lived credential for scripts, stored by the SHA-256 of the
+// key. Prefix is the non-secret start of the key, shown so users can tell
+// their keys apart. Scopes is space-separated.
+type APIKey struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"not null;index"`
+	Name       string     `json:"name" gorm:"size:100;not null"`
+	Prefix     string     `json:"prefix" gorm:"size:16;not null;uniqueIndex"`
+	KeyHash    string     `json:"-" gorm:"size:64;not null;uniqueIndex"`
+	Scopes     string     `json:"-" gorm:"not null"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (k APIKey) ScopeList() []string {
+	return strings.Fields(k.Scopes)
+}
+
+// MarshalJSON exposes Scopes as a list.
+func (k APIKey) MarshalJSON() ([]byte, error) {
+	type apiKey APIKey
+	return json.Marshal(struct {
+		apiKey
+		Scopes []string `json:"scopes"`
+	}{apiKey(k), k.ScopeList()})
+}
+
+// NewAPIKey is returned once, on creation; Key is never shown again.
+type NewAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
+
+func (k NewAPIKey) MarshalJSON() ([]byte, error) {
+	type apiKey APIKey
+	return json.Marshal(struct {
+		apiKey
+		Scopes []string `json:"scopes"`
+		Key    string   `json:"key"`
+	}{apiKey(k.APIKey), k.ScopeList(), k.Key})
+}
+
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationDeclined = "declined"
+	InvitationRevoked  = "revoked"
+)
+
+// Workspace is a shared ledger of expenses and reports. Every user has a
+// personal workspace, marked by PersonalOwnerID, that cannot be shared or
+// deleted.
+type Workspace struct {
+	ID              uint           `json:"id" gorm:"primaryKey"`
+	Name            string         `json:"name" gorm:"size:100;not null"`
+	OwnerID         uint           `json:"owner_id" gorm:"not null;index"`
+	PersonalOwnerID *uint          `json:"-" gorm:"uniqueIndex"`
+	BaseCurrency    string         `json:"base_currency" gorm:"size:3;not null;default:USD"`
+	CreatedAt       time.Time      `json:"created_at"`
+	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+func (w Workspace) Personal() bool {
+	return w.PersonalOwnerID != nil
+}
+
+func (w Workspace) MarshalJSON() ([]byte, error) {
+	type workspace Workspace
+	return json.Marshal(struct {
+		workspace
+		Personal bool `json:"personal"`
+	}{workspace(w), w.Personal()})
+}
+
+// WorkspaceBaseCurrency is the currency a workspace's amounts default to. A
+// workspace that cannot be read falls back to DefaultCurrency.
+func WorkspaceBaseCurrency(db *gorm.DB, workspaceID uint) string {
+	var workspace Workspace
+	if err := db.Select("base_currency").First(&workspace, workspaceID).Error; err != nil || workspace.BaseCurrency == "" {
+		return DefaultCurrency
+	}
+	return workspace.BaseCurrency
+}
+
+// WorkspaceMember grants UserID one of the auth workspace roles.
+type WorkspaceMember struct {
+	WorkspaceID uint       `json:"workspace_id" gorm:"primaryKey;autoIncrement:false"`
+	UserID      uint       `json:"user_id" gorm:"primaryKey;autoIncrement:false;index"`
+	Role        string     `json:"role" gorm:"size:16;not null"`
+	Workspace   *Workspace `json:"workspace,omitempty"`
+	User        *User      `json:"user,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+// WorkspaceInvitation offers Role in a workspace to whoever verifies Email.
+type WorkspaceInvitation struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	WorkspaceID uint       `json:"workspace_id" gorm:"not null;index"`
+	Workspace   *Workspace `json:"workspace,omitempty"`
+	Email       string     `json:"email" gorm:"not null;index"`
+	Role        string     `json:"role" gorm:"size:16;not null"`
+	InvitedByID uint       `json:"invited_by_id" gorm:"not null"`
+	Status      string     `json:"status" gorm:"size:16;not null;index"`
+	ExpiresAt   time.Time  `json:"expires_at" gorm:"not null"`
+	RespondedAt *time.Time `json:"responded_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+type WorkspaceRequest struct {
+	Name         string `json:"name" binding:"required,max=100"`
+	BaseCurrency string `json:"base_currency"`
+}
+
+type UpdateWorkspaceRequest struct {
+	Name         *string `json:"name" binding:"omitempty,min=1,max=100"`
+	BaseCurrency *string `json:"base_currency"`
+}
+
+type InvitationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required,oneof=editor viewer"`
+}
+
+type MemberRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=editor viewer"`
+}
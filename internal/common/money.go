@@ -0,0 +1,423 @@
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+const DefaultCurrency = "USD"
+
+var (
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrInvalidAmount    = errors.New("invalid amount")
+)
+
+// currencyExponents lists currencies whose minor unit is not 1/100.
+var currencyExponents = map[string]int{
+	"BHD": 3,
+	"CLP": 0,
+	"IQD": 3,
+	"ISK": 0,
+	"JOD": 3,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"LYD": 3,
+	"OMR": 3,
+	"TND": 3,
+	"VND": 0,
+}
+
+// Money is a fixed-point amount held as integer minor units of Currency
+// (cents for USD, yen for JPY). It is stored as two columns when embedded
+// and encoded in JSON as an exact decimal number such as 12.34.
+type Money struct {
+	Minor    int64  `gorm:"column:minor;not null;default:0"`
+	Currency string `gorm:"column:currency;size:3;not null;default:USD"`
+}
+
+func NewMoney(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: normalizeCurrency(currency)}
+}
+
+func Zero(currency string) Money {
+	return NewMoney(0, currency)
+}
+
+// ParseMoney parses a decimal string like "12.34" or "-5" into minor units of
+// currency. More fractional digits than the currency allows is an error.
+func ParseMoney(s string, currency string) (Money, error) {
+	currency = normalizeCurrency(currency)
+	exp := CurrencyExponent(currency)
+
+	minor, err := ParseMinorUnits(s, exp)
+	if err != nil {
+		return Money{}, fmt.Errorf("%w (%s)", err, currency)
+	}
+
+	return Money{Minor: minor, Currency: currency}, nil
+}
+
+// ParseMinorUnits parses a decimal string into an integer scaled by
+// 10^exp, rejecting values that need more fractional digits.
+func ParseMinorUnits(s string, exp int) (int64, error) {
+	s = strings.TrimSpace(s)
+	negative := false
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		negative = s[0] == '-'
+		s = s[1:]
+	}
+
+	whole, frac, _ := strings.Cut(s, ".")
+	if whole == "" && frac == "" {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+	if len(frac) > exp {
+		trimmed := strings.TrimRight(frac, "0")
+		if len(trimmed) > exp {
+			return 0, fmt.Errorf("%w: at most %d decimal places allowed", ErrInvalidAmount, exp)
+		}
+		frac = trimmed
+	}
+	frac += strings.Repeat("0", exp-len(frac))
+
+	var minor int64
+	for _, r := range whole + frac {
+		if r < '0' || r > '9' {
+			return 0, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+		}
+		if minor > (math.MaxInt64-int64(r-'0'))/10 {
+			return 0, fmt.Errorf("%w: %q is out of range", ErrInvalidAmount, s)
+		}
+		minor = minor*10 + int64(r-'0')
+	}
+	if negative {
+		minor = -minor
+	}
+
+	return minor, nil
+}
+
+// MustParseMoney is like ParseMoney but panics on error. Intended for
+// constants and tests.
+func MustParseMoney(s string, currency string) Money {
+	m, err := ParseMoney(s, currency)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// CurrencyExponent returns the number of minor-unit digits for an ISO 4217 code.
+func CurrencyExponent(currency string) int {
+	if exp, ok := currencyExponents[normalizeCurrency(currency)]; ok {
+		return exp
+	}
+	return 2
+}
+
+// CurrencyExponents returns every currency whose exponent differs from the
+// default of 2.
+func CurrencyExponents() map[string]int {
+	exponents := make(map[string]int, len(currencyExponents))
+	for code, exp := range currencyExponents {
+		exponents[code] = exp
+	}
+	return exponents
+}
+
+// IsCurrencyCode reports whether s looks like an ISO 4217 code.
+func IsCurrencyCode(s string) bool {
+	if len(s) != 3 {
+		return false
+	}
+	for _, r := range s {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+func normalizeCurrency(currency string) string {
+	currency = strings.ToUpper(strings.TrimSpace(currency))
+	if currency == "" {
+		return DefaultCurrency
+	}
+	return currency
+}
+
+func (m Money) String() string {
+	exp := CurrencyExponent(m.Currency)
+	minor := m.Minor
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+	}
+
+	digits := fmt.Sprintf("%d", minor)
+	digits = strings.TrimPrefix(digits, "-")
+	if exp == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exp {
+		digits = strings.Repeat("0", exp-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+}
+
+// Float64 is for display and ratios only; never feed it back into arithmetic.
+func (m Money) Float64() float64 {
+	return float64(m.Minor) / math.Pow10(CurrencyExponent(m.Currency))
+}
+
+func (m Money) IsZero() bool {
+	return m.Minor == 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.Minor > 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Minor < 0
+}
+
+func (m Money) Neg() Money {
+	return Money{Minor: -m.Minor, Currency: m.Currency}
+}
+
+// Add returns m+o. A zero value without a currency adopts the other operand's
+// currency so sums can start from Money{}.
+func (m Money) Add(o Money) (Money, error) {
+	currency, err := sameCurrency(m, o)
+	if err != nil {
+		return Money{}, err
+	}
+	if (o.Minor > 0 && m.Minor > math.MaxInt64-o.Minor) || (o.Minor < 0 && m.Minor < math.MinInt64-o.Minor) {
+		return Money{}, fmt.Errorf("%w: overflow", ErrInvalidAmount)
+	}
+	return Money{Minor: m.Minor + o.Minor, Currency: currency}, nil
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+	return m.Add(o.Neg())
+}
+
+// Cmp returns -1, 0 or +1 comparing m to o.
+func (m Money) Cmp(o Money) (int, error) {
+	if _, err := sameCurrency(m, o); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.Minor < o.Minor:
+		return -1, nil
+	case m.Minor > o.Minor:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// In returns the same amount expressed in another currency's minor units. It
+// only rescales, it does not convert; it fails if precision would be lost.
+func (m Money) In(currency string) (Money, error) {
+	currency = normalizeCurrency(currency)
+	from, to := CurrencyExponent(m.Currency), CurrencyExponent(currency)
+	minor := m.Minor
+	for ; from < to; from++ {
+		minor *= 10
+	}
+	for ; from > to; from-- {
+		if minor%10 != 0 {
+			return Money{}, fmt.Errorf("%w: %s allows at most %d decimal places", ErrInvalidAmount, currency, to)
+		}
+		minor /= 10
+	}
+	return Money{Minor: minor, Currency: currency}, nil
+}
+
+// Convert multiplies m by rate (units of currency per unit of m.Currency) and
+// rounds half away from zero to currency's minor units.
+func (m Money) Convert(rate *big.Rat, currency string) Money {
+	currency = normalizeCurrency(currency)
+	v := new(big.Rat).SetInt64(m.Minor)
+	v.Mul(v, rate)
+
+	shift := CurrencyExponent(currency) - CurrencyExponent(m.Currency)
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(shift))), nil))
+	if shift >= 0 {
+		v.Mul(v, scale)
+	} else {
+		v.Quo(v, scale)
+	}
+
+	q, r := new(big.Int).QuoRem(v.Num(), v.Denom(), new(big.Int))
+	if r.Sign() != 0 && new(big.Int).Mul(new(big.Int).Abs(r), big.NewInt(2)).Cmp(v.Denom()) >= 0 {
+		q.Add(q, big.NewInt(int64(r.Sign())))
+	}
+	return Money{Minor: q.Int64(), Currency: currency}
+}
+
+// Split divides m into n parts that differ by at most one minor unit and sum
+// back to m exactly. Earlier parts receive the remainder.
+func (m Money) Split(n int) ([]Money, error) {
+	if n <= 0 {
+		return nil, errors.New("split count must be positive")
+	}
+	weights := make([]int64, n)
+	for i := range weights {
+		weights[i] = 1
+	}
+	return m.Allocate(weights...)
+}
+
+// Allocate divides m proportionally to weights using the largest remainder
+// method, so the parts always sum back to m exactly.
+func (m Money) Allocate(weights ...int64) ([]Money, error) {
+	var total int64
+	for _, w := range weights {
+		if w < 0 {
+			return nil, errors.New("allocation weights must not be negative")
+		}
+		total += w
+	}
+	if total == 0 {
+		return nil, errors.New("allocation weights must not all be zero")
+	}
+
+	magnitude := m.Minor
+	if magnitude < 0 {
+		magnitude = -magnitude
+	}
+
+	parts := make([]Money, len(weights))
+	remainders := make([]int64, len(weights))
+	var allocated int64
+	for i, w := range weights {
+		share, rem := mulDiv(magnitude, w, total)
+		parts[i] = Money{Minor: share, Currency: m.Currency}
+		remainders[i] = rem
+		allocated += share
+	}
+
+	for left := magnitude - allocated; left > 0; left-- {
+		best := -1
+		for i, rem := range remainders {
+			if weights[i] > 0 && (best == -1 || rem > remainders[best]) {
+				best = i
+			}
+		}
+		parts[best].Minor++
+		remainders[best] = -1
+	}
+
+	if m.Minor < 0 {
+		for i := range parts {
+			parts[i].Minor = -parts[i].Minor
+		}
+	}
+	return parts, nil
+}
+
+// Sum adds amounts that must all share one currency. An empty list yields
+// zero in DefaultCurrency.
+func Sum(amounts ...Money) (Money, error) {
+	var total Money
+	for _, a := range amounts {
+		var err error
+		if total, err = total.Add(a); err != nil {
+			return Money{}, err
+		}
+	}
+	if total.Currency == "" {
+		total.Currency = DefaultCurrency
+	}
+	return total, nil
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON accepts both 12.34 and "12.34". The amount is read in the
+// receiver's currency when already set, otherwise in DefaultCurrency.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	s := string(data)
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	if strings.ContainsAny(s, "eE") {
+		return fmt.Errorf("%w: exponent notation is not supported", ErrInvalidAmount)
+	}
+
+	parsed, err := ParseMoney(s, m.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Amount is a decimal amount as sent in a request, before its currency is
+// known. It accepts both 12.34 and "12.34"; In parses it once the currency
+// is resolved, so 1.234 KWD and 500 JPY keep their own scale.
+type Amount string
+
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*a = ""
+		return nil
+	}
+	s := string(data)
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	if strings.ContainsAny(s, "eE") {
+		return fmt.Errorf("%w: exponent notation is not supported", ErrInvalidAmount)
+	}
+	*a = Amount(strings.TrimSpace(s))
+	return nil
+}
+
+// In parses the amount in currency. An empty amount is zero.
+func (a Amount) In(currency string) (Money, error) {
+	if a == "" {
+		return Zero(currency), nil
+	}
+	return ParseMoney(string(a), currency)
+}
+
+func sameCurrency(a, b Money) (string, error) {
+	switch {
+	case a.Currency == b.Currency:
+		return a.Currency, nil
+	case a.Currency == "" && a.Minor == 0:
+		return b.Currency, nil
+	case b.Currency == "" && b.Minor == 0:
+		return a.Currency, nil
+	}
+	return "", fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, a.Currency, b.Currency)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// mulDiv returns a*b/c and the remainder without overflowing for realistic
+// amounts and weights.
+func mulDiv(a, b, c int64) (int64, int64) {
+	q, r := a/c, a%c
+	return q*b + (r*b)/c, (r * b) % c
+}
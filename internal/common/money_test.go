@@ -0,0 +1,139 @@
+package common
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestParseMoney(t *testing.T) {
+	cases := []struct {
+		in       string
+		currency string
+		minor    int64
+		wantErr  bool
+	}{
+		{"12.34", "USD", 1234, false},
+		{"-0.05", "USD", -5, false},
+		{"7", "EUR", 700, false},
+		{"1.50", "JPY", 0, true},
+		{"1500", "JPY", 1500, false},
+		{"1.234", "KWD", 1234, false},
+		{"1.234", "USD", 0, true},
+		{"1.230", "USD", 123, false},
+		{"abc", "USD", 0, true},
+		{"", "USD", 0, true},
+	}
+
+	for _, tc := range cases {
+		m, err := ParseMoney(tc.in, tc.currency)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseMoney(%q, %s): expected error, got %v", tc.in, tc.currency, m)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseMoney(%q, %s): unexpected error %v", tc.in, tc.currency, err)
+			continue
+		}
+		if m.Minor != tc.minor {
+			t.Errorf("ParseMoney(%q, %s): expected %d minor units, got %d", tc.in, tc.currency, tc.minor, m.Minor)
+		}
+	}
+}
+
+func TestMoney_JSON(t *testing.T) {
+	var fromNumber, fromString Money
+	if err := json.Unmarshal([]byte(`12.34`), &fromNumber); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := json.Unmarshal([]byte(`"12.34"`), &fromString); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if fromNumber != fromString || fromNumber.Minor != 1234 {
+		t.Errorf("Expected both encodings to give 1234 minor units, got %v and %v", fromNumber, fromString)
+	}
+
+	out, _ := json.Marshal(NewMoney(-5, "USD"))
+	if string(out) != "-0.05" {
+		t.Errorf("Expected -0.05, got %s", out)
+	}
+}
+
+func TestMoney_SumDoesNotDrift(t *testing.T) {
+	amounts := make([]Money, 1000)
+	for i := range amounts {
+		amounts[i] = MustParseMoney("0.10", "USD")
+	}
+
+	total, err := Sum(amounts...)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if total.String() != "100.00" {
+		t.Errorf("Expected 100.00, got %s", total)
+	}
+
+	if _, err := Sum(NewMoney(1, "USD"), NewMoney(1, "EUR")); err == nil {
+		t.Error("Expected currency mismatch error")
+	}
+}
+
+func TestMoney_SplitAndAllocate(t *testing.T) {
+	parts, err := MustParseMoney("100.00", "USD").Split(3)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	want := []int64{3334, 3333, 3333}
+	for i, p := range parts {
+		if p.Minor != want[i] {
+			t.Errorf("Part %d: expected %d, got %d", i, want[i], p.Minor)
+		}
+	}
+
+	parts, _ = NewMoney(-1001, "USD").Allocate(1, 1)
+	total, _ := Sum(parts...)
+	if total.Minor != -1001 {
+		t.Errorf("Expected allocation to sum back to -1001, got %d", total.Minor)
+	}
+}
+
+type legacyExpense struct {
+	ID       uint    `gorm:"primaryKey"`
+	UserID   uint    `gorm:"not null"`
+	Amount   float64 `gorm:"not null"`
+	Category string  `gorm:"not null"`
+	Date     time.Time
+}
+
+func (legacyExpense) TableName() string {
+	return "expenses"
+}
+
+func TestMigrateExpenseAmounts(t *testing.T) {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&legacyExpense{})
+	db.Create(&[]legacyExpense{
+		{UserID: 1, Amount: 19.99, Category: "Food", Date: time.Now()},
+		{UserID: 1, Amount: 0.07, Category: "Food", Date: time.Now()},
+	})
+
+	if err := db.AutoMigrate(&Expense{}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := MigrateExpenseAmounts(db); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var expenses []Expense
+	db.Order("id").Find(&expenses)
+	if len(expenses) != 2 || expenses[0].Amount.Minor != 1999 || expenses[1].Amount.Minor != 7 {
+		t.Errorf("Expected 1999 and 7 minor units, got %+v", expenses)
+	}
+	if db.Migrator().HasColumn(&Expense{}, "amount") {
+		t.Error("Expected legacy amount column to be dropped")
+	}
+}
@@ -0,0 +1,85 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+	"gorm.io/gorm"
+)
+
+var ErrRateNotFound = errors.New("exchange rate not found")
+
+// ExchangeRateOn returns the units of quote per unit of base using the most
+// recent rate on or before date, falling back to the inverse pair.
+func ExchangeRateOn(db *gorm.DB, base, quote string, date time.Time) (*big.Rat, error) {
+	if base == quote {
+		return big.NewRat(1, 1), nil
+	}
+
+	var rate ExchangeRate
+	err := db.Where("base = ? AND quote = ? AND date <= ?", base, quote, date).
+		Order("date DESC").
+		First(&rate).Error
+	if err == nil {
+		return parseRate(rate.Rate)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	err = db.Where("base = ? AND quote = ? AND date <= ?", quote, base, date).
+		Order("date DESC").
+		First(&rate).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %s/%s on %s", ErrRateNotFound, base, quote, date.Format("2006-01-02"))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	inverse, err := parseRate(rate.Rate)
+	if err != nil {
+		return nil, err
+	}
+	return inverse.Inv(inverse), nil
+}
+
+func parseRate(s string) (*big.Rat, error) {
+	rate, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok || rate.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid stored exchange rate %q", s)
+	}
+	return rate, nil
+}
+
+// Converter converts amounts between currencies at historical rates,
+// memoising each rate it looks up. It is not safe for concurrent use.
+type Converter struct {
+	db    *gorm.DB
+	rates map[string]*big.Rat
+}
+
+func NewConverter(db *gorm.DB) *Converter {
+	return &Converter{db: db, rates: make(map[string]*big.Rat)}
+}
+
+// Convert returns amount in currency using the rate for date.
+func (c *Converter) Convert(amount Money, currency string, date time.Time) (Money, error) {
+	if amount.Currency == currency {
+		return amount, nil
+	}
+
+	key := amount.Currency + currency + date.Format("2006-01-02")
+	rate, ok := c.rates[key]
+	if !ok {
+		var err error
+		if rate, err = ExchangeRateOn(c.db, amount.Currency, currency, date); err != nil {
+			return Money{}, err
+		}
+		c.rates[key] = rate
+	}
+
+	return amount.Convert(rate, currency), nil
+}
@@ -0,0 +1,29 @@
+package common
+
+import (
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BumpExpenseVersion records a write to workspaceID's expenses.
+func BumpExpenseVersion(db *gorm.DB, workspaceID uint) error {
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "workspace_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"version":    gorm.Expr("expense_versions.version + 1"),
+			"updated_at": gorm.Expr("excluded.updated_at"),
+		}),
+	}).Create(&ExpenseVersion{WorkspaceID: workspaceID, Version: 1}).Error
+}
+
+// ExpenseVersionOf returns the current version of workspaceID's expenses, 0
+// if they have never changed.
+func ExpenseVersionOf(db *gorm.DB, workspaceID uint) (int64, error) {
+	var version ExpenseVersion
+	err := db.Where("workspace_id = ?", workspaceID).First(&version).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	return version.Version, err
+}
@@ -0,0 +1,265 @@
+package expense
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+	"fintrack/internal/common"
+	"fintrack/pkg/storage"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// maxAttachments caps the files kept with one expense.
+const maxAttachments = 10
+
+var (
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	ErrNoThumbnail        = errors.New("attachment has no thumbnail")
+	ErrAttachmentTooLarge = errors.New("attachment is too large")
+	ErrUnsupportedMedia   = errors.New("attachments must be JPEG, PNG, GIF or WebP images or PDF documents")
+	ErrTooManyAttachments = fmt.Errorf("an expense can have at most %d attachments", maxAttachments)
+)
+
+// attachmentTypes maps the accepted content types, as sniffed from the
+// file itself, to the extension used when a file name is missing.
+var attachmentTypes = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+// AttachmentService keeps receipts and other files with expenses. It is a
+// ChangeListener so that deleting an expense deletes its files; Sweep
+// removes files whose expense went away by other means.
+type AttachmentService struct {
+	db      *gorm.DB
+	store   storage.BlobStore
+	maxSize int64
+	logger  *zap.Logger
+}
+
+func NewAttachmentService(db *gorm.DB, store storage.BlobStore, maxSize int64, logger *zap.Logger) *AttachmentService {
+	return &AttachmentService{
+		db:      db,
+		store:   store,
+		maxSize: maxSize,
+		logger:  logger,
+	}
+}
+
+// Upload stores the content of r as an attachment of the workspace's expense.
+// The content type is detected from the content; the name is only kept for
+// downloads.
+func (s *AttachmentService) Upload(ctx context.Context, workspaceID, expenseID, userID uint, fileName string, r io.Reader) (*common.Attachment, error) {
+	if err := s.db.Select("id").Where("id = ? AND workspace_id = ?", expenseID, workspaceID).First(&common.Expense{}).Error; err != nil {
+		return nil, err
+	}
+	var count int64
+	if err := s.db.Model(&common.Attachment{}).Where("expense_id = ?", expenseID).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count >= maxAttachments {
+		return nil, ErrTooManyAttachments
+	}
+
+	data, err := io.ReadAll(io.LimitReader(r, s.maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > s.maxSize {
+		return nil, ErrAttachmentTooLarge
+	}
+	contentType := http.DetectContentType(data)
+	extension, ok := attachmentTypes[contentType]
+	if !ok || len(data) == 0 {
+		return nil, ErrUnsupportedMedia
+	}
+
+	prefix, err := blobPrefix(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	attachment := common.Attachment{
+		WorkspaceID: workspaceID,
+		ExpenseID:   expenseID,
+		UserID:      userID,
+		FileName:    cleanFileName(fileName, extension),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		BlobKey:     prefix + extension,
+	}
+
+	if err := s.store.Put(ctx, attachment.BlobKey, bytes.NewReader(data), attachment.Size, contentType); err != nil {
+		return nil, err
+	}
+	// A receipt is still useful without a preview, e.g. a WebP image or a
+	// corrupt JPEG, so thumbnail failures are not fatal.
+	if thumb, err := thumbnail(data); err == nil {
+		key := prefix + ".thumb.jpg"
+		if err := s.store.Put(ctx, key, bytes.NewReader(thumb), int64(len(thumb)), "image/jpeg"); err != nil {
+			s.deleteBlobs(ctx, attachment)
+			return nil, err
+		}
+		attachment.ThumbnailKey = key
+	}
+
+	if err := s.db.Create(&attachment).Error; err != nil {
+		s.deleteBlobs(ctx, attachment)
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+func (s *AttachmentService) List(workspaceID, expenseID uint) ([]common.Attachment, error) {
+	attachments := []common.Attachment{}
+	err := s.db.Where("workspace_id = ? AND expense_id = ?", workspaceID, expenseID).Order("id").Find(&attachments).Error
+	return attachments, err
+}
+
+func (s *AttachmentService) Get(workspaceID, expenseID, attachmentID uint) (*common.Attachment, error) {
+	var attachment common.Attachment
+	err := s.db.Where("id = ? AND workspace_id = ? AND expense_id = ?", attachmentID, workspaceID, expenseID).First(&attachment).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// Open returns the attachment and its content, or its thumbnail when
+// thumbnail is set. The caller closes the reader.
+func (s *AttachmentService) Open(ctx context.Context, workspaceID, expenseID, attachmentID uint, thumbnail bool) (*common.Attachment, io.ReadCloser, error) {
+	attachment, err := s.Get(workspaceID, expenseID, attachmentID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	key := attachment.BlobKey
+	if thumbnail {
+		if attachment.ThumbnailKey == "" {
+			return nil, nil, ErrNoThumbnail
+		}
+		key = attachment.ThumbnailKey
+	}
+	content, err := s.store.Get(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return attachment, content, nil
+}
+
+func (s *AttachmentService) Delete(ctx context.Context, workspaceID, expenseID, attachmentID uint) error {
+	attachment, err := s.Get(workspaceID, expenseID, attachmentID)
+	if err != nil {
+		return err
+	}
+	return s.remove(ctx, *attachment)
+}
+
+// ExpenseChanged deletes the attachments of a deleted expense. Failures are
+// only logged; Sweep retries them.
+func (s *AttachmentService) ExpenseChanged(userID uint, before, after *common.Expense) {
+	if after != nil || before == nil {
+		return
+	}
+
+	var attachments []common.Attachment
+	if err := s.db.Where("expense_id = ?", before.ID).Find(&attachments).Error; err != nil {
+		s.logger.Error("Failed to find attachments of deleted expense", zap.Uint("expense_id", before.ID), zap.Error(err))
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	for _, attachment := range attachments {
+		if err := s.remove(ctx, attachment); err != nil {
+			s.logger.Error("Failed to delete attachment", zap.Uint("attachment_id", attachment.ID), zap.Error(err))
+		}
+	}
+}
+
+// Sweep deletes attachments whose expense no longer exists, such as those of
+// deleted workspaces, and returns how many it removed.
+func (s *AttachmentService) Sweep(ctx context.Context) (int, error) {
+	var orphans []common.Attachment
+	err := s.db.Where("expense_id NOT IN (?)", s.db.Model(&common.Expense{}).Select("id")).Find(&orphans).Error
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, attachment := range orphans {
+		if err := s.remove(ctx, attachment); err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// remove deletes the blobs before the row, so a failure leaves the row for
+// Sweep to retry rather than a blob nothing refers to.
+func (s *AttachmentService) remove(ctx context.Context, attachment common.Attachment) error {
+	for _, key := range []string{attachment.ThumbnailKey, attachment.BlobKey} {
+		if key == "" {
+			continue
+		}
+		if err := s.store.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return s.db.Delete(&attachment).Error
+}
+
+// deleteBlobs cleans up after a failed upload.
+func (s *AttachmentService) deleteBlobs(ctx context.Context, attachment common.Attachment) {
+	for _, key := range []string{attachment.BlobKey, attachment.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if err := s.store.Delete(ctx, key); err != nil {
+			s.logger.Error("Failed to delete blob of failed upload", zap.String("key", key), zap.Error(err))
+		}
+	}
+}
+
+// blobPrefix returns a new unguessable key prefix within the workspace.
+func blobPrefix(workspaceID uint) (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("workspaces/%d/attachments/%s", workspaceID, hex.EncodeToString(id)), nil
+}
+
+// cleanFileName keeps the base name of an uploaded file without control
+// characters, falling back to "receipt" with the detected extension.
+func cleanFileName(name, extension string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, `\`, "/")))
+	if name == "" || name == "." || name == "/" {
+		return "receipt" + extension
+	}
+	if runes := []rune(name); len(runes) > 255 {
+		name = string(runes[:255])
+	}
+	return name
+}
@@ -0,0 +1,51 @@
+package expense
+
+import (
+	"time"
+	"fintrack/internal/common"
+	"fintrack/pkg/export"
+)
+
+var exportHeader = []interface{}{"id", "date", "amount", "currency", "category", "description", "recurring_expense_id", "created_at"}
+
+// ExportExpenses writes every expense matching filter to w, one row at a time
+// from the database cursor. Paging options in filter are ignored.
+func (s *Service) ExportExpenses(workspaceID uint, filter ListFilter, w export.Writer) error {
+	rows, err := filter.apply(s.db.Model(&common.Expense{}).Where("workspace_id = ?", workspaceID)).
+		Order(filter.order()).
+		Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if err := w.Write(exportHeader); err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var expense common.Expense
+		if err := s.db.ScanRows(rows, &expense); err != nil {
+			return err
+		}
+
+		var recurring interface{}
+		if expense.RecurringExpenseID != nil {
+			recurring = *expense.RecurringExpenseID
+		}
+		err := w.Write([]interface{}{
+			expense.ID,
+			expense.Date.Format("2006-01-02"),
+			export.Number(expense.Amount.String()),
+			expense.Amount.Currency,
+			expense.Category,
+			expense.Description,
+			recurring,
+			expense.CreatedAt.UTC().Format(time.RFC3339),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
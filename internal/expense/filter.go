@@ -0,0 +1,308 @@
+package expense
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"fintrack/internal/category"
+	"fintrack/internal/common"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultLimit = 10
+	maxLimit     = 100
+
+	// amountScale is the largest currency exponent; amounts are compared after
+	// scaling every currency up to it so 12.50 USD and 12.500 KWD sort alike.
+	amountScale = 3
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListFilter narrows and orders an expense listing. The zero value lists the
+// newest expenses first.
+type ListFilter struct {
+	From        *time.Time
+	To          *time.Time
+	Categories  []string
+	Tags        []string
+	MinAmount   *int64
+	MaxAmount   *int64
+	Description string
+	SortField   string
+	SortDesc    bool
+	Limit       int
+	Offset      int
+	Cursor      string
+}
+
+type ListResult struct {
+	Expenses   []common.Expense `json:"expenses"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+	Total      int64            `json:"total"`
+}
+
+type cursor struct {
+	Sort string          `json:"s"`
+	ID   uint            `json:"id"`
+	Val  json.RawMessage `json:"v"`
+}
+
+var sortColumns = map[string]string{
+	"date":       "date",
+	"created_at": "created_at",
+	"category":   "category",
+	"amount":     amountExpr(),
+}
+
+// ParseListFilter reads list options from query parameters: from, to
+// (YYYY-MM-DD, inclusive), category and tag (repeatable or comma separated),
+// min_amount, max_amount, description, sort, order, limit, offset and cursor.
+func ParseListFilter(query url.Values) (ListFilter, error) {
+	filter := ListFilter{SortField: "date", SortDesc: true}
+
+	for _, param := range []string{"from", "to"} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		date, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s date %q", param, value)
+		}
+		if param == "from" {
+			filter.From = &date
+		} else {
+			filter.To = &date
+		}
+	}
+
+	for _, value := range query["category"] {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				filter.Categories = append(filter.Categories, name)
+			}
+		}
+	}
+	for _, value := range query["tag"] {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				filter.Tags = append(filter.Tags, name)
+			}
+		}
+	}
+
+	for _, param := range []string{"min_amount", "max_amount"} {
+		value := query.Get(param)
+		if value == "" {
+			continue
+		}
+		amount, err := common.ParseMinorUnits(value, amountScale)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s: %w", param, err)
+		}
+		if param == "min_amount" {
+			filter.MinAmount = &amount
+		} else {
+			filter.MaxAmount = &amount
+		}
+	}
+
+	filter.Description = strings.TrimSpace(query.Get("description"))
+
+	if field := query.Get("sort"); field != "" {
+		if _, ok := sortColumns[field]; !ok {
+			return filter, fmt.Errorf("invalid sort field %q", field)
+		}
+		filter.SortField = field
+	}
+	switch strings.ToLower(query.Get("order")) {
+	case "", "desc":
+	case "asc":
+		filter.SortDesc = false
+	default:
+		return filter, fmt.Errorf("invalid order %q", query.Get("order"))
+	}
+
+	var err error
+	if value := query.Get("limit"); value != "" {
+		if filter.Limit, err = strconv.Atoi(value); err != nil {
+			return filter, fmt.Errorf("invalid limit %q", value)
+		}
+	}
+	if value := query.Get("offset"); value != "" {
+		if filter.Offset, err = strconv.Atoi(value); err != nil || filter.Offset < 0 {
+			return filter, fmt.Errorf("invalid offset %q", value)
+		}
+	}
+	filter.Cursor = query.Get("cursor")
+
+	return filter, nil
+}
+
+// apply adds the WHERE conditions of f, but not ordering or paging.
+func (f ListFilter) apply(db *gorm.DB) *gorm.DB {
+	if f.From != nil {
+		db = db.Where("date >= ?", *f.From)
+	}
+	if f.To != nil {
+		db = db.Where("date < ?", f.To.AddDate(0, 0, 1))
+	}
+	if len(f.Categories) > 0 {
+		keys := make([]string, len(f.Categories))
+		for i, name := range f.Categories {
+			keys[i] = strings.ToLower(category.Normalize(name))
+		}
+		db = db.Where("LOWER(category) IN ?", keys)
+	}
+	if len(f.Tags) > 0 {
+		keys := make([]string, len(f.Tags))
+		for i, name := range f.Tags {
+			keys[i] = strings.ToLower(category.Normalize(name))
+		}
+		// Expenses carrying any of the tags.
+		db = db.Where("id IN (SELECT expense_tags.expense_id FROM expense_tags JOIN tags ON tags.id = expense_tags.tag_id WHERE tags.name_key IN ?)", keys)
+	}
+	if f.MinAmount != nil {
+		db = db.Where(amountExpr()+" >= ?", *f.MinAmount)
+	}
+	if f.MaxAmount != nil {
+		db = db.Where(amountExpr()+" <= ?", *f.MaxAmount)
+	}
+	if f.Description != "" {
+		db = db.Where("LOWER(description) LIKE ? ESCAPE '\\'", "%"+escapeLike(strings.ToLower(f.Description))+"%")
+	}
+	return db
+}
+
+func (f ListFilter) sortKey() string {
+	field := f.SortField
+	if _, ok := sortColumns[field]; !ok {
+		field = "date"
+	}
+	if f.SortDesc {
+		return field + ":desc"
+	}
+	return field + ":asc"
+}
+
+func (f ListFilter) order() string {
+	column, direction := sortColumns[strings.Split(f.sortKey(), ":")[0]], "ASC"
+	if f.SortDesc {
+		direction = "DESC"
+	}
+	return fmt.Sprintf("%s %s, id %s", column, direction, direction)
+}
+
+func (f ListFilter) limit() int {
+	switch {
+	case f.Limit <= 0:
+		return defaultLimit
+	case f.Limit > maxLimit:
+		return maxLimit
+	}
+	return f.Limit
+}
+
+// after restricts db to rows strictly past the cursor position.
+func (f ListFilter) after(db *gorm.DB) (*gorm.DB, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(f.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.Sort != f.sortKey() {
+		return nil, ErrInvalidCursor
+	}
+
+	field := strings.Split(c.Sort, ":")[0]
+	var value interface{}
+	switch field {
+	case "date", "created_at":
+		var t time.Time
+		err = json.Unmarshal(c.Val, &t)
+		value = t
+	case "amount":
+		var n int64
+		err = json.Unmarshal(c.Val, &n)
+		value = n
+	default:
+		var s string
+		err = json.Unmarshal(c.Val, &s)
+		value = s
+	}
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	column, op := sortColumns[field], ">"
+	if f.SortDesc {
+		op = "<"
+	}
+	return db.Where(fmt.Sprintf("(%s %s ?) OR (%s = ? AND id %s ?)", column, op, column, op), value, value, c.ID), nil
+}
+
+func (f ListFilter) cursorFor(expense common.Expense) string {
+	var value interface{}
+	switch strings.Split(f.sortKey(), ":")[0] {
+	case "date":
+		value = expense.Date
+	case "created_at":
+		value = expense.CreatedAt
+	case "amount":
+		value = scaledAmount(expense.Amount)
+	default:
+		value = expense.Category
+	}
+
+	val, _ := json.Marshal(value)
+	raw, _ := json.Marshal(cursor{Sort: f.sortKey(), ID: expense.ID, Val: val})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// amountExpr is the SQL form of scaledAmount.
+func amountExpr() string {
+	byExponent := make(map[int][]string)
+	for code, exp := range common.CurrencyExponents() {
+		byExponent[exp] = append(byExponent[exp], "'"+code+"'")
+	}
+
+	exponents := make([]int, 0, len(byExponent))
+	for exp := range byExponent {
+		exponents = append(exponents, exp)
+	}
+	sort.Ints(exponents)
+
+	var b strings.Builder
+	b.WriteString("(CASE")
+	for _, exp := range exponents {
+		codes := byExponent[exp]
+		sort.Strings(codes)
+		fmt.Fprintf(&b, " WHEN amount_currency IN (%s) THEN amount_minor * %d", strings.Join(codes, ", "), pow10(amountScale-exp))
+	}
+	fmt.Fprintf(&b, " ELSE amount_minor * %d END)", pow10(amountScale-2))
+	return b.String()
+}
+
+func scaledAmount(m common.Money) int64 {
+	return m.Minor * pow10(amountScale-common.CurrencyExponent(m.Currency))
+}
+
+func pow10(n int) int64 {
+	result := int64(1)
+	for ; n > 0; n-- {
+		result *= 10
+	}
+	return result
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
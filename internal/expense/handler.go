@@ -1,11 +1,17 @@
 package expense
 
 import (
+	"errors"
+	"io"
+	"mime"
 	"net/http"
 	"strconv"
 	"fintrack/internal/common"
+	"fintrack/pkg/export"
+	"fintrack/pkg/storage"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 type Handler struct {
@@ -21,6 +27,7 @@ func NewHandler(service *Service, logger *zap.Logger) *Handler {
 }
 
 func (h *Handler) CreateExpense(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
 	userID := c.GetUint("user_id")
 	
 	var req common.ExpenseRequest
@@ -29,7 +36,7 @@ func (h *Handler) CreateExpense(c *gin.Context) {
 		return
 	}
 
-	expense, err := h.service.CreateExpense(userID, req)
+	expense, err := h.service.CreateExpense(workspaceID, userID, req)
 	if err != nil {
 		h.logger.Error("Failed to create expense", zap.Error(err))
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -40,23 +47,113 @@ func (h *Handler) CreateExpense(c *gin.Context) {
 }
 
 func (h *Handler) GetExpenses(c *gin.Context) {
-	userID := c.GetUint("user_id")
-	
-	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
-	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	workspaceID := c.GetUint("workspace_id")
 
-	expenses, err := h.service.GetExpenses(userID, limit, offset)
+	filter, err := ParseListFilter(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.service.ListExpenses(workspaceID, filter)
+	if errors.Is(err, ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		h.logger.Error("Failed to get expenses", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"expenses": expenses})
+	c.JSON(http.StatusOK, result)
+}
+
+// GetTags suggests tags for autocompletion: ?q= narrows them by name and
+// ?limit= caps how many are returned.
+func (h *Handler) GetTags(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+
+	limit := 0
+	if value := c.Query("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+	}
+
+	tags, err := h.service.SuggestTags(workspaceID, c.Query("q"), limit)
+	if err != nil {
+		h.logger.Error("Failed to get tags", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tags": tags})
+}
+
+// SearchExpenses searches descriptions with ?q= and accepts the list filters
+// and offset paging.
+func (h *Handler) SearchExpenses(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+
+	filter, err := ParseListFilter(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	results, err := h.service.SearchExpenses(workspaceID, c.Query("q"), filter)
+	if errors.Is(err, ErrEmptyQuery) || errors.Is(err, ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to search expenses", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+func (h *Handler) ExportExpenses(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+
+	filter, err := ParseListFilter(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	format := c.DefaultQuery("format", export.FormatCSV)
+	if !export.Supported(format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": export.ErrUnsupportedFormat.Error()})
+		return
+	}
+
+	c.Header("Content-Type", export.ContentType(format))
+	c.Header("Content-Disposition", `attachment; filename="expenses.`+format+`"`)
+	c.Status(http.StatusOK)
+
+	w, err := export.NewWriter(format, c.Writer)
+	if err != nil {
+		h.logger.Error("Failed to export expenses", zap.Error(err))
+		return
+	}
+
+	if err := h.service.ExportExpenses(workspaceID, filter, w); err != nil {
+		h.logger.Error("Failed to export expenses", zap.Error(err))
+		return
+	}
+	if err := w.Close(); err != nil {
+		h.logger.Error("Failed to export expenses", zap.Error(err))
+	}
 }
 
 func (h *Handler) UpdateExpense(c *gin.Context) {
-	userID := c.GetUint("user_id")
+	workspaceID := c.GetUint("workspace_id")
 	expenseID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expense ID"})
@@ -69,7 +166,7 @@ func (h *Handler) UpdateExpense(c *gin.Context) {
 		return
 	}
 
-	expense, err := h.service.UpdateExpense(userID, uint(expenseID), req)
+	expense, err := h.service.UpdateExpense(workspaceID, uint(expenseID), req)
 	if err != nil {
 		h.logger.Error("Failed to update expense", zap.Error(err))
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -80,14 +177,14 @@ func (h *Handler) UpdateExpense(c *gin.Context) {
 }
 
 func (h *Handler) DeleteExpense(c *gin.Context) {
-	userID := c.GetUint("user_id")
+	workspaceID := c.GetUint("workspace_id")
 	expenseID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expense ID"})
 		return
 	}
 
-	if err := h.service.DeleteExpense(userID, uint(expenseID)); err != nil {
+	if err := h.service.DeleteExpense(workspaceID, uint(expenseID)); err != nil {
 		h.logger.Error("Failed to delete expense", zap.Error(err))
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -96,9 +193,697 @@ func (h *Handler) DeleteExpense(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Expense deleted successfully"})
 }
 
+func (h *Handler) CreateRecurringExpense(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	userID := c.GetUint("user_id")
+
+	var req common.RecurringExpenseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := h.service.CreateRecurringExpense(workspaceID, userID, req)
+	if err != nil {
+		h.logger.Error("Failed to create recurring expense", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (h *Handler) GetRecurringExpenses(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+
+	rules, err := h.service.GetRecurringExpenses(workspaceID)
+	if err != nil {
+		h.logger.Error("Failed to get recurring expenses", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recurring_expenses": rules})
+}
+
+func (h *Handler) GetRecurringExpense(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	ruleID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recurring expense ID"})
+		return
+	}
+
+	rule, err := h.service.GetRecurringExpense(workspaceID, uint(ruleID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Recurring expense not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to get recurring expense", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *Handler) UpdateRecurringExpense(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	ruleID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recurring expense ID"})
+		return
+	}
+
+	var req common.RecurringExpenseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := h.service.UpdateRecurringExpense(workspaceID, uint(ruleID), req)
+	if err != nil {
+		h.logger.Error("Failed to update recurring expense", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *Handler) DeleteRecurringExpense(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	ruleID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recurring expense ID"})
+		return
+	}
+
+	if err := h.service.DeleteRecurringExpense(workspaceID, uint(ruleID)); err != nil {
+		h.logger.Error("Failed to delete recurring expense", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Recurring expense deleted successfully"})
+}
+
+const (
+	// maxImportSize caps uploaded statements.
+	maxImportSize = 5 << 20
+
+	// multipartOverhead is the room an upload's multipart framing and other
+	// form fields get on top of the file itself.
+	multipartOverhead = 64 << 10
+)
+
+func (h *Handler) PreviewImport(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	userID := c.GetUint("user_id")
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize+multipartOverhead)
+	file, err := c.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Statement file is too large"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Statement file is required"})
+		return
+	}
+	if file.Size > maxImportSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Statement file is too large"})
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxImportSize))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	preview, err := h.service.PreviewImport(workspaceID, userID, file.Filename, c.PostForm("format"), data)
+	if err != nil {
+		h.logger.Error("Failed to preview import", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, preview)
+}
+
+func (h *Handler) GetImport(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	batchID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid import ID"})
+		return
+	}
+
+	preview, err := h.service.GetImportPreview(workspaceID, uint(batchID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to get import", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+func (h *Handler) CommitImport(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	userID := c.GetUint("user_id")
+	batchID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid import ID"})
+		return
+	}
+
+	var req struct {
+		Lines []int `json:"lines"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	expenses, err := h.service.CommitImport(workspaceID, userID, uint(batchID), req.Lines)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import not found"})
+		return
+	}
+	if errors.Is(err, ErrImportCommitted) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to commit import", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"imported": len(expenses), "expenses": expenses})
+}
+
+func (h *Handler) GetImportMapping(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	mapping, err := h.service.GetImportMapping(userID)
+	if err != nil {
+		h.logger.Error("Failed to get import mapping", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, mapping)
+}
+
+func (h *Handler) SaveImportMapping(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var mapping common.ImportMapping
+	if err := c.ShouldBindJSON(&mapping); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	saved, err := h.service.SaveImportMapping(userID, mapping)
+	if err != nil {
+		h.logger.Error("Failed to save import mapping", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, saved)
+}
+
 func (h *Handler) SetupRoutes(router *gin.RouterGroup) {
 	router.POST("", h.CreateExpense)
 	router.GET("", h.GetExpenses)
+	router.GET("/export", h.ExportExpenses)
+	router.GET("/tags", h.GetTags)
+	router.GET("/search", h.SearchExpenses)
 	router.PUT("/:id", h.UpdateExpense)
 	router.DELETE("/:id", h.DeleteExpense)
-}
\ No newline at end of file
+
+	router.POST("/recurring", h.CreateRecurringExpense)
+	router.GET("/recurring", h.GetRecurringExpenses)
+	router.GET("/recurring/:id", h.GetRecurringExpense)
+	router.PUT("/recurring/:id", h.UpdateRecurringExpense)
+	router.DELETE("/recurring/:id", h.DeleteRecurringExpense)
+
+	router.POST("/import", h.PreviewImport)
+	router.GET("/import/mapping", h.GetImportMapping)
+	router.PUT("/import/mapping", h.SaveImportMapping)
+	router.GET("/import/:id", h.GetImport)
+	router.POST("/import/:id/commit", h.CommitImport)
+
+	router.PUT("/:id/split", h.SplitExpense)
+	router.GET("/:id/split", h.GetSplit)
+	router.DELETE("/:id/split", h.DeleteSplit)
+	router.GET("/balances", h.GetBalances)
+	router.POST("/settlements", h.CreateSettlement)
+	router.GET("/settlements", h.GetSettlements)
+	router.DELETE("/settlements/:id", h.DeleteSettlement)
+
+	router.POST("/rules", h.CreateRule)
+	router.GET("/rules", h.GetRules)
+	router.GET("/rules/suggestions", h.GetRuleSuggestions)
+	router.GET("/rules/:id", h.GetRule)
+	router.PUT("/rules/:id", h.UpdateRule)
+	router.DELETE("/rules/:id", h.DeleteRule)
+}
+
+func (h *Handler) SplitExpense(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	expenseID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expense ID"})
+		return
+	}
+
+	var req common.SplitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	splits, err := h.service.SplitExpense(workspaceID, uint(expenseID), req)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Expense not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to split expense", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, splits)
+}
+
+func (h *Handler) GetSplit(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	expenseID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expense ID"})
+		return
+	}
+
+	splits, err := h.service.GetSplit(workspaceID, uint(expenseID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Expense not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to get expense split", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, splits)
+}
+
+func (h *Handler) DeleteSplit(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	expenseID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expense ID"})
+		return
+	}
+
+	if err := h.service.DeleteSplit(workspaceID, uint(expenseID)); err != nil {
+		h.logger.Error("Failed to delete expense split", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Expense split deleted successfully"})
+}
+
+func (h *Handler) GetBalances(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+
+	balances, err := h.service.Balances(workspaceID)
+	if err != nil {
+		h.logger.Error("Failed to compute balances", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, balances)
+}
+
+func (h *Handler) CreateSettlement(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	userID := c.GetUint("user_id")
+
+	var req common.SettlementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	settlement, err := h.service.CreateSettlement(workspaceID, userID, req)
+	if err != nil {
+		h.logger.Error("Failed to create settlement", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, settlement)
+}
+
+func (h *Handler) GetSettlements(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+
+	settlements, err := h.service.GetSettlements(workspaceID)
+	if err != nil {
+		h.logger.Error("Failed to get settlements", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, settlements)
+}
+
+func (h *Handler) DeleteSettlement(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	settlementID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid settlement ID"})
+		return
+	}
+
+	err = h.service.DeleteSettlement(workspaceID, uint(settlementID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Settlement not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to delete settlement", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Settlement deleted successfully"})
+}
+
+func (h *Handler) CreateRule(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+
+	var req common.CategoryRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := h.service.CreateRule(workspaceID, req)
+	if err != nil {
+		h.logger.Error("Failed to create rule", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, rule)
+}
+
+func (h *Handler) GetRules(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+
+	rules, err := h.service.GetRules(workspaceID)
+	if err != nil {
+		h.logger.Error("Failed to get rules", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"rules": rules})
+}
+
+// GetRuleSuggestions proposes rules learned from how existing expenses were
+// filed; posting one to /rules adopts it.
+func (h *Handler) GetRuleSuggestions(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+
+	suggestions, err := h.service.SuggestRules(workspaceID)
+	if err != nil {
+		h.logger.Error("Failed to suggest rules", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"suggestions": suggestions})
+}
+
+func (h *Handler) GetRule(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	ruleID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule ID"})
+		return
+	}
+
+	rule, err := h.service.GetRule(workspaceID, uint(ruleID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to get rule", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *Handler) UpdateRule(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	ruleID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule ID"})
+		return
+	}
+
+	var req common.CategoryRuleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule, err := h.service.UpdateRule(workspaceID, uint(ruleID), req)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to update rule", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+}
+
+func (h *Handler) DeleteRule(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	ruleID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule ID"})
+		return
+	}
+
+	err = h.service.DeleteRule(workspaceID, uint(ruleID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to delete rule", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Rule deleted successfully"})
+}
+
+// AttachmentHandler serves the files kept with expenses.
+type AttachmentHandler struct {
+	service *AttachmentService
+	logger  *zap.Logger
+}
+
+func NewAttachmentHandler(service *AttachmentService, logger *zap.Logger) *AttachmentHandler {
+	return &AttachmentHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+func (h *AttachmentHandler) UploadAttachment(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	userID := c.GetUint("user_id")
+	expenseID, ok := parseExpenseID(c)
+	if !ok {
+		return
+	}
+
+	// Cap the body before parsing it, or the whole upload would be buffered
+	// before its size could be checked.
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.service.maxSize+multipartOverhead)
+	file, err := c.FormFile("file")
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": ErrAttachmentTooLarge.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Attachment file is required"})
+		return
+	}
+	if file.Size > h.service.maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": ErrAttachmentTooLarge.Error()})
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	attachment, err := h.service.Upload(c.Request.Context(), workspaceID, expenseID, userID, file.Filename, f)
+	if err != nil {
+		h.fail(c, "Failed to upload attachment", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, attachment)
+}
+
+func (h *AttachmentHandler) GetAttachments(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	expenseID, ok := parseExpenseID(c)
+	if !ok {
+		return
+	}
+
+	attachments, err := h.service.List(workspaceID, expenseID)
+	if err != nil {
+		h.logger.Error("Failed to get attachments", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"attachments": attachments})
+}
+
+func (h *AttachmentHandler) DownloadAttachment(c *gin.Context) {
+	h.download(c, false)
+}
+
+func (h *AttachmentHandler) GetThumbnail(c *gin.Context) {
+	h.download(c, true)
+}
+
+func (h *AttachmentHandler) download(c *gin.Context, thumbnail bool) {
+	workspaceID := c.GetUint("workspace_id")
+	expenseID, ok := parseExpenseID(c)
+	if !ok {
+		return
+	}
+	attachmentID, err := strconv.ParseUint(c.Param("attachment_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
+		return
+	}
+
+	attachment, content, err := h.service.Open(c.Request.Context(), workspaceID, expenseID, uint(attachmentID), thumbnail)
+	if err != nil {
+		h.fail(c, "Failed to download attachment", err)
+		return
+	}
+	defer content.Close()
+
+	if thumbnail {
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.DataFromReader(http.StatusOK, -1, "image/jpeg", content, nil)
+		return
+	}
+	c.DataFromReader(http.StatusOK, attachment.Size, attachment.ContentType, content, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName}),
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+func (h *AttachmentHandler) DeleteAttachment(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	expenseID, ok := parseExpenseID(c)
+	if !ok {
+		return
+	}
+	attachmentID, err := strconv.ParseUint(c.Param("attachment_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
+		return
+	}
+
+	if err := h.service.Delete(c.Request.Context(), workspaceID, expenseID, uint(attachmentID)); err != nil {
+		h.fail(c, "Failed to delete attachment", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted successfully"})
+}
+
+func (h *AttachmentHandler) fail(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Expense not found"})
+	case errors.Is(err, ErrAttachmentNotFound), errors.Is(err, ErrNoThumbnail), errors.Is(err, storage.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrAttachmentTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrUnsupportedMedia):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrTooManyAttachments):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		h.logger.Error(message, zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func parseExpenseID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expense ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (h *AttachmentHandler) SetupRoutes(router *gin.RouterGroup) {
+	router.POST("/:id/attachments", h.UploadAttachment)
+	router.GET("/:id/attachments", h.GetAttachments)
+	router.GET("/:id/attachments/:attachment_id", h.DownloadAttachment)
+	router.GET("/:id/attachments/:attachment_id/thumbnail", h.GetThumbnail)
+	router.DELETE("/:id/attachments/:attachment_id", h.DeleteAttachment)
+}
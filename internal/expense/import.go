@@ -0,0 +1,442 @@
+package expense
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"fintrack/internal/category"
+	"fintrack/internal/common"
+	"gorm.io/gorm"
+)
+
+var ErrImportCommitted = errors.New("import has already been committed")
+
+// ImportRow is one previewed statement line. A row is importable when it has
+// no errors; duplicates are skipped on commit unless selected explicitly.
+type ImportRow struct {
+	Line            int          `json:"line"`
+	Date            string       `json:"date,omitempty"`
+	Amount          common.Money `json:"amount"`
+	Currency        string       `json:"currency"`
+	Description     string       `json:"description"`
+	Category        string       `json:"category"`
+	Tags            []string     `json:"tags,omitempty"`
+	RuleID          *uint        `json:"rule_id,omitempty"` // set when a rule filed the row
+	Errors          []string     `json:"errors,omitempty"`
+	DuplicateOf     *uint        `json:"duplicate_of,omitempty"`
+	DuplicateOfLine int          `json:"duplicate_of_line,omitempty"`
+}
+
+// UnmarshalJSON reads Amount in the row's own currency, so stored batches
+// keep the scale of three- and zero-decimal currencies.
+func (r *ImportRow) UnmarshalJSON(data []byte) error {
+	type importRow ImportRow
+	var raw struct {
+		importRow
+		Amount common.Amount `json:"amount"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	amount, err := raw.Amount.In(raw.Currency)
+	if err != nil {
+		return err
+	}
+	*r = ImportRow(raw.importRow)
+	r.Amount = amount
+	return nil
+}
+
+func (r ImportRow) valid() bool {
+	return len(r.Errors) == 0
+}
+
+func (r ImportRow) duplicate() bool {
+	return r.DuplicateOf != nil || r.DuplicateOfLine != 0
+}
+
+type ImportPreview struct {
+	Batch      common.ImportBatch `json:"batch"`
+	Rows       []ImportRow        `json:"rows"`
+	Valid      int                `json:"valid"`
+	Invalid    int                `json:"invalid"`
+	Duplicates int                `json:"duplicates"`
+}
+
+func (s *Service) GetImportMapping(userID uint) (*common.ImportMapping, error) {
+	var mapping common.ImportMapping
+	err := s.db.Where("user_id = ?", userID).First(&mapping).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		mapping = DefaultImportMapping(userID)
+		return &mapping, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &mapping, nil
+}
+
+func (s *Service) SaveImportMapping(userID uint, mapping common.ImportMapping) (*common.ImportMapping, error) {
+	if len([]rune(mapping.Delimiter)) != 1 {
+		return nil, errors.New("delimiter must be a single character")
+	}
+	if mapping.DateColumn == "" || (mapping.AmountColumn == "" && mapping.DebitColumn == "") {
+		return nil, errors.New("date column and amount or debit column are required")
+	}
+	if mapping.DateFormat == "" {
+		mapping.DateFormat = "2006-01-02"
+	}
+	if mapping.DefaultCategory == "" {
+		mapping.DefaultCategory = DefaultImportMapping(userID).DefaultCategory
+	}
+
+	existing, err := s.GetImportMapping(userID)
+	if err != nil {
+		return nil, err
+	}
+	mapping.ID = existing.ID
+	mapping.UserID = userID
+	mapping.CreatedAt = existing.CreatedAt
+
+	if err := s.db.Save(&mapping).Error; err != nil {
+		return nil, err
+	}
+	return &mapping, nil
+}
+
+// PreviewImport parses a statement with userID's mapping and stores it as a
+// batch awaiting commit into workspaceID. format may be empty to detect it
+// from the file.
+func (s *Service) PreviewImport(workspaceID, userID uint, filename, format string, data []byte) (*ImportPreview, error) {
+	if format == "" {
+		format = DetectFormat(filename, data)
+	}
+
+	var lines []statementLine
+	var err error
+	defaultCategory := DefaultImportMapping(userID).DefaultCategory
+	switch format {
+	case FormatCSV:
+		mapping, mappingErr := s.GetImportMapping(userID)
+		if mappingErr != nil {
+			return nil, mappingErr
+		}
+		lines, err = parseCSVStatement(bytes.NewReader(data), *mapping)
+		defaultCategory = mapping.DefaultCategory
+	case FormatOFX:
+		lines, err = parseOFXStatement(data)
+		if mapping, mappingErr := s.GetImportMapping(userID); mappingErr == nil {
+			defaultCategory = mapping.DefaultCategory
+		}
+	default:
+		return nil, fmt.Errorf("unsupported import format %q", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows := s.buildImportRows(workspaceID, lines)
+	if err := s.categorizeImportRows(workspaceID, rows, defaultCategory); err != nil {
+		return nil, err
+	}
+
+	encoded, err := json.Marshal(rows)
+	if err != nil {
+		return nil, err
+	}
+	batch := common.ImportBatch{
+		WorkspaceID: workspaceID,
+		UserID:      userID,
+		Format:      format,
+		Filename:    filename,
+		Status:      common.ImportStatusPreview,
+		Rows:        string(encoded),
+	}
+	if err := s.db.Create(&batch).Error; err != nil {
+		return nil, err
+	}
+
+	return newImportPreview(batch, rows), nil
+}
+
+func (s *Service) GetImportPreview(workspaceID, batchID uint) (*ImportPreview, error) {
+	batch, rows, err := s.loadImportBatch(s.db, workspaceID, batchID)
+	if err != nil {
+		return nil, err
+	}
+	return newImportPreview(*batch, rows), nil
+}
+
+// CommitImport creates expenses for the chosen lines in one transaction. With
+// no lines given, every valid non-duplicate row is imported. The expenses are
+// recorded as userID's.
+func (s *Service) CommitImport(workspaceID, userID, batchID uint, lines []int) ([]common.Expense, error) {
+	var created []common.Expense
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		batch, rows, err := s.loadImportBatch(tx, workspaceID, batchID)
+		if err != nil {
+			return err
+		}
+		if batch.Status == common.ImportStatusCommitted {
+			return ErrImportCommitted
+		}
+
+		selected, err := selectImportRows(rows, lines)
+		if err != nil {
+			return err
+		}
+
+		for _, row := range selected {
+			if !common.IsCurrencyCode(row.Amount.Currency) {
+				return fmt.Errorf("line %d: %w", row.Line, ErrInvalidCurrency)
+			}
+			date, err := time.Parse("2006-01-02", row.Date)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", row.Line, err)
+			}
+			filed, err := resolveCategory(tx, workspaceID, nil, row.Category)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", row.Line, err)
+			}
+			tags, err := resolveTags(tx, workspaceID, row.Tags)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", row.Line, err)
+			}
+			created = append(created, common.Expense{
+				WorkspaceID: workspaceID,
+				UserID:      userID,
+				Amount:      row.Amount,
+				Description: row.Description,
+				Category:    filed.Name,
+				CategoryID:  &filed.ID,
+				Date:        date,
+				Tags:        tags,
+			})
+		}
+
+		if len(created) > 0 {
+			if err := tx.Create(&created).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(batch).Update("status", common.ImportStatusCommitted).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range created {
+		s.notifyChange(nil, &created[i])
+	}
+	return created, nil
+}
+
+func (s *Service) loadImportBatch(db *gorm.DB, workspaceID, batchID uint) (*common.ImportBatch, []ImportRow, error) {
+	var batch common.ImportBatch
+	if err := db.Where("id = ? AND workspace_id = ?", batchID, workspaceID).First(&batch).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var rows []ImportRow
+	if err := json.Unmarshal([]byte(batch.Rows), &rows); err != nil {
+		return nil, nil, err
+	}
+	return &batch, rows, nil
+}
+
+func selectImportRows(rows []ImportRow, lines []int) ([]ImportRow, error) {
+	if lines == nil {
+		var selected []ImportRow
+		for _, row := range rows {
+			if row.valid() && !row.duplicate() {
+				selected = append(selected, row)
+			}
+		}
+		return selected, nil
+	}
+
+	byLine := make(map[int]ImportRow, len(rows))
+	for _, row := range rows {
+		byLine[row.Line] = row
+	}
+
+	selected := make([]ImportRow, 0, len(lines))
+	seen := make(map[int]bool)
+	for _, line := range lines {
+		row, ok := byLine[line]
+		if !ok {
+			return nil, fmt.Errorf("line %d is not part of this import", line)
+		}
+		if !row.valid() {
+			return nil, fmt.Errorf("line %d has errors: %s", line, strings.Join(row.Errors, "; "))
+		}
+		if !seen[line] {
+			seen[line] = true
+			selected = append(selected, row)
+		}
+	}
+	return selected, nil
+}
+
+// buildImportRows validates lines and flags likely duplicates of existing
+// expenses (same date and amount, similar description) and of earlier lines.
+func (s *Service) buildImportRows(workspaceID uint, lines []statementLine) []ImportRow {
+	fallbackCurrency := common.WorkspaceBaseCurrency(s.db, workspaceID)
+	rows := make([]ImportRow, 0, len(lines))
+	seen := make(map[string][]ImportRow)
+
+	for _, line := range lines {
+		row := ImportRow{
+			Line:        line.Line,
+			Currency:    line.Currency,
+			Description: line.Description,
+			Category:    line.Category,
+			Errors:      line.Errors,
+		}
+		if row.Currency == "" {
+			row.Currency = fallbackCurrency
+		}
+		if !line.Date.IsZero() {
+			row.Date = line.Date.Format("2006-01-02")
+		}
+
+		if line.Amount != "" {
+			amount, err := common.ParseMoney(line.Amount, row.Currency)
+			if err != nil {
+				row.Errors = append(row.Errors, err.Error())
+			} else if !amount.IsPositive() {
+				row.Errors = append(row.Errors, ErrNonPositiveAmount.Error())
+			} else {
+				row.Amount = amount
+			}
+		}
+
+		if row.valid() {
+			key := row.Date + "|" + row.Amount.String() + "|" + row.Amount.Currency
+			for _, earlier := range seen[key] {
+				if similarDescriptions(earlier.Description, row.Description) {
+					row.DuplicateOfLine = earlier.Line
+					break
+				}
+			}
+			if row.DuplicateOfLine == 0 {
+				row.DuplicateOf = s.findDuplicate(workspaceID, line.Date, row.Amount, row.Description)
+			}
+			seen[key] = append(seen[key], row)
+		}
+
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// categorizeImportRows files the valid rows the statement gave no category
+// by the workspace's rules, falling back to defaultCategory.
+func (s *Service) categorizeImportRows(workspaceID uint, rows []ImportRow, defaultCategory string) error {
+	matchers, err := loadMatchers(s.db, workspaceID)
+	if err != nil {
+		return err
+	}
+
+	for i := range rows {
+		row := &rows[i]
+		if row.Category != "" {
+			continue
+		}
+		row.Category = defaultCategory
+
+		var rule *common.CategoryRule
+		if row.valid() {
+			rule = firstMatch(matchers, row.Description, row.Amount)
+		}
+		if rule == nil {
+			continue
+		}
+		row.RuleID = &rule.ID
+		for _, tag := range rule.Tags {
+			row.Tags = append(row.Tags, tag.Name)
+		}
+		if rule.CategoryID == nil {
+			continue
+		}
+		filed, err := category.Get(s.db, workspaceID, *rule.CategoryID)
+		if errors.Is(err, category.ErrCategoryNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		row.Category = filed.Name
+	}
+	return nil
+}
+
+func (s *Service) findDuplicate(workspaceID uint, date time.Time, amount common.Money, description string) *uint {
+	var candidates []common.Expense
+	err := s.db.Where("workspace_id = ? AND date = ? AND amount_minor = ? AND amount_currency = ?", workspaceID, date, amount.Minor, amount.Currency).
+		Find(&candidates).Error
+	if err != nil {
+		return nil
+	}
+
+	for _, candidate := range candidates {
+		if similarDescriptions(candidate.Description, description) {
+			id := candidate.ID
+			return &id
+		}
+	}
+	return nil
+}
+
+// similarDescriptions compares descriptions by their word sets so bank
+// formatting noise ("CARD 1234 STARBUCKS #55" vs "Starbucks") still matches.
+func similarDescriptions(a, b string) bool {
+	wordsA, wordsB := descriptionWords(a), descriptionWords(b)
+	if len(wordsA) == 0 || len(wordsB) == 0 {
+		return len(wordsA) == len(wordsB)
+	}
+
+	shared := 0
+	for word := range wordsA {
+		if wordsB[word] {
+			shared++
+		}
+	}
+	smaller := len(wordsA)
+	if len(wordsB) < smaller {
+		smaller = len(wordsB)
+	}
+	return shared*2 >= smaller
+}
+
+func descriptionWords(s string) map[string]bool {
+	words := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		if len(word) > 1 {
+			words[word] = true
+		}
+	}
+	return words
+}
+
+func newImportPreview(batch common.ImportBatch, rows []ImportRow) *ImportPreview {
+	preview := &ImportPreview{Batch: batch, Rows: rows}
+	for _, row := range rows {
+		switch {
+		case !row.valid():
+			preview.Invalid++
+		case row.duplicate():
+			preview.Duplicates++
+		default:
+			preview.Valid++
+		}
+	}
+	return preview
+}
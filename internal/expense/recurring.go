@@ -0,0 +1,251 @@
+package expense
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"fintrack/internal/common"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxCatchUp bounds how many occurrences of one rule a single run may
+// materialize, so a daily rule with an ancient start date cannot stall the
+// scheduler; the remainder is picked up on the next run.
+const maxCatchUp = 1000
+
+// maxOccurrenceScan guards schedule recomputation against runaway loops.
+const maxOccurrenceScan = 100000
+
+func (s *Service) CreateRecurringExpense(workspaceID, userID uint, req common.RecurringExpenseRequest) (*common.RecurringExpense, error) {
+	rule := common.RecurringExpense{WorkspaceID: workspaceID, UserID: userID}
+	if err := s.applyRecurringRequest(&rule, req, common.WorkspaceBaseCurrency(s.db, workspaceID)); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Create(&rule).Error; err != nil {
+		return nil, err
+	}
+
+	return &rule, nil
+}
+
+func (s *Service) GetRecurringExpenses(workspaceID uint) ([]common.RecurringExpense, error) {
+	var rules []common.RecurringExpense
+	err := s.db.Where("workspace_id = ?", workspaceID).Order("created_at DESC").Find(&rules).Error
+	return rules, err
+}
+
+func (s *Service) GetRecurringExpense(workspaceID, ruleID uint) (*common.RecurringExpense, error) {
+	var rule common.RecurringExpense
+	if err := s.db.Where("id = ? AND workspace_id = ?", ruleID, workspaceID).First(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// UpdateRecurringExpense replaces the rule's schedule. Occurrences on or
+// before the last materialized date are never generated again.
+func (s *Service) UpdateRecurringExpense(workspaceID, ruleID uint, req common.RecurringExpenseRequest) (*common.RecurringExpense, error) {
+	rule, err := s.GetRecurringExpense(workspaceID, ruleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.applyRecurringRequest(rule, req, rule.Amount.Currency); err != nil {
+		return nil, err
+	}
+
+	if err := s.db.Save(rule).Error; err != nil {
+		return nil, err
+	}
+
+	return rule, nil
+}
+
+// DeleteRecurringExpense stops the rule; expenses it already created are kept.
+func (s *Service) DeleteRecurringExpense(workspaceID, ruleID uint) error {
+	return s.db.Where("id = ? AND workspace_id = ?", ruleID, workspaceID).Delete(&common.RecurringExpense{}).Error
+}
+
+func (s *Service) applyRecurringRequest(rule *common.RecurringExpense, req common.RecurringExpenseRequest, fallbackCurrency string) error {
+	amount, err := s.resolveAmount(common.ExpenseRequest{Amount: req.Amount, Currency: req.Currency}, fallbackCurrency)
+	if err != nil {
+		return err
+	}
+
+	start, err := time.Parse("2006-01-02", req.StartDate)
+	if err != nil {
+		return err
+	}
+
+	var end *time.Time
+	if req.EndDate != "" {
+		date, err := time.Parse("2006-01-02", req.EndDate)
+		if err != nil {
+			return err
+		}
+		if date.Before(start) {
+			return errors.New("end date must not be before start date")
+		}
+		end = &date
+	}
+
+	filed, err := resolveCategory(s.db, rule.WorkspaceID, req.CategoryID, req.Category)
+	if err != nil {
+		return err
+	}
+
+	interval := req.Interval
+	if interval == 0 {
+		interval = 1
+	}
+
+	rule.Amount = amount
+	rule.Description = req.Description
+	rule.Category = filed.Name
+	rule.CategoryID = &filed.ID
+	rule.Frequency = req.Frequency
+	rule.Interval = interval
+	rule.StartDate = start
+	rule.EndDate = end
+	rule.Count = req.Count
+
+	rule.Occurrences = 0
+	if rule.LastRun != nil {
+		for rule.Occurrences < maxOccurrenceScan {
+			date, ok := Occurrence(*rule, rule.Occurrences)
+			if !ok || date.After(*rule.LastRun) {
+				break
+			}
+			rule.Occurrences++
+		}
+	}
+	rule.NextRun = nextRun(*rule)
+
+	return nil
+}
+
+// Occurrence returns the n-th (zero based) date of the rule's schedule and
+// whether it exists within the rule's end date and count. Months are counted
+// from StartDate each time, so a rule on the 31st falls on the last day of
+// shorter months without drifting.
+func Occurrence(rule common.RecurringExpense, n int) (time.Time, bool) {
+	if n < 0 || (rule.Count != nil && n >= *rule.Count) {
+		return time.Time{}, false
+	}
+
+	interval := rule.Interval
+	if interval <= 0 {
+		interval = 1
+	}
+	steps := n * interval
+
+	var date time.Time
+	switch rule.Frequency {
+	case common.FrequencyDaily:
+		date = rule.StartDate.AddDate(0, 0, steps)
+	case common.FrequencyWeekly:
+		date = rule.StartDate.AddDate(0, 0, 7*steps)
+	case common.FrequencyMonthly:
+		date = addMonthsClamped(rule.StartDate, steps)
+	case common.FrequencyYearly:
+		date = addMonthsClamped(rule.StartDate, 12*steps)
+	default:
+		return time.Time{}, false
+	}
+
+	if rule.EndDate != nil && date.After(*rule.EndDate) {
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+func addMonthsClamped(t time.Time, months int) time.Time {
+	first := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location()).AddDate(0, months, 0)
+	lastDay := first.AddDate(0, 1, -1).Day()
+	day := t.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(first.Year(), first.Month(), day, 0, 0, 0, 0, t.Location())
+}
+
+func nextRun(rule common.RecurringExpense) *time.Time {
+	date, ok := Occurrence(rule, rule.Occurrences)
+	if !ok {
+		return nil
+	}
+	return &date
+}
+
+// MaterializeDueExpenses creates the expenses of every rule that have come due
+// on or before now, including occurrences missed while the service was down.
+// Inserts are keyed on (rule, date) so concurrent or repeated runs never
+// duplicate an expense. It returns how many expenses were created.
+func (s *Service) MaterializeDueExpenses(now time.Time) (int, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	var rules []common.RecurringExpense
+	if err := s.db.Where("next_run IS NOT NULL AND next_run <= ?", today).Find(&rules).Error; err != nil {
+		return 0, err
+	}
+
+	created := 0
+	var errs []error
+	for _, rule := range rules {
+		n, err := s.materializeRule(rule.ID, today)
+		created += n
+		if err != nil {
+			errs = append(errs, fmt.Errorf("recurring expense %d: %w", rule.ID, err))
+		}
+	}
+
+	return created, errors.Join(errs...)
+}
+
+func (s *Service) materializeRule(ruleID uint, today time.Time) (int, error) {
+	var created []common.Expense
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var rule common.RecurringExpense
+		if err := tx.First(&rule, ruleID).Error; err != nil {
+			return err
+		}
+
+		for i := 0; i < maxCatchUp && rule.NextRun != nil && !rule.NextRun.After(today); i++ {
+			date := *rule.NextRun
+			expense := common.Expense{
+				WorkspaceID:        rule.WorkspaceID,
+				UserID:             rule.UserID,
+				Amount:             rule.Amount,
+				Description:        rule.Description,
+				Category:           rule.Category,
+				CategoryID:         rule.CategoryID,
+				Date:               date,
+				RecurringExpenseID: &rule.ID,
+			}
+
+			result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&expense)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				created = append(created, expense)
+			}
+
+			rule.Occurrences++
+			rule.LastRun = &date
+			rule.NextRun = nextRun(rule)
+		}
+
+		return tx.Model(&rule).Select("occurrences", "last_run", "next_run").Updates(&rule).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range created {
+		s.notifyChange(nil, &created[i])
+	}
+	return len(created), nil
+}
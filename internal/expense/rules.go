@@ -0,0 +1,375 @@
+package expense
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"fintrack/internal/category"
+	"fintrack/internal/common"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRuleNoCondition    = errors.New("a rule needs a description, pattern, merchant or amount condition")
+	ErrRuleNoAction       = errors.New("a rule must set a category or tags")
+	ErrInvalidPattern     = errors.New("invalid description pattern")
+	ErrInvalidAmountRange = errors.New("amount bounds must not be negative and min_amount must not exceed max_amount")
+)
+
+const (
+	// uncategorized files new expenses that neither the request nor a rule
+	// gives a category.
+	uncategorized = "Uncategorized"
+
+	// A merchant is suggested for a rule once it has learnMinExpenses
+	// expenses of which at least learnMinShare are in one category.
+	learnMinExpenses = 3
+	learnMinShare    = 0.8
+)
+
+// RuleSuggestion proposes a merchant rule learned from existing expenses.
+// Matches of Total expenses of the merchant are filed under CategoryID.
+type RuleSuggestion struct {
+	Merchant   string `json:"merchant"`
+	CategoryID uint   `json:"category_id"`
+	Category   string `json:"category"`
+	Matches    int    `json:"matches"`
+	Total      int    `json:"total"`
+}
+
+func (s *Service) GetRules(workspaceID uint) ([]common.CategoryRule, error) {
+	rules := []common.CategoryRule{}
+	err := s.db.Preload("Tags").Where("workspace_id = ?", workspaceID).Order("priority, id").Find(&rules).Error
+	return rules, err
+}
+
+func (s *Service) GetRule(workspaceID, ruleID uint) (*common.CategoryRule, error) {
+	var rule common.CategoryRule
+	if err := s.db.Preload("Tags").Where("id = ? AND workspace_id = ?", ruleID, workspaceID).First(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (s *Service) CreateRule(workspaceID uint, req common.CategoryRuleRequest) (*common.CategoryRule, error) {
+	rule := common.CategoryRule{WorkspaceID: workspaceID}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.applyRuleRequest(tx, &rule, req); err != nil {
+			return err
+		}
+		return tx.Create(&rule).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func (s *Service) UpdateRule(workspaceID, ruleID uint, req common.CategoryRuleRequest) (*common.CategoryRule, error) {
+	rule, err := s.GetRule(workspaceID, ruleID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.applyRuleRequest(tx, rule, req); err != nil {
+			return err
+		}
+		if err := tx.Omit("Tags").Save(rule).Error; err != nil {
+			return err
+		}
+		association := tx.Model(rule).Association("Tags")
+		if len(rule.Tags) == 0 {
+			return association.Clear()
+		}
+		return association.Replace(rule.Tags)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (s *Service) DeleteRule(workspaceID, ruleID uint) error {
+	rule, err := s.GetRule(workspaceID, ruleID)
+	if err != nil {
+		return err
+	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(rule).Association("Tags").Clear(); err != nil {
+			return err
+		}
+		return tx.Delete(rule).Error
+	})
+}
+
+// applyRuleRequest validates req and copies it onto rule, resolving its
+// category and tags within tx.
+func (s *Service) applyRuleRequest(tx *gorm.DB, rule *common.CategoryRule, req common.CategoryRuleRequest) error {
+	pattern := strings.TrimSpace(req.DescriptionPattern)
+	if pattern != "" {
+		if _, err := compilePattern(pattern); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPattern, err)
+		}
+	}
+
+	var currency string
+	var bounds [2]*int64
+	for i, bound := range []*common.Amount{req.MinAmount, req.MaxAmount} {
+		if bound == nil {
+			continue
+		}
+		if currency == "" {
+			currency = strings.ToUpper(strings.TrimSpace(req.Currency))
+			if currency == "" {
+				currency = common.WorkspaceBaseCurrency(s.db, rule.WorkspaceID)
+			}
+			if !common.IsCurrencyCode(currency) {
+				return ErrInvalidCurrency
+			}
+		}
+		amount, err := bound.In(currency)
+		if err != nil {
+			return err
+		}
+		if amount.IsNegative() {
+			return ErrInvalidAmountRange
+		}
+		bounds[i] = &amount.Minor
+	}
+	if bounds[0] != nil && bounds[1] != nil && *bounds[0] > *bounds[1] {
+		return ErrInvalidAmountRange
+	}
+
+	rule.Priority = req.Priority
+	rule.DescriptionContains = strings.TrimSpace(req.DescriptionContains)
+	rule.DescriptionPattern = pattern
+	rule.Merchant = strings.Join(merchantWords(req.Merchant), " ")
+	rule.MinAmount, rule.MaxAmount, rule.Currency = bounds[0], bounds[1], currency
+	if rule.DescriptionContains == "" && rule.DescriptionPattern == "" && rule.Merchant == "" && rule.MinAmount == nil && rule.MaxAmount == nil {
+		return ErrRuleNoCondition
+	}
+
+	rule.CategoryID = nil
+	if req.CategoryID != nil {
+		filed, err := category.Get(tx, rule.WorkspaceID, *req.CategoryID)
+		if err != nil {
+			return err
+		}
+		rule.CategoryID = &filed.ID
+	}
+
+	tags, err := resolveTags(tx, rule.WorkspaceID, req.Tags)
+	if err != nil {
+		return err
+	}
+	rule.Tags = tags
+	if rule.CategoryID == nil && len(rule.Tags) == 0 {
+		return ErrRuleNoAction
+	}
+	return nil
+}
+
+// SuggestRules learns merchant rules from the workspace's filed expenses:
+// merchants whose expenses mostly share a category and that no rule covers
+// yet, the most frequent first.
+func (s *Service) SuggestRules(workspaceID uint) ([]RuleSuggestion, error) {
+	var expenses []common.Expense
+	err := s.db.Select("description", "category", "category_id", "amount_minor", "amount_currency").
+		Where("workspace_id = ? AND category_id IS NOT NULL", workspaceID).
+		Find(&expenses).Error
+	if err != nil {
+		return nil, err
+	}
+	matchers, err := loadMatchers(s.db, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	type merchant struct {
+		total      int
+		categories map[uint]int
+		names      map[uint]string
+	}
+	merchants := make(map[string]*merchant)
+	for _, expense := range expenses {
+		key := strings.Join(merchantWords(expense.Description), " ")
+		if key == "" || firstMatch(matchers, expense.Description, expense.Amount) != nil {
+			continue
+		}
+		m := merchants[key]
+		if m == nil {
+			m = &merchant{categories: make(map[uint]int), names: make(map[uint]string)}
+			merchants[key] = m
+		}
+		m.total++
+		m.categories[*expense.CategoryID]++
+		m.names[*expense.CategoryID] = expense.Category
+	}
+
+	suggestions := []RuleSuggestion{}
+	for key, m := range merchants {
+		if m.total < learnMinExpenses {
+			continue
+		}
+		var best uint
+		for id, count := range m.categories {
+			if count > m.categories[best] || count == m.categories[best] && id < best {
+				best = id
+			}
+		}
+		if float64(m.categories[best]) < learnMinShare*float64(m.total) {
+			continue
+		}
+		suggestions = append(suggestions, RuleSuggestion{
+			Merchant:   key,
+			CategoryID: best,
+			Category:   m.names[best],
+			Matches:    m.categories[best],
+			Total:      m.total,
+		})
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Matches != suggestions[j].Matches {
+			return suggestions[i].Matches > suggestions[j].Matches
+		}
+		return suggestions[i].Merchant < suggestions[j].Merchant
+	})
+	return suggestions, nil
+}
+
+// autoCategorize files an expense the request gave no category by the first
+// matching rule, returning the rule's tags too. Without a match, or when the
+// rule's category is gone, the expense goes to Uncategorized.
+func autoCategorize(db *gorm.DB, workspaceID uint, description string, amount common.Money) (*common.Category, []string, error) {
+	matchers, err := loadMatchers(db, workspaceID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var tags []string
+	if rule := firstMatch(matchers, description, amount); rule != nil {
+		for _, tag := range rule.Tags {
+			tags = append(tags, tag.Name)
+		}
+		if rule.CategoryID != nil {
+			filed, err := category.Get(db, workspaceID, *rule.CategoryID)
+			if err == nil {
+				return filed, tags, nil
+			}
+			if !errors.Is(err, category.ErrCategoryNotFound) {
+				return nil, nil, err
+			}
+		}
+	}
+
+	filed, err := category.Resolve(db, workspaceID, uncategorized)
+	return filed, tags, err
+}
+
+// matcher is a rule prepared for testing expenses against.
+type matcher struct {
+	rule     common.CategoryRule
+	contains string
+	pattern  *regexp.Regexp
+	merchant []string
+}
+
+func loadMatchers(db *gorm.DB, workspaceID uint) ([]matcher, error) {
+	var rules []common.CategoryRule
+	if err := db.Preload("Tags").Where("workspace_id = ?", workspaceID).Order("priority, id").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+
+	matchers := make([]matcher, 0, len(rules))
+	for _, rule := range rules {
+		m := matcher{
+			rule:     rule,
+			contains: strings.ToLower(rule.DescriptionContains),
+			merchant: merchantWords(rule.Merchant),
+		}
+		if rule.DescriptionPattern != "" {
+			pattern, err := compilePattern(rule.DescriptionPattern)
+			if err != nil {
+				continue
+			}
+			m.pattern = pattern
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
+
+func firstMatch(matchers []matcher, description string, amount common.Money) *common.CategoryRule {
+	for i := range matchers {
+		if matchers[i].matches(description, amount) {
+			return &matchers[i].rule
+		}
+	}
+	return nil
+}
+
+func (m matcher) matches(description string, amount common.Money) bool {
+	if m.contains != "" && !strings.Contains(strings.ToLower(description), m.contains) {
+		return false
+	}
+	if m.pattern != nil && !m.pattern.MatchString(description) {
+		return false
+	}
+	if len(m.merchant) > 0 && !containsPhrase(merchantWords(description), m.merchant) {
+		return false
+	}
+	if m.rule.MinAmount != nil || m.rule.MaxAmount != nil {
+		if amount.Currency != m.rule.Currency {
+			return false
+		}
+		if m.rule.MinAmount != nil && amount.Minor < *m.rule.MinAmount {
+			return false
+		}
+		if m.rule.MaxAmount != nil && amount.Minor > *m.rule.MaxAmount {
+			return false
+		}
+	}
+	return true
+}
+
+// compilePattern compiles a description pattern, which matches regardless
+// of case.
+func compilePattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("(?i)" + pattern)
+}
+
+// merchantWords reduces a description to its lowercase words of letters,
+// dropping bank noise such as card numbers and punctuation, so
+// "CARD 1234 STARBUCKS #55" reads as "card starbucks".
+func merchantWords(s string) []string {
+	var words []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		if len([]rune(word)) > 1 {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// containsPhrase reports whether phrase occurs as consecutive words.
+func containsPhrase(words, phrase []string) bool {
+	for i := 0; i+len(phrase) <= len(words); i++ {
+		match := true
+		for j, word := range phrase {
+			if words[i+j] != word {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
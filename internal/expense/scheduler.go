@@ -0,0 +1,87 @@
+package expense
+
+import (
+	"context"
+	"time"
+	"go.uber.org/zap"
+)
+
+// Scheduler periodically materializes due recurring expenses. Running several
+// replicas is safe because materialization is idempotent.
+type Scheduler struct {
+	service  *Service
+	logger   *zap.Logger
+	interval time.Duration
+}
+
+func NewScheduler(service *Service, logger *zap.Logger, interval time.Duration) *Scheduler {
+	return &Scheduler{
+		service:  service,
+		logger:   logger,
+		interval: interval,
+	}
+}
+
+// Run catches up immediately and then on every tick until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.runOnce()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) runOnce() {
+	created, err := s.service.MaterializeDueExpenses(time.Now().UTC())
+	if err != nil {
+		s.logger.Error("Failed to materialize recurring expenses", zap.Error(err))
+	}
+	if created > 0 {
+		s.logger.Info("Materialized recurring expenses", zap.Int("count", created))
+	}
+}
+
+// AttachmentSweeper periodically deletes attachments whose expense is gone,
+// such as those of deleted workspaces or whose cleanup failed.
+type AttachmentSweeper struct {
+	service  *AttachmentService
+	logger   *zap.Logger
+	interval time.Duration
+}
+
+func NewAttachmentSweeper(service *AttachmentService, logger *zap.Logger, interval time.Duration) *AttachmentSweeper {
+	return &AttachmentSweeper{
+		service:  service,
+		logger:   logger,
+		interval: interval,
+	}
+}
+
+// Run sweeps immediately and then on every tick until ctx is cancelled.
+func (s *AttachmentSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		removed, err := s.service.Sweep(ctx)
+		if err != nil {
+			s.logger.Error("Failed to sweep orphaned attachments", zap.Error(err))
+		}
+		if removed > 0 {
+			s.logger.Info("Removed orphaned attachments", zap.Int("count", removed))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package expense
+
+import (
+	"errors"
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+	"fintrack/internal/common"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// maxSearchWords bounds the work a single query can cause.
+	maxSearchWords = 16
+	// snippetContext is roughly how many characters of the description are
+	// shown on either side of the first match.
+	snippetContext = 60
+)
+
+var ErrEmptyQuery = errors.New("search query must contain at least one word")
+
+// SearchResult is a matching expense with its description highlighted:
+// matches are wrapped in <mark> and the rest is HTML-escaped.
+type SearchResult struct {
+	Expense common.Expense `json:"expense"`
+	Snippet string         `json:"snippet"`
+}
+
+type SearchResults struct {
+	Results []SearchResult `json:"results"`
+	Total   int64          `json:"total"`
+}
+
+// searchTerm is a word or a quoted phrase; every term must match. With
+// prefix set, the last word also matches words it begins.
+type searchTerm struct {
+	words  []string
+	prefix bool
+}
+
+// MigrateSearch adds the generated full-text column and its GIN index on
+// Postgres. Punctuation is turned into spaces first so "help.uber.com" is
+// indexed as words, like the matching done here. Other databases need no
+// schema and are searched with LIKE.
+func MigrateSearch(db *gorm.DB) error {
+	if db.Dialector.Name() != "postgres" {
+		return nil
+	}
+	err := db.Exec(`ALTER TABLE expenses ADD COLUMN IF NOT EXISTS search_vector tsvector
+		GENERATED ALWAYS AS (to_tsvector('simple', regexp_replace(coalesce(description, ''), '[^[:alnum:]]+', ' ', 'g'))) STORED`).Error
+	if err != nil {
+		return err
+	}
+	return db.Exec("CREATE INDEX IF NOT EXISTS idx_expenses_search ON expenses USING GIN (search_vector)").Error
+}
+
+// SearchExpenses finds the workspace's expenses whose description contains
+// every term of query, narrowed by filter. Terms are words, "quoted phrases"
+// and prefixes such as coff*. On Postgres results are ranked by relevance,
+// elsewhere they are newest first. Paging uses Limit and Offset.
+func (s *Service) SearchExpenses(workspaceID uint, query string, filter ListFilter) (*SearchResults, error) {
+	terms := parseSearchQuery(query)
+	if len(terms) == 0 {
+		return nil, ErrEmptyQuery
+	}
+	if filter.Cursor != "" {
+		return nil, ErrInvalidCursor
+	}
+
+	base := filter.apply(s.db.Model(&common.Expense{}).Where("workspace_id = ?", workspaceID))
+	var expenses []common.Expense
+	var total int64
+	var err error
+	if s.db.Dialector.Name() == "postgres" {
+		expenses, total, err = s.searchFullText(base, terms, filter)
+	} else {
+		expenses, total, err = s.searchLike(base, terms, filter)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	results := &SearchResults{Results: make([]SearchResult, len(expenses)), Total: total}
+	for i, expense := range expenses {
+		results.Results[i] = SearchResult{Expense: expense, Snippet: highlight(expense.Description, terms)}
+	}
+	return results, nil
+}
+
+func (s *Service) searchFullText(base *gorm.DB, terms []searchTerm, filter ListFilter) ([]common.Expense, int64, error) {
+	tsquery := toTSQuery(terms)
+	query := base.Where("search_vector @@ to_tsquery('simple', ?)", tsquery).Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var expenses []common.Expense
+	err := query.Preload("Tags").
+		Order(clause.OrderBy{Expression: clause.Expr{
+			SQL:                "ts_rank(search_vector, to_tsquery('simple', ?)) DESC, date DESC, id DESC",
+			Vars:               []interface{}{tsquery},
+			WithoutParentheses: true,
+		}}).
+		Limit(filter.limit()).Offset(filter.Offset).
+		Find(&expenses).Error
+	return expenses, total, err
+}
+
+// searchLike narrows candidates with LIKE and applies the word, phrase and
+// prefix rules in Go, so paging happens after matching.
+func (s *Service) searchLike(base *gorm.DB, terms []searchTerm, filter ListFilter) ([]common.Expense, int64, error) {
+	query := base
+	for _, term := range terms {
+		for _, word := range term.words {
+			query = query.Where("LOWER(description) LIKE ? ESCAPE '\\'", "%"+escapeLike(word)+"%")
+		}
+	}
+
+	var candidates []common.Expense
+	if err := query.Preload("Tags").Order("date DESC, id DESC").Find(&candidates).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var matched []common.Expense
+	for _, expense := range candidates {
+		if len(matchSpans(expense.Description, terms)) > 0 {
+			matched = append(matched, expense)
+		}
+	}
+
+	total := int64(len(matched))
+	start := min(filter.Offset, len(matched))
+	end := min(start+filter.limit(), len(matched))
+	return matched[start:end], total, nil
+}
+
+// parseSearchQuery splits query into terms. Text in double quotes is a
+// phrase, and a trailing * makes the last word of a term a prefix.
+func parseSearchQuery(query string) []searchTerm {
+	var terms []searchTerm
+	count := 0
+	add := func(text string) {
+		text = strings.TrimSpace(text)
+		prefix := strings.HasSuffix(text, "*")
+		words := searchWords(text)
+		if len(words) == 0 || count+len(words) > maxSearchWords {
+			return
+		}
+		count += len(words)
+		terms = append(terms, searchTerm{words: words, prefix: prefix})
+	}
+
+	for i, part := range strings.Split(query, `"`) {
+		// Odd parts are inside quotes.
+		if i%2 == 1 {
+			add(part)
+			continue
+		}
+		for _, field := range strings.Fields(part) {
+			add(field)
+		}
+	}
+	return terms
+}
+
+// toTSQuery renders terms for to_tsquery: phrases with <->, prefixes with
+// :* and every term required. Words are letters and digits only, so they
+// need no quoting.
+func toTSQuery(terms []searchTerm) string {
+	parts := make([]string, len(terms))
+	for i, term := range terms {
+		words := append([]string(nil), term.words...)
+		if term.prefix {
+			words[len(words)-1] += ":*"
+		}
+		parts[i] = strings.Join(words, " <-> ")
+		if len(words) > 1 {
+			parts[i] = "(" + parts[i] + ")"
+		}
+	}
+	return strings.Join(parts, " & ")
+}
+
+// searchWords lowercases s and splits it into runs of letters and digits.
+func searchWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// wordSpan is the byte range of a word in a description.
+type wordSpan struct {
+	start, end int
+}
+
+func wordSpans(s string) []wordSpan {
+	var spans []wordSpan
+	start := -1
+	for i, r := range s {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			spans = append(spans, wordSpan{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, wordSpan{start, len(s)})
+	}
+	return spans
+}
+
+// matchSpans returns the byte ranges of description matched by terms, in
+// order, or nil unless every term matches.
+func matchSpans(description string, terms []searchTerm) []wordSpan {
+	spans := wordSpans(description)
+	words := make([]string, len(spans))
+	for i, span := range spans {
+		words[i] = strings.ToLower(description[span.start:span.end])
+	}
+
+	marked := make([]bool, len(words))
+	for _, term := range terms {
+		found := false
+		for i := 0; i+len(term.words) <= len(words); i++ {
+			if termMatchesAt(words, i, term) {
+				found = true
+				for j := range term.words {
+					marked[i+j] = true
+				}
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+
+	// Neighbouring marked words, such as a matched phrase, share one range.
+	var matches []wordSpan
+	for i, span := range spans {
+		if !marked[i] {
+			continue
+		}
+		if n := len(matches); n > 0 && i > 0 && marked[i-1] {
+			matches[n-1].end = span.end
+			continue
+		}
+		matches = append(matches, span)
+	}
+	return matches
+}
+
+func termMatchesAt(words []string, i int, term searchTerm) bool {
+	for j, word := range term.words {
+		if term.prefix && j == len(term.words)-1 {
+			if !strings.HasPrefix(words[i+j], word) {
+				return false
+			}
+		} else if words[i+j] != word {
+			return false
+		}
+	}
+	return true
+}
+
+// highlight returns an HTML-escaped excerpt of description around its first
+// match with every match in the excerpt wrapped in <mark>.
+func highlight(description string, terms []searchTerm) string {
+	matches := matchSpans(description, terms)
+
+	from, to := 0, len(description)
+	if len(matches) > 0 && len(description) > 2*snippetContext+matches[0].end-matches[0].start {
+		from = max(0, matches[0].start-snippetContext)
+		to = min(len(description), matches[0].end+snippetContext)
+		// Keep whole characters.
+		for from > 0 && !utf8.RuneStart(description[from]) {
+			from--
+		}
+		for to < len(description) && !utf8.RuneStart(description[to]) {
+			to++
+		}
+	}
+
+	var b strings.Builder
+	if from > 0 {
+		b.WriteString("…")
+	}
+	pos := from
+	for _, m := range matches {
+		if m.start < from || m.end > to {
+			continue
+		}
+		b.WriteString(html.EscapeString(description[pos:m.start]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(description[m.start:m.end]))
+		b.WriteString("</mark>")
+		pos = m.end
+	}
+	b.WriteString(html.EscapeString(description[pos:to]))
+	if to < len(description) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
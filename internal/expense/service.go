@@ -1,53 +1,156 @@
 package expense
 
 import (
+	"errors"
+	"strings"
 	"time"
+	"fintrack/internal/category"
 	"fintrack/internal/common"
 	"gorm.io/gorm"
 )
 
+var (
+	ErrNonPositiveAmount = errors.New("amount must be greater than zero")
+	ErrInvalidCurrency   = errors.New("currency must be a three-letter ISO 4217 code")
+)
+
+// ChangeListener is told about every committed expense write. userID is the
+// member who recorded the expense; before is nil on create and after is nil
+// on delete.
+type ChangeListener interface {
+	ExpenseChanged(userID uint, before, after *common.Expense)
+}
+
 type Service struct {
-	db *gorm.DB
+	db        *gorm.DB
+	listeners []ChangeListener
 }
 
 func NewService(db *gorm.DB) *Service {
 	return &Service{db: db}
 }
 
-func (s *Service) CreateExpense(userID uint, req common.ExpenseRequest) (*common.Expense, error) {
+// AddListener registers l for expense changes. It must be called before the
+// service starts handling requests.
+func (s *Service) AddListener(l ChangeListener) {
+	s.listeners = append(s.listeners, l)
+}
+
+func (s *Service) notifyChange(before, after *common.Expense) {
+	expense := before
+	if expense == nil {
+		expense = after
+	}
+	for _, l := range s.listeners {
+		l.ExpenseChanged(expense.UserID, before, after)
+	}
+}
+
+// CreateExpense records an expense in workspaceID on behalf of userID.
+func (s *Service) CreateExpense(workspaceID, userID uint, req common.ExpenseRequest) (*common.Expense, error) {
+	amount, err := s.resolveAmount(req, common.WorkspaceBaseCurrency(s.db, workspaceID))
+	if err != nil {
+		return nil, err
+	}
+
 	date, err := time.Parse("2006-01-02", req.Date)
 	if err != nil {
 		return nil, err
 	}
 
+	var filed *common.Category
+	tags := req.Tags
+	if req.CategoryID == nil && category.Normalize(req.Category) == "" {
+		var ruleTags []string
+		if filed, ruleTags, err = autoCategorize(s.db, workspaceID, req.Description, amount); err != nil {
+			return nil, err
+		}
+		tags = append(append([]string{}, req.Tags...), ruleTags...)
+	} else if filed, err = resolveCategory(s.db, workspaceID, req.CategoryID, req.Category); err != nil {
+		return nil, err
+	}
+
+	if err := req.Metadata.Validate(); err != nil {
+		return nil, err
+	}
+
 	expense := common.Expense{
+		WorkspaceID: workspaceID,
 		UserID:      userID,
-		Amount:      req.Amount,
+		Amount:      amount,
 		Description: req.Description,
-		Category:    req.Category,
+		Category:    filed.Name,
+		CategoryID:  &filed.ID,
 		Date:        date,
+		Metadata:    req.Metadata,
 	}
 
-	if err := s.db.Create(&expense).Error; err != nil {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if expense.Tags, err = resolveTags(tx, workspaceID, tags); err != nil {
+			return err
+		}
+		return tx.Create(&expense).Error
+	})
+	if err != nil {
 		return nil, err
 	}
 
+	s.notifyChange(nil, &expense)
 	return &expense, nil
 }
 
-func (s *Service) GetExpenses(userID uint, limit, offset int) ([]common.Expense, error) {
+func (s *Service) GetExpenses(workspaceID uint, limit, offset int) ([]common.Expense, error) {
+	result, err := s.ListExpenses(workspaceID, ListFilter{SortField: "date", SortDesc: true, Limit: limit, Offset: offset})
+	if err != nil {
+		return nil, err
+	}
+	return result.Expenses, nil
+}
+
+// ListExpenses returns one page of the workspace's expenses matching filter. When
+// more rows follow, NextCursor resumes after the last one regardless of rows
+// inserted in between; Offset is only honoured without a cursor.
+func (s *Service) ListExpenses(workspaceID uint, filter ListFilter) (*ListResult, error) {
+	query := filter.apply(s.db.Model(&common.Expense{}).Where("workspace_id = ?", workspaceID)).Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, err
+	}
+
+	page := query
+	if filter.Cursor != "" {
+		var err error
+		if page, err = filter.after(page); err != nil {
+			return nil, err
+		}
+	} else if filter.Offset > 0 {
+		page = page.Offset(filter.Offset)
+	}
+
+	limit := filter.limit()
 	var expenses []common.Expense
-	err := s.db.Where("user_id = ?", userID).
-		Order("date DESC").
-		Limit(limit).
-		Offset(offset).
-		Find(&expenses).Error
-	return expenses, err
+	if err := page.Preload("Tags").Order(filter.order()).Limit(limit + 1).Find(&expenses).Error; err != nil {
+		return nil, err
+	}
+
+	result := &ListResult{Expenses: expenses, Total: total}
+	if len(expenses) > limit {
+		result.Expenses = expenses[:limit]
+		result.NextCursor = filter.cursorFor(expenses[limit-1])
+	}
+	return result, nil
 }
 
-func (s *Service) UpdateExpense(userID, expenseID uint, req common.ExpenseRequest) (*common.Expense, error) {
+func (s *Service) UpdateExpense(workspaceID, expenseID uint, req common.ExpenseRequest) (*common.Expense, error) {
 	var expense common.Expense
-	if err := s.db.Where("id = ? AND user_id = ?", expenseID, userID).First(&expense).Error; err != nil {
+	if err := s.db.Preload("Tags").Where("id = ? AND workspace_id = ?", expenseID, workspaceID).First(&expense).Error; err != nil {
+		return nil, err
+	}
+	before := expense
+
+	amount, err := s.resolveAmount(req, expense.Amount.Currency)
+	if err != nil {
 		return nil, err
 	}
 
@@ -56,18 +159,99 @@ func (s *Service) UpdateExpense(userID, expenseID uint, req common.ExpenseReques
 		return nil, err
 	}
 
-	expense.Amount = req.Amount
+	if req.CategoryID != nil || category.Normalize(req.Category) != "" {
+		filed, err := resolveCategory(s.db, workspaceID, req.CategoryID, req.Category)
+		if err != nil {
+			return nil, err
+		}
+		expense.Category = filed.Name
+		expense.CategoryID = &filed.ID
+	}
+
+	if req.Metadata != nil {
+		if err := req.Metadata.Validate(); err != nil {
+			return nil, err
+		}
+		expense.Metadata = req.Metadata
+	}
+
+	expense.Amount = amount
 	expense.Description = req.Description
-	expense.Category = req.Category
 	expense.Date = date
 
-	if err := s.db.Save(&expense).Error; err != nil {
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Tags").Save(&expense).Error; err != nil {
+			return err
+		}
+		if req.Tags != nil {
+			if err := setTags(tx, &expense, req.Tags); err != nil {
+				return err
+			}
+		}
+		if expense.Amount != before.Amount {
+			return reallocateSplit(tx, &expense)
+		}
+		return nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
+	s.notifyChange(&before, &expense)
 	return &expense, nil
 }
 
-func (s *Service) DeleteExpense(userID, expenseID uint) error {
-	return s.db.Where("id = ? AND user_id = ?", expenseID, userID).Delete(&common.Expense{}).Error
-}
\ No newline at end of file
+func (s *Service) DeleteExpense(workspaceID, expenseID uint) error {
+	var expense common.Expense
+	found := s.db.Where("id = ? AND workspace_id = ?", expenseID, workspaceID).First(&expense).Error == nil
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND workspace_id = ?", expenseID, workspaceID).Delete(&common.Expense{}).Error; err != nil {
+			return err
+		}
+		if found {
+			if err := tx.Model(&expense).Association("Tags").Clear(); err != nil {
+				return err
+			}
+		}
+		return tx.Where("expense_id = ? AND workspace_id = ?", expenseID, workspaceID).Delete(&common.ExpenseSplit{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	if found {
+		s.notifyChange(&expense, nil)
+	}
+	return nil
+}
+
+// resolveAmount applies the request currency, or fallback when none was sent,
+// to the parsed amount.
+func (s *Service) resolveAmount(req common.ExpenseRequest, fallback string) (common.Money, error) {
+	currency := strings.ToUpper(strings.TrimSpace(req.Currency))
+	if currency == "" {
+		currency = fallback
+	}
+	if !common.IsCurrencyCode(currency) {
+		return common.Money{}, ErrInvalidCurrency
+	}
+
+	amount, err := req.Amount.In(currency)
+	if err != nil {
+		return common.Money{}, err
+	}
+	if !amount.IsPositive() {
+		return common.Money{}, ErrNonPositiveAmount
+	}
+	return amount, nil
+}
+
+// resolveCategory picks the catalog category by ID, or by name when no ID
+// was sent; unknown names are added to the catalog.
+func resolveCategory(db *gorm.DB, workspaceID uint, categoryID *uint, name string) (*common.Category, error) {
+	if categoryID != nil {
+		return category.Get(db, workspaceID, *categoryID)
+	}
+	return category.Resolve(db, workspaceID, name)
+}
@@ -1,15 +1,39 @@
 package expense
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+	"fintrack/internal/category"
 	"fintrack/internal/common"
+	"fintrack/pkg/export"
+	"fintrack/pkg/storage"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
 func setupTestDB() *gorm.DB {
 	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	db.AutoMigrate(&common.Expense{})
+	db.AutoMigrate(&common.Expense{}, &common.RecurringExpense{}, &common.ImportMapping{}, &common.ImportBatch{}, &common.WorkspaceMember{}, &common.ExpenseSplit{}, &common.Settlement{}, &common.Category{}, &common.Tag{}, &common.Attachment{}, &common.CategoryRule{})
 	return db
 }
 
@@ -18,19 +42,19 @@ func TestExpenseService_CreateExpense(t *testing.T) {
 	service := NewService(db)
 
 	req := common.ExpenseRequest{
-		Amount:      100.50,
+		Amount:      "100.50",
 		Description: "Test expense",
 		Category:    "Food",
 		Date:        "2024-01-15",
 	}
 
-	expense, err := service.CreateExpense(1, req)
+	expense, err := service.CreateExpense(1, 1, req)
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
 
-	if expense.Amount != req.Amount {
-		t.Errorf("Expected amount %f, got %f", req.Amount, expense.Amount)
+	if expense.Amount != common.MustParseMoney("100.50", "USD") {
+		t.Errorf("Expected amount %s, got %s", req.Amount, expense.Amount)
 	}
 
 	if expense.Category != req.Category {
@@ -38,18 +62,62 @@ func TestExpenseService_CreateExpense(t *testing.T) {
 	}
 }
 
+func TestExpenseService_RequestAmountsUseRequestCurrency(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db)
+
+	for _, tc := range []struct {
+		body  string
+		minor int64
+	}{
+		{`{"amount": "1.234", "currency": "KWD", "category": "Food", "date": "2024-01-15"}`, 1234},
+		{`{"amount": 1.234, "currency": "kwd", "category": "Food", "date": "2024-01-15"}`, 1234},
+		{`{"amount": 500, "currency": "JPY", "category": "Food", "date": "2024-01-15"}`, 500},
+	} {
+		var req common.ExpenseRequest
+		if err := json.Unmarshal([]byte(tc.body), &req); err != nil {
+			t.Fatalf("Expected no error decoding %s, got %v", tc.body, err)
+		}
+		expense, err := service.CreateExpense(1, 1, req)
+		if err != nil {
+			t.Fatalf("Expected no error for %s, got %v", tc.body, err)
+		}
+		if expense.Amount.Minor != tc.minor {
+			t.Errorf("Expected %d minor units for %s, got %d", tc.minor, tc.body, expense.Amount.Minor)
+		}
+	}
+
+	var req common.ExpenseRequest
+	json.Unmarshal([]byte(`{"amount": "1.5", "currency": "JPY", "category": "Food", "date": "2024-01-15"}`), &req)
+	if _, err := service.CreateExpense(1, 1, req); !errors.Is(err, common.ErrInvalidAmount) {
+		t.Errorf("Expected ErrInvalidAmount for 1.5 JPY, got %v", err)
+	}
+
+	var recurring common.RecurringExpenseRequest
+	json.Unmarshal([]byte(`{"amount": "0.750", "currency": "KWD", "category": "Rent", "frequency": "monthly", "start_date": "2024-01-01"}`), &recurring)
+	if rule, err := service.CreateRecurringExpense(1, 1, recurring); err != nil || rule.Amount.Minor != 750 {
+		t.Errorf("Expected a 750 fils recurring expense, got %+v, %v", rule, err)
+	}
+
+	var ruleReq common.CategoryRuleRequest
+	json.Unmarshal([]byte(`{"merchant": "uber", "min_amount": 300, "max_amount": "2500", "currency": "JPY", "tags": ["ride"]}`), &ruleReq)
+	if rule, err := service.CreateRule(1, ruleReq); err != nil || *rule.MinAmount != 300 || *rule.MaxAmount != 2500 {
+		t.Errorf("Expected yen bounds 300 and 2500, got %+v, %v", rule, err)
+	}
+}
+
 func TestExpenseService_GetExpenses(t *testing.T) {
 	db := setupTestDB()
 	service := NewService(db)
 
 	// Create test expense
 	req := common.ExpenseRequest{
-		Amount:      100.50,
+		Amount:      "100.50",
 		Description: "Test expense",
 		Category:    "Food",
 		Date:        "2024-01-15",
 	}
-	service.CreateExpense(1, req)
+	service.CreateExpense(1, 1, req)
 
 	expenses, err := service.GetExpenses(1, 10, 0)
 	if err != nil {
@@ -59,4 +127,809 @@ func TestExpenseService_GetExpenses(t *testing.T) {
 	if len(expenses) != 1 {
 		t.Errorf("Expected 1 expense, got %d", len(expenses))
 	}
-}
\ No newline at end of file
+}
+func TestExpenseService_ListExpensesFiltersAndPaginates(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db)
+
+	for i, category := range []string{"Food", "Travel", "Food", "Rent", "Food"} {
+		service.CreateExpense(1, 1, common.ExpenseRequest{
+			Amount:      common.Amount(fmt.Sprint(10 * (i + 1))),
+			Description: "Item 100%",
+			Category:    category,
+			Date:        fmt.Sprintf("2024-01-%02d", 11+i),
+		})
+	}
+	service.CreateExpense(2, 2, common.ExpenseRequest{Amount: "5", Category: "Food", Date: "2024-01-12"})
+
+	query := url.Values{
+		"category":   {"Food,Travel"},
+		"min_amount": {"15"},
+		"sort":       {"amount"},
+		"order":      {"asc"},
+		"limit":      {"2"},
+	}
+	filter, err := ParseListFilter(query)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	first, err := service.ListExpenses(1, filter)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if first.Total != 3 || len(first.Expenses) != 2 || first.NextCursor == "" {
+		t.Fatalf("Expected 2 of 3 results with a cursor, got %d of %d (cursor %q)", len(first.Expenses), first.Total, first.NextCursor)
+	}
+	if first.Expenses[0].Amount.Minor != 2000 || first.Expenses[1].Amount.Minor != 3000 {
+		t.Errorf("Expected ascending amounts 2000, 3000, got %d, %d", first.Expenses[0].Amount.Minor, first.Expenses[1].Amount.Minor)
+	}
+
+	// A cheaper row inserted mid-pagination must not shift the next page.
+	service.CreateExpense(1, 1, common.ExpenseRequest{Amount: "16", Category: "Food", Date: "2024-01-20"})
+
+	filter.Cursor = first.NextCursor
+	second, err := service.ListExpenses(1, filter)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(second.Expenses) != 1 || second.Expenses[0].Amount.Minor != 5000 || second.NextCursor != "" {
+		t.Errorf("Expected final page with the 50.00 expense, got %+v", second)
+	}
+
+	filter.Description = "100%"
+	filter.Cursor = "not-a-cursor"
+	if _, err := service.ListExpenses(1, filter); err != ErrInvalidCursor {
+		t.Errorf("Expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestExpenseService_MaterializeDueExpenses(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db)
+
+	count := 4
+	rule, err := service.CreateRecurringExpense(1, 1, common.RecurringExpenseRequest{
+		Amount:    "1200",
+		Category:  "Rent",
+		Frequency: common.FrequencyMonthly,
+		StartDate: "2024-01-31",
+		Count:     &count,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// The service was "down" until mid-March: January and February catch up.
+	now := time.Date(2024, 3, 15, 9, 0, 0, 0, time.UTC)
+	created, err := service.MaterializeDueExpenses(now)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if created != 2 {
+		t.Errorf("Expected 2 expenses, got %d", created)
+	}
+
+	if created, _ := service.MaterializeDueExpenses(now); created != 0 {
+		t.Errorf("Expected a repeated run to create nothing, got %d", created)
+	}
+
+	// Much later only the remaining two of the four occurrences are created.
+	if created, _ := service.MaterializeDueExpenses(now.AddDate(1, 0, 0)); created != 2 {
+		t.Errorf("Expected the count limit to leave 2 more expenses, got %d", created)
+	}
+
+	var expenses []common.Expense
+	db.Where("recurring_expense_id = ?", rule.ID).Order("date").Find(&expenses)
+	want := []string{"2024-01-31", "2024-02-29", "2024-03-31", "2024-04-30"}
+	if len(expenses) != len(want) {
+		t.Fatalf("Expected %d expenses, got %d", len(want), len(expenses))
+	}
+	for i, expense := range expenses {
+		if got := expense.Date.Format("2006-01-02"); got != want[i] {
+			t.Errorf("Occurrence %d: expected %s, got %s", i, want[i], got)
+		}
+	}
+}
+
+func TestExpenseService_ImportCSVDetectsDuplicates(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db)
+
+	existing, err := service.CreateExpense(1, 1, common.ExpenseRequest{
+		Amount:      "4.50",
+		Description: "Starbucks",
+		Category:    "Food",
+		Date:        "2024-03-01",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	csv := "date,amount,description,category\n" +
+		"2024-03-01,4.50,CARD 1234 STARBUCKS #55,\n" +
+		"2024-03-02,\"1,200.00\",Rent,Housing\n" +
+		"2024-03-02,1200.00,Rent,Housing\n" +
+		"2024-03-03,abc,Broken,\n"
+
+	preview, err := service.PreviewImport(1, 1, "statement.csv", "", []byte(csv))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if preview.Valid != 1 || preview.Duplicates != 2 || preview.Invalid != 1 {
+		t.Fatalf("Expected 1 valid, 2 duplicates and 1 invalid, got %d, %d and %d", preview.Valid, preview.Duplicates, preview.Invalid)
+	}
+	if dup := preview.Rows[0].DuplicateOf; dup == nil || *dup != existing.ID {
+		t.Errorf("Expected line 2 to duplicate expense %d, got %v", existing.ID, dup)
+	}
+	if preview.Rows[0].Category != "Uncategorized" {
+		t.Errorf("Expected default category, got %s", preview.Rows[0].Category)
+	}
+	if preview.Rows[2].DuplicateOfLine != 3 {
+		t.Errorf("Expected line 4 to duplicate line 3, got %d", preview.Rows[2].DuplicateOfLine)
+	}
+
+	created, err := service.CommitImport(1, 1, preview.Batch.ID, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(created) != 1 || created[0].Amount != common.MustParseMoney("1200", "USD") {
+		t.Fatalf("Expected one 1200.00 expense, got %+v", created)
+	}
+
+	if _, err := service.CommitImport(1, 1, preview.Batch.ID, nil); err != ErrImportCommitted {
+		t.Errorf("Expected ErrImportCommitted, got %v", err)
+	}
+
+	// Stored rows keep each currency's scale through reload and commit.
+	csv = "date,amount,description,category,currency\n" +
+		"2024-04-01,12.345,Souq,Food,KWD\n" +
+		"2024-04-02,1500,Ramen,Food,JPY\n"
+	preview, err = service.PreviewImport(1, 1, "statement.csv", "", []byte(csv))
+	if err != nil || preview.Valid != 2 {
+		t.Fatalf("Expected 2 valid rows, got %+v, %v", preview, err)
+	}
+	reloaded, err := service.GetImportPreview(1, preview.Batch.ID)
+	if err != nil || reloaded.Rows[0].Amount != common.MustParseMoney("12.345", "KWD") {
+		t.Fatalf("Expected the KWD row to reload as 12.345, got %+v, %v", reloaded, err)
+	}
+	created, err = service.CommitImport(1, 1, preview.Batch.ID, nil)
+	if err != nil || len(created) != 2 || created[0].Amount.Minor != 12345 || created[1].Amount != common.NewMoney(1500, "JPY") {
+		t.Errorf("Expected 12.345 KWD and 1500 JPY, got %+v, %v", created, err)
+	}
+}
+
+func TestParseOFXStatement(t *testing.T) {
+	ofx := `OFXHEADER:100
+<OFX><BANKMSGSRSV1><STMTTRNRS><STMTRS><CURDEF>EUR
+<BANKTRANLIST>
+<STMTTRN><TRNTYPE>DEBIT<DTPOSTED>20240305120000<TRNAMT>-23.40<NAME>GROCERY STORE<MEMO>Card purchase
+<STMTTRN><TRNTYPE>CREDIT<DTPOSTED>20240306<TRNAMT>1000.00<NAME>SALARY
+</BANKTRANLIST></STMTRS></STMTTRNRS></BANKMSGSRSV1></OFX>`
+
+	if format := DetectFormat("export.txt", []byte(ofx)); format != FormatOFX {
+		t.Fatalf("Expected format %s, got %s", FormatOFX, format)
+	}
+
+	lines, err := parseOFXStatement([]byte(ofx))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d", len(lines))
+	}
+	if lines[0].Amount != "23.40" || lines[0].Currency != "EUR" || lines[0].Description != "GROCERY STORE Card purchase" {
+		t.Errorf("Unexpected debit line %+v", lines[0])
+	}
+	if lines[0].Date.Format("2006-01-02") != "2024-03-05" {
+		t.Errorf("Expected date 2024-03-05, got %s", lines[0].Date.Format("2006-01-02"))
+	}
+	if len(lines[1].Errors) == 0 {
+		t.Errorf("Expected credit line to be rejected")
+	}
+}
+
+func TestExpenseService_ExportExpenses(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db)
+
+	for _, req := range []common.ExpenseRequest{
+		{Amount: "12.50", Description: "Lunch, with \"team\"", Category: "Food", Date: "2024-02-01"},
+		{Amount: "40", Description: "Taxi", Category: "Transport", Date: "2024-02-02"},
+		{Amount: "7.25", Description: "Coffee", Category: "Food", Date: "2024-02-03"},
+	} {
+		if _, err := service.CreateExpense(1, 1, req); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	}
+
+	filter, _ := ParseListFilter(url.Values{"category": {"Food"}, "sort": {"date"}, "order": {"asc"}, "limit": {"1"}})
+
+	var buf bytes.Buffer
+	w, _ := export.NewWriter(export.FormatCSV, &buf)
+	if err := service.ExportExpenses(1, filter, w); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	w.Close()
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("Expected valid CSV, got %v", err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected header and 2 rows, got %d records", len(records))
+	}
+	if records[1][2] != "12.50" || records[1][5] != "Lunch, with \"team\"" || records[2][1] != "2024-02-03" {
+		t.Errorf("Unexpected rows %v", records[1:])
+	}
+
+	service.CreateExpense(2, 1, common.ExpenseRequest{Amount: "3", Description: "=HYPERLINK(\"http://evil\")", Category: "@Food", Date: "2024-02-01"})
+	buf.Reset()
+	w, _ = export.NewWriter(export.FormatCSV, &buf)
+	service.ExportExpenses(2, ListFilter{}, w)
+	w.Close()
+	records, _ = csv.NewReader(&buf).ReadAll()
+	if len(records) != 2 || records[1][5] != "'=HYPERLINK(\"http://evil\")" || records[1][4] != "'@Food" || records[1][2] != "3.00" {
+		t.Errorf("Expected formula cells to be quoted, got %v", records)
+	}
+
+	buf.Reset()
+	w, _ = export.NewWriter(export.FormatXLSX, &buf)
+	if err := service.ExportExpenses(1, filter, w); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Expected a zip archive, got %v", err)
+	}
+	for _, f := range archive.File {
+		if f.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		r, _ := f.Open()
+		sheet, _ := io.ReadAll(r)
+		if !bytes.Contains(sheet, []byte(`<c r="C2"><v>12.50</v></c>`)) {
+			t.Errorf("Expected numeric amount cell, got %s", sheet)
+		}
+		return
+	}
+	t.Errorf("Expected worksheet in XLSX archive")
+}
+
+func TestExpenseService_SplitsAndBalances(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db)
+	for _, userID := range []uint{1, 2, 3} {
+		db.Create(&common.WorkspaceMember{WorkspaceID: 1, UserID: userID, Role: "editor"})
+	}
+
+	expense, _ := service.CreateExpense(1, 1, common.ExpenseRequest{
+		Amount: "100", Description: "Dinner", Category: "Food", Date: "2024-03-01",
+	})
+
+	splits, err := service.SplitExpense(1, expense.ID, common.SplitRequest{
+		Method: common.SplitEqual,
+		Shares: []common.SplitShare{{UserID: 1}, {UserID: 2}, {UserID: 3}},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if splits[0].Amount.String() != "33.34" || splits[1].Amount.String() != "33.33" || splits[2].Amount.String() != "33.33" {
+		t.Errorf("Expected 33.34/33.33/33.33, got %s/%s/%s", splits[0].Amount, splits[1].Amount, splits[2].Amount)
+	}
+
+	_, err = service.SplitExpense(1, expense.ID, common.SplitRequest{
+		Method: common.SplitPercentage,
+		Shares: []common.SplitShare{{UserID: 1, Percent: "50"}, {UserID: 2, Percent: "40"}},
+	})
+	if err != ErrPercentTotal {
+		t.Errorf("Expected ErrPercentTotal, got %v", err)
+	}
+	_, err = service.SplitExpense(1, expense.ID, common.SplitRequest{
+		Method: common.SplitShares,
+		Shares: []common.SplitShare{{UserID: 1, Shares: 1}, {UserID: 4, Shares: 1}},
+	})
+	if err != ErrNotParticipant {
+		t.Errorf("Expected ErrNotParticipant, got %v", err)
+	}
+
+	if _, err := service.UpdateExpense(1, expense.ID, common.ExpenseRequest{
+		Amount: "200.01", Description: "Dinner", Category: "Food", Date: "2024-03-01",
+	}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	splits, _ = service.GetSplit(1, expense.ID)
+	parts := make([]common.Money, len(splits))
+	for i, split := range splits {
+		parts[i] = split.Amount
+	}
+	if sum, _ := common.Sum(parts...); sum.String() != "200.01" {
+		t.Errorf("Expected split to follow the new amount 200.01, got %s", sum)
+	}
+
+	// User 3 paid 30 for a taxi shared with user 2 by exact amounts.
+	taxi, _ := service.CreateExpense(1, 3, common.ExpenseRequest{
+		Amount: "30", Description: "Taxi", Category: "Transport", Date: "2024-03-02",
+	})
+	if _, err := service.SplitExpense(1, taxi.ID, common.SplitRequest{
+		Method: common.SplitExact,
+		Shares: []common.SplitShare{{UserID: 2, Amount: "20"}, {UserID: 3, Amount: "10"}},
+	}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	balances, err := service.Balances(1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(balances) != 1 || balances[0].Currency != "USD" {
+		t.Fatalf("Expected USD balances only, got %+v", balances)
+	}
+	net := map[uint]string{}
+	for _, b := range balances[0].Balances {
+		net[b.UserID] = b.Amount.String()
+	}
+	if net[1] != "133.32" || net[2] != "-86.66" || net[3] != "-46.66" {
+		t.Errorf("Unexpected balances %v", net)
+	}
+	if len(balances[0].Transfers) != 2 {
+		t.Errorf("Expected 2 transfers, got %+v", balances[0].Transfers)
+	}
+
+	if _, err := service.CreateSettlement(1, 2, common.SettlementRequest{
+		FromUserID: 2, ToUserID: 1, Amount: "86.66",
+	}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	balances, _ = service.Balances(1)
+	for _, b := range balances[0].Balances {
+		if b.UserID == 2 {
+			t.Errorf("Expected user 2 to be settled, got %s", b.Amount)
+		}
+	}
+	if len(balances[0].Transfers) != 1 || balances[0].Transfers[0].FromUserID != 3 || balances[0].Transfers[0].Amount.String() != "46.66" {
+		t.Errorf("Expected user 3 to owe user 1 46.66, got %+v", balances[0].Transfers)
+	}
+
+	if err := service.DeleteExpense(1, taxi.ID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if splits, _ := service.GetSplit(1, taxi.ID); len(splits) != 0 {
+		t.Errorf("Expected split to be removed with its expense, got %d parts", len(splits))
+	}
+}
+
+func TestExpenseService_TagsAndMetadata(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db)
+
+	create := func(description string, tags []string) *common.Expense {
+		expense, err := service.CreateExpense(1, 1, common.ExpenseRequest{
+			Amount:      "10.00",
+			Description: description,
+			Category:    "Travel",
+			Date:        "2024-05-01",
+			Tags:        tags,
+			Metadata:    common.Metadata{"receipt": "R-1"},
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return expense
+	}
+	hotel := create("Hotel", []string{"Berlin Trip", " berlin  trip", "tax-deductible"})
+	train := create("Train", []string{"BERLIN TRIP"})
+	create("Lunch", nil)
+	service.CreateExpense(2, 1, common.ExpenseRequest{Amount: "5", Category: "Food", Date: "2024-05-01", Tags: []string{"berlin trip"}})
+
+	if len(hotel.Tags) != 2 || hotel.Tags[0].Name != "Berlin Trip" {
+		t.Fatalf("Expected 2 distinct tags, got %+v", hotel.Tags)
+	}
+	var count int64
+	db.Model(&common.Tag{}).Where("workspace_id = ?", 1).Count(&count)
+	if count != 2 {
+		t.Errorf("Expected 2 tags in the workspace, got %d", count)
+	}
+
+	filter, _ := ParseListFilter(url.Values{"tag": {"berlin trip,unknown"}})
+	result, err := service.ListExpenses(1, filter)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if result.Total != 2 || len(result.Expenses[0].Tags) == 0 {
+		t.Errorf("Expected 2 expenses tagged berlin trip with tags loaded, got %d", result.Total)
+	}
+	if result.Expenses[0].Metadata["receipt"] != "R-1" {
+		t.Errorf("Expected metadata to round-trip, got %v", result.Expenses[0].Metadata)
+	}
+
+	suggestions, err := service.SuggestTags(1, "TR", 0)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(suggestions) != 1 || suggestions[0].Name != "Berlin Trip" || suggestions[0].Count != 2 {
+		t.Errorf("Expected Berlin Trip used twice, got %+v", suggestions)
+	}
+	if suggestions, _ := service.SuggestTags(1, "", 0); len(suggestions) != 2 || suggestions[0].Name != "Berlin Trip" {
+		t.Errorf("Expected the most used tag first, got %+v", suggestions)
+	}
+
+	// Expenses soft-deleted without going through DeleteExpense keep their
+	// expense_tags rows, which must not count.
+	db.Delete(train)
+	if suggestions, _ := service.SuggestTags(1, "trip", 0); len(suggestions) != 1 || suggestions[0].Count != 1 {
+		t.Errorf("Expected deleted expenses not to count, got %+v", suggestions)
+	}
+
+	// Omitted tags and metadata are kept; an empty list clears the tags.
+	update := common.ExpenseRequest{Amount: "12.00", Category: "Travel", Date: "2024-05-01"}
+	updated, err := service.UpdateExpense(1, hotel.ID, update)
+	if err != nil || len(updated.Tags) != 2 || updated.Metadata["receipt"] != "R-1" {
+		t.Fatalf("Expected tags and metadata to be kept, got %+v, %v", updated, err)
+	}
+	update.Tags = []string{}
+	update.Metadata = common.Metadata{}
+	if updated, _ = service.UpdateExpense(1, hotel.ID, update); len(updated.Tags) != 0 {
+		t.Errorf("Expected tags to be cleared, got %+v", updated.Tags)
+	}
+	if suggestions, _ := service.SuggestTags(1, "tax", 0); len(suggestions) != 0 {
+		t.Errorf("Expected unused tags not to be suggested, got %+v", suggestions)
+	}
+	var stored common.Expense
+	db.First(&stored, hotel.ID)
+	if stored.Metadata != nil {
+		t.Errorf("Expected metadata to be cleared, got %v", stored.Metadata)
+	}
+
+	huge := common.Metadata{"note": strings.Repeat("x", common.MaxMetadataBytes)}
+	if _, err := service.CreateExpense(1, 1, common.ExpenseRequest{Amount: "1", Category: "Food", Date: "2024-05-01", Metadata: huge}); err != common.ErrMetadataTooLarge {
+		t.Errorf("Expected ErrMetadataTooLarge, got %v", err)
+	}
+}
+
+func TestAttachmentHandler_LimitsUploadSize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	service := NewService(db)
+	attachments := NewAttachmentService(db, storage.NewFileStore(t.TempDir()), 1<<10, zap.NewNop())
+	expense, _ := service.CreateExpense(1, 1, common.ExpenseRequest{Amount: "42", Category: "Food", Date: "2024-05-01"})
+
+	router := gin.New()
+	group := router.Group("/expenses", func(c *gin.Context) {
+		c.Set("workspace_id", uint(1))
+		c.Set("user_id", uint(1))
+	})
+	NewAttachmentHandler(attachments, zap.NewNop()).SetupRoutes(group)
+
+	upload := func(content []byte) int {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		part, _ := form.CreateFormFile("file", "receipt.pdf")
+		part.Write(content)
+		form.Close()
+
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/expenses/%d/attachments", expense.ID), &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	pdf := []byte("%PDF-1.4\n%%EOF")
+	if code := upload(pdf); code != http.StatusCreated {
+		t.Errorf("Expected 201 for a small receipt, got %d", code)
+	}
+	if code := upload(append(pdf, make([]byte, 4<<10)...)); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a file over the limit, got %d", code)
+	}
+	if code := upload(append(pdf, make([]byte, 1<<20)...)); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a body over the limit, got %d", code)
+	}
+}
+
+func TestExpenseHandler_LimitsImportSize(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	group := router.Group("/expenses", func(c *gin.Context) {
+		c.Set("workspace_id", uint(1))
+		c.Set("user_id", uint(1))
+	})
+	NewHandler(NewService(setupTestDB()), zap.NewNop()).SetupRoutes(group)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, _ := form.CreateFormFile("file", "statement.csv")
+	part.Write(make([]byte, maxImportSize+multipartOverhead))
+	form.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/expenses/import", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a body over the limit, got %d", w.Code)
+	}
+}
+
+// s3StandIn is a minimal S3-compatible server keeping objects in memory.
+type s3StandIn struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (s *s3StandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minio/") || r.Header.Get("X-Amz-Date") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		s.objects[r.URL.Path] = body
+	case http.MethodGet:
+		body, ok := s.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(body)
+	case http.MethodDelete:
+		delete(s.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func TestAttachmentService_StoresAndCleansUp(t *testing.T) {
+	var img bytes.Buffer
+	png.Encode(&img, image.NewRGBA(image.Rect(0, 0, 600, 300)))
+	pdf := []byte("%PDF-1.4\n1 0 obj <<>> endobj\ntrailer <<>>\n%%EOF")
+
+	dir := t.TempDir()
+	standIn := &s3StandIn{objects: make(map[string][]byte)}
+	server := httptest.NewServer(standIn)
+	defer server.Close()
+
+	stores := map[string]struct {
+		store storage.BlobStore
+		count func() int
+	}{
+		"file": {storage.NewFileStore(dir), func() int {
+			count := 0
+			filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					count++
+				}
+				return nil
+			})
+			return count
+		}},
+		"s3": {storage.NewS3Store(storage.S3Config{Endpoint: server.URL, Bucket: "receipts", AccessKey: "minio", SecretKey: "secret"}), func() int {
+			standIn.mu.Lock()
+			defer standIn.mu.Unlock()
+			return len(standIn.objects)
+		}},
+	}
+
+	for name, tc := range stores {
+		t.Run(name, func(t *testing.T) {
+			db := setupTestDB()
+			service := NewService(db)
+			attachments := NewAttachmentService(db, tc.store, 1<<20, zap.NewNop())
+			service.AddListener(attachments)
+			ctx := context.Background()
+
+			expense, _ := service.CreateExpense(1, 1, common.ExpenseRequest{Amount: "42", Category: "Food", Date: "2024-05-01"})
+			receipt, err := attachments.Upload(ctx, 1, expense.ID, 1, `C:\scans\receipt.png`, bytes.NewReader(img.Bytes()))
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if receipt.ContentType != "image/png" || receipt.FileName != "receipt.png" || receipt.ThumbnailKey == "" {
+				t.Errorf("Expected a thumbnailed receipt.png, got %+v", receipt)
+			}
+			invoice, err := attachments.Upload(ctx, 1, expense.ID, 1, "", bytes.NewReader(pdf))
+			if err != nil || invoice.FileName != "receipt.pdf" || invoice.ThumbnailKey != "" {
+				t.Fatalf("Expected an unthumbnailed PDF, got %+v, %v", invoice, err)
+			}
+			if tc.count() != 3 {
+				t.Errorf("Expected 3 blobs, got %d", tc.count())
+			}
+
+			_, content, err := attachments.Open(ctx, 1, expense.ID, receipt.ID, true)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			thumb, _, err := image.Decode(content)
+			content.Close()
+			if err != nil || thumb.Bounds().Dx() != 256 || thumb.Bounds().Dy() != 128 {
+				t.Errorf("Expected a 256x128 thumbnail, got %v, %v", thumb, err)
+			}
+			if _, _, err := attachments.Open(ctx, 2, expense.ID, receipt.ID, false); err != ErrAttachmentNotFound {
+				t.Errorf("Expected another workspace to be refused, got %v", err)
+			}
+
+			if _, err := attachments.Upload(ctx, 1, expense.ID, 1, "notes.txt", strings.NewReader("hello")); err != ErrUnsupportedMedia {
+				t.Errorf("Expected ErrUnsupportedMedia, got %v", err)
+			}
+			if _, err := attachments.Upload(ctx, 1, expense.ID, 1, "big.pdf", io.MultiReader(bytes.NewReader(pdf), bytes.NewReader(make([]byte, 1<<20)))); err != ErrAttachmentTooLarge {
+				t.Errorf("Expected ErrAttachmentTooLarge, got %v", err)
+			}
+
+			if err := attachments.Delete(ctx, 1, expense.ID, invoice.ID); err != nil || tc.count() != 2 {
+				t.Errorf("Expected the PDF blob to be deleted, got %d blobs, %v", tc.count(), err)
+			}
+			if err := service.DeleteExpense(1, expense.ID); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if list, _ := attachments.List(1, expense.ID); len(list) != 0 || tc.count() != 0 {
+				t.Errorf("Expected attachments to go with their expense, got %d rows and %d blobs", len(list), tc.count())
+			}
+
+			// Expenses removed without the listener, as with workspace deletion.
+			other, _ := service.CreateExpense(1, 1, common.ExpenseRequest{Amount: "5", Category: "Food", Date: "2024-05-02"})
+			attachments.Upload(ctx, 1, other.ID, 1, "scan.pdf", bytes.NewReader(pdf))
+			db.Delete(other)
+			if removed, err := attachments.Sweep(ctx); err != nil || removed != 1 || tc.count() != 0 {
+				t.Errorf("Expected the sweep to remove 1 orphan, got %d, %v with %d blobs left", removed, err, tc.count())
+			}
+		})
+	}
+}
+
+func TestExpenseService_CategoryRules(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db)
+
+	transport, _ := category.Resolve(db, 1, "Transport")
+	coffee, _ := category.Resolve(db, 1, "Coffee")
+	usd := func(s string) *common.Amount {
+		a := common.Amount(s)
+		return &a
+	}
+
+	if _, err := service.CreateRule(1, common.CategoryRuleRequest{Merchant: "Uber", CategoryID: &transport.ID, Tags: []string{"work"}}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := service.CreateRule(1, common.CategoryRuleRequest{DescriptionContains: "coffee", MaxAmount: usd("5"), CategoryID: &coffee.ID}); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, err := service.CreateRule(1, common.CategoryRuleRequest{DescriptionPattern: "(", CategoryID: &coffee.ID}); !errors.Is(err, ErrInvalidPattern) {
+		t.Errorf("Expected ErrInvalidPattern, got %v", err)
+	}
+	if _, err := service.CreateRule(1, common.CategoryRuleRequest{CategoryID: &coffee.ID}); err != ErrRuleNoCondition {
+		t.Errorf("Expected ErrRuleNoCondition, got %v", err)
+	}
+	if _, err := service.CreateRule(1, common.CategoryRuleRequest{Merchant: "lyft"}); err != ErrRuleNoAction {
+		t.Errorf("Expected ErrRuleNoAction, got %v", err)
+	}
+	if _, err := service.CreateRule(1, common.CategoryRuleRequest{Merchant: "lyft", MinAmount: usd("10"), MaxAmount: usd("5"), Tags: []string{"x"}}); err != ErrInvalidAmountRange {
+		t.Errorf("Expected ErrInvalidAmountRange, got %v", err)
+	}
+
+	create := func(description, amount, categoryName string) *common.Expense {
+		expense, err := service.CreateExpense(1, 1, common.ExpenseRequest{
+			Amount:      common.Amount(amount),
+			Description: description,
+			Category:    categoryName,
+			Date:        "2024-06-01",
+		})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		return expense
+	}
+	if ride := create("UBER *TRIP 1234", "18.20", ""); ride.Category != "Transport" || len(ride.Tags) != 1 || ride.Tags[0].Name != "work" {
+		t.Errorf("Expected the Uber rule to file and tag the ride, got %s %+v", ride.Category, ride.Tags)
+	}
+	if latte := create("Coffee Corner", "3.80", ""); latte.Category != "Coffee" {
+		t.Errorf("Expected Coffee, got %s", latte.Category)
+	}
+	if beans := create("Coffee beans 1kg", "32.00", ""); beans.Category != "Uncategorized" {
+		t.Errorf("Expected amounts over the bound to stay uncategorized, got %s", beans.Category)
+	}
+	if chosen := create("Uber Eats", "25.00", "Food"); chosen.Category != "Food" || len(chosen.Tags) != 0 {
+		t.Errorf("Expected an explicit category to skip rules, got %s %+v", chosen.Category, chosen.Tags)
+	}
+
+	csv := "date,amount,description,category\n" +
+		"2024-06-02,12.00,UBER BV HELP.UBER.COM,\n" +
+		"2024-06-03,9.00,Uber,Travel\n" +
+		"2024-06-04,40.00,Hardware store,\n"
+	preview, err := service.PreviewImport(1, 1, "statement.csv", "", []byte(csv))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	rows := preview.Rows
+	if rows[0].Category != "Transport" || rows[0].RuleID == nil || len(rows[0].Tags) != 1 {
+		t.Errorf("Expected the rule to file line 2, got %+v", rows[0])
+	}
+	if rows[1].Category != "Travel" || rows[1].RuleID != nil {
+		t.Errorf("Expected the statement's category to win, got %+v", rows[1])
+	}
+	if rows[2].Category != "Uncategorized" {
+		t.Errorf("Expected the default category, got %s", rows[2].Category)
+	}
+	created, err := service.CommitImport(1, 1, preview.Batch.ID, nil)
+	if err != nil || len(created) != 3 || len(created[0].Tags) != 1 {
+		t.Fatalf("Expected the tagged import to commit, got %+v, %v", created, err)
+	}
+
+	for i := 0; i < 4; i++ {
+		create("Netflix.com", "15.99", "Subscriptions")
+	}
+	create("NETFLIX.COM", "15.99", "Entertainment")
+	for i := 0; i < 3; i++ {
+		create("Gym", "30", "Health")
+	}
+	create("Gym", "30", "Shopping")
+	suggestions, err := service.SuggestRules(1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(suggestions) != 1 || suggestions[0].Merchant != "netflix com" || suggestions[0].Category != "Subscriptions" || suggestions[0].Matches != 4 || suggestions[0].Total != 5 {
+		t.Errorf("Expected only netflix to be suggested, got %+v", suggestions)
+	}
+}
+
+func TestExpenseService_SearchExpenses(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db)
+
+	for _, e := range []struct{ description, date string }{
+		{"Coffee beans from <Corner> roastery", "2024-03-01"},
+		{"UBER *TRIP help.uber.com", "2024-03-02"},
+		{"Coffee with Uber driver", "2024-03-03"},
+		{"Cold brew coffee", "2024-04-10"},
+	} {
+		service.CreateExpense(1, 1, common.ExpenseRequest{Amount: "4", Description: e.description, Category: "Food", Date: e.date})
+	}
+	service.CreateExpense(2, 2, common.ExpenseRequest{Amount: "4", Description: "Coffee", Category: "Food", Date: "2024-03-01"})
+
+	search := func(query string, filter ListFilter) []string {
+		results, err := service.SearchExpenses(1, query, filter)
+		if err != nil {
+			t.Fatalf("Expected no error for %q, got %v", query, err)
+		}
+		snippets := make([]string, len(results.Results))
+		for i, result := range results.Results {
+			snippets[i] = result.Snippet
+		}
+		return snippets
+	}
+
+	if got := search("coffee", ListFilter{}); len(got) != 3 || got[0] != "Cold brew <mark>coffee</mark>" {
+		t.Errorf("Expected 3 workspace matches, newest first, got %q", got)
+	}
+	if got := search(`"uber driver"`, ListFilter{}); len(got) != 1 || got[0] != "Coffee with <mark>Uber driver</mark>" {
+		t.Errorf("Expected the phrase to match once, got %q", got)
+	}
+	if got := search("roast*", ListFilter{}); len(got) != 1 || got[0] != "Coffee beans from &lt;Corner&gt; <mark>roastery</mark>" {
+		t.Errorf("Expected an escaped prefix match, got %q", got)
+	}
+	if got := search("uber trip", ListFilter{}); len(got) != 1 || got[0] != "<mark>UBER *TRIP</mark> help.<mark>uber</mark>.com" {
+		t.Errorf("Expected every term to be required, got %q", got)
+	}
+	if got := search("bean", ListFilter{}); len(got) != 0 {
+		t.Errorf("Expected whole words only without *, got %q", got)
+	}
+	from := time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)
+	if got := search("coffee", ListFilter{From: &from, To: &to}); len(got) != 1 {
+		t.Errorf("Expected the date range to leave 1 match, got %q", got)
+	}
+	results, _ := service.SearchExpenses(1, "coffee", ListFilter{Limit: 1, Offset: 2})
+	if results.Total != 3 || len(results.Results) != 1 || results.Results[0].Expense.Date.Day() != 1 {
+		t.Errorf("Expected the last of 3 results, got %+v", results)
+	}
+	if _, err := service.SearchExpenses(1, ` "*" `, ListFilter{}); err != ErrEmptyQuery {
+		t.Errorf("Expected ErrEmptyQuery, got %v", err)
+	}
+
+	if got := toTSQuery(parseSearchQuery(`"uber trip" coff* x`)); got != "(uber <-> trip) & coff:* & x" {
+		t.Errorf("Expected a phrase, prefix and word tsquery, got %q", got)
+	}
+}
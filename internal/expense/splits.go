@@ -0,0 +1,402 @@
+package expense
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"fintrack/internal/common"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotParticipant       = errors.New("participant is not a member of this workspace")
+	ErrDuplicateParticipant = errors.New("each member may appear only once in a split")
+	ErrSplitTotal           = errors.New("split amounts must add up to the expense amount")
+	ErrPercentTotal         = errors.New("split percentages must add up to 100")
+	ErrZeroShares           = errors.New("at least one member must hold a share")
+	ErrSelfSettlement       = errors.New("a member cannot settle with themselves")
+)
+
+// Balance is a member's net position in one currency: positive when others
+// owe them, negative when they owe others.
+type Balance struct {
+	UserID uint         `json:"user_id"`
+	Amount common.Money `json:"amount"`
+}
+
+// Transfer is one payment that, together with the others returned, settles
+// every balance in its currency.
+type Transfer struct {
+	FromUserID uint         `json:"from_user_id"`
+	ToUserID   uint         `json:"to_user_id"`
+	Amount     common.Money `json:"amount"`
+}
+
+// CurrencyBalances holds the balances and simplified transfers for one
+// currency; amounts in different currencies are never netted.
+type CurrencyBalances struct {
+	Currency  string     `json:"currency"`
+	Balances  []Balance  `json:"balances"`
+	Transfers []Transfer `json:"transfers"`
+}
+
+// SplitExpense replaces the split of an expense. The parts are computed in
+// minor units with the largest remainder method, so they always add up to
+// the expense amount exactly.
+func (s *Service) SplitExpense(workspaceID, expenseID uint, req common.SplitRequest) ([]common.ExpenseSplit, error) {
+	var expense common.Expense
+	if err := s.db.Where("id = ? AND workspace_id = ?", expenseID, workspaceID).First(&expense).Error; err != nil {
+		return nil, err
+	}
+
+	payerID := req.PaidBy
+	if payerID == 0 {
+		payerID = expense.UserID
+	}
+
+	participants := []uint{payerID}
+	seen := map[uint]bool{}
+	for _, share := range req.Shares {
+		if seen[share.UserID] {
+			return nil, ErrDuplicateParticipant
+		}
+		seen[share.UserID] = true
+		participants = append(participants, share.UserID)
+	}
+	if err := s.requireMembers(workspaceID, participants); err != nil {
+		return nil, err
+	}
+
+	parts, err := allocateSplit(expense.Amount, req)
+	if err != nil {
+		return nil, err
+	}
+
+	splits := make([]common.ExpenseSplit, len(req.Shares))
+	for i, share := range req.Shares {
+		splits[i] = common.ExpenseSplit{
+			ExpenseID:   expense.ID,
+			WorkspaceID: workspaceID,
+			PayerID:     payerID,
+			UserID:      share.UserID,
+			Method:      req.Method,
+			Amount:      parts[i],
+		}
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("expense_id = ?", expense.ID).Delete(&common.ExpenseSplit{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&splits).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return splits, nil
+}
+
+// GetSplit returns the split of an expense, empty when it is not split.
+func (s *Service) GetSplit(workspaceID, expenseID uint) ([]common.ExpenseSplit, error) {
+	var expense common.Expense
+	if err := s.db.Select("id").Where("id = ? AND workspace_id = ?", expenseID, workspaceID).First(&expense).Error; err != nil {
+		return nil, err
+	}
+
+	var splits []common.ExpenseSplit
+	err := s.db.Where("expense_id = ?", expense.ID).Order("id").Find(&splits).Error
+	return splits, err
+}
+
+func (s *Service) DeleteSplit(workspaceID, expenseID uint) error {
+	return s.db.Where("expense_id = ? AND workspace_id = ?", expenseID, workspaceID).Delete(&common.ExpenseSplit{}).Error
+}
+
+// reallocateSplit keeps an expense's split in proportion when its amount
+// changes, so it still adds up to the new amount.
+func reallocateSplit(tx *gorm.DB, expense *common.Expense) error {
+	var splits []common.ExpenseSplit
+	if err := tx.Where("expense_id = ?", expense.ID).Order("id").Find(&splits).Error; err != nil {
+		return err
+	}
+	if len(splits) == 0 {
+		return nil
+	}
+
+	weights := make([]int64, len(splits))
+	for i, split := range splits {
+		weights[i] = split.Amount.Minor
+	}
+	parts, err := expense.Amount.Allocate(weights...)
+	if err != nil {
+		return err
+	}
+
+	for i := range splits {
+		splits[i].Amount = parts[i]
+		if err := tx.Save(&splits[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// allocateSplit divides total between req.Shares in request order.
+func allocateSplit(total common.Money, req common.SplitRequest) ([]common.Money, error) {
+	weights := make([]int64, len(req.Shares))
+	switch req.Method {
+	case common.SplitEqual:
+		return total.Split(len(req.Shares))
+
+	case common.SplitExact:
+		parts := make([]common.Money, len(req.Shares))
+		for i, share := range req.Shares {
+			amount, err := share.Amount.In(total.Currency)
+			if err != nil {
+				return nil, err
+			}
+			if amount.IsNegative() {
+				return nil, fmt.Errorf("%w: split amounts must not be negative", common.ErrInvalidAmount)
+			}
+			parts[i] = amount
+		}
+		sum, err := common.Sum(parts...)
+		if err != nil {
+			return nil, err
+		}
+		if sum.Minor != total.Minor {
+			return nil, fmt.Errorf("%w: got %s of %s", ErrSplitTotal, sum, total)
+		}
+		return parts, nil
+
+	case common.SplitPercentage:
+		var sum int64
+		for i, share := range req.Shares {
+			basisPoints, err := common.ParseMinorUnits(share.Percent.String(), 2)
+			if err != nil {
+				return nil, err
+			}
+			if basisPoints < 0 {
+				return nil, fmt.Errorf("%w: percentages must not be negative", common.ErrInvalidAmount)
+			}
+			weights[i] = basisPoints
+			sum += basisPoints
+		}
+		if sum != 10000 {
+			return nil, ErrPercentTotal
+		}
+
+	case common.SplitShares:
+		var sum int64
+		for i, share := range req.Shares {
+			weights[i] = share.Shares
+			sum += share.Shares
+		}
+		if sum == 0 {
+			return nil, ErrZeroShares
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown split method %q", req.Method)
+	}
+
+	return total.Allocate(weights...)
+}
+
+// requireMembers fails with ErrNotParticipant unless every user belongs to
+// the workspace.
+func (s *Service) requireMembers(workspaceID uint, userIDs []uint) error {
+	unique := map[uint]bool{}
+	for _, id := range userIDs {
+		unique[id] = true
+	}
+
+	var count int64
+	err := s.db.Model(&common.WorkspaceMember{}).
+		Where("workspace_id = ? AND user_id IN ?", workspaceID, userIDs).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if int(count) != len(unique) {
+		return ErrNotParticipant
+	}
+	return nil
+}
+
+func (s *Service) CreateSettlement(workspaceID, userID uint, req common.SettlementRequest) (*common.Settlement, error) {
+	if req.FromUserID == req.ToUserID {
+		return nil, ErrSelfSettlement
+	}
+	if err := s.requireMembers(workspaceID, []uint{req.FromUserID, req.ToUserID}); err != nil {
+		return nil, err
+	}
+
+	currency := strings.ToUpper(strings.TrimSpace(req.Currency))
+	if currency == "" {
+		currency = common.WorkspaceBaseCurrency(s.db, workspaceID)
+	}
+	if !common.IsCurrencyCode(currency) {
+		return nil, ErrInvalidCurrency
+	}
+	amount, err := req.Amount.In(currency)
+	if err != nil {
+		return nil, err
+	}
+	if !amount.IsPositive() {
+		return nil, ErrNonPositiveAmount
+	}
+
+	date := time.Now().UTC().Truncate(24 * time.Hour)
+	if req.Date != "" {
+		if date, err = time.Parse("2006-01-02", req.Date); err != nil {
+			return nil, err
+		}
+	}
+
+	settlement := common.Settlement{
+		WorkspaceID: workspaceID,
+		FromUserID:  req.FromUserID,
+		ToUserID:    req.ToUserID,
+		Amount:      amount,
+		Date:        date,
+		Note:        req.Note,
+		CreatedByID: userID,
+	}
+	if err := s.db.Create(&settlement).Error; err != nil {
+		return nil, err
+	}
+	return &settlement, nil
+}
+
+func (s *Service) GetSettlements(workspaceID uint) ([]common.Settlement, error) {
+	var settlements []common.Settlement
+	err := s.db.Where("workspace_id = ?", workspaceID).Order("date DESC, id DESC").Find(&settlements).Error
+	return settlements, err
+}
+
+func (s *Service) DeleteSettlement(workspaceID, settlementID uint) error {
+	result := s.db.Where("id = ? AND workspace_id = ?", settlementID, workspaceID).Delete(&common.Settlement{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// Balances nets every split and settlement in the workspace per currency and
+// proposes the fewest transfers that settle them. Members whose balance is
+// zero are left out.
+func (s *Service) Balances(workspaceID uint) ([]CurrencyBalances, error) {
+	var splits []common.ExpenseSplit
+	err := s.db.Where("workspace_id = ? AND user_id <> payer_id", workspaceID).
+		Where("expense_id IN (?)", s.db.Model(&common.Expense{}).Select("id").Where("workspace_id = ?", workspaceID)).
+		Find(&splits).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var settlements []common.Settlement
+	if err := s.db.Where("workspace_id = ?", workspaceID).Find(&settlements).Error; err != nil {
+		return nil, err
+	}
+
+	net := map[string]map[uint]int64{}
+	credit := func(currency string, userID uint, minor int64) {
+		if net[currency] == nil {
+			net[currency] = map[uint]int64{}
+		}
+		net[currency][userID] += minor
+	}
+	for _, split := range splits {
+		credit(split.Amount.Currency, split.PayerID, split.Amount.Minor)
+		credit(split.Amount.Currency, split.UserID, -split.Amount.Minor)
+	}
+	for _, settlement := range settlements {
+		credit(settlement.Amount.Currency, settlement.FromUserID, settlement.Amount.Minor)
+		credit(settlement.Amount.Currency, settlement.ToUserID, -settlement.Amount.Minor)
+	}
+
+	currencies := make([]string, 0, len(net))
+	for currency := range net {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+
+	result := make([]CurrencyBalances, 0, len(currencies))
+	for _, currency := range currencies {
+		entry := CurrencyBalances{Currency: currency, Balances: []Balance{}}
+		for userID, minor := range net[currency] {
+			if minor != 0 {
+				entry.Balances = append(entry.Balances, Balance{UserID: userID, Amount: common.NewMoney(minor, currency)})
+			}
+		}
+		if len(entry.Balances) == 0 {
+			continue
+		}
+		sort.Slice(entry.Balances, func(i, j int) bool {
+			a, b := entry.Balances[i], entry.Balances[j]
+			if a.Amount.Minor != b.Amount.Minor {
+				return a.Amount.Minor > b.Amount.Minor
+			}
+			return a.UserID < b.UserID
+		})
+		entry.Transfers = simplifyDebts(entry.Balances)
+		result = append(result, entry)
+	}
+	return result, nil
+}
+
+// simplifyDebts repeatedly lets the largest debtor pay the largest creditor
+// as much as either can, which settles n members in at most n-1 transfers.
+// balances must all be in one currency and sum to zero.
+func simplifyDebts(balances []Balance) []Transfer {
+	var creditors, debtors []Balance
+	for _, b := range balances {
+		if b.Amount.IsPositive() {
+			creditors = append(creditors, b)
+		} else if b.Amount.IsNegative() {
+			debtors = append(debtors, Balance{UserID: b.UserID, Amount: b.Amount.Neg()})
+		}
+	}
+
+	transfers := []Transfer{}
+	for len(creditors) > 0 && len(debtors) > 0 {
+		sortLargestFirst(creditors)
+		sortLargestFirst(debtors)
+
+		creditor, debtor := &creditors[0], &debtors[0]
+		minor := creditor.Amount.Minor
+		if debtor.Amount.Minor < minor {
+			minor = debtor.Amount.Minor
+		}
+		transfers = append(transfers, Transfer{
+			FromUserID: debtor.UserID,
+			ToUserID:   creditor.UserID,
+			Amount:     common.NewMoney(minor, creditor.Amount.Currency),
+		})
+		creditor.Amount.Minor -= minor
+		debtor.Amount.Minor -= minor
+
+		if creditor.Amount.IsZero() {
+			creditors = creditors[1:]
+		}
+		if debtor.Amount.IsZero() {
+			debtors = debtors[1:]
+		}
+	}
+	return transfers
+}
+
+func sortLargestFirst(balances []Balance) {
+	sort.Slice(balances, func(i, j int) bool {
+		if balances[i].Amount.Minor != balances[j].Amount.Minor {
+			return balances[i].Amount.Minor > balances[j].Amount.Minor
+		}
+		return balances[i].UserID < balances[j].UserID
+	})
+}
@@ -0,0 +1,305 @@
+package expense
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"fintrack/internal/common"
+)
+
+const (
+	FormatCSV = "csv"
+	FormatOFX = "ofx"
+)
+
+// statementLine is one transaction read from a bank statement before it is
+// validated against the user's data.
+type statementLine struct {
+	Line        int
+	Date        time.Time
+	Amount      string
+	Currency    string
+	Description string
+	Category    string
+	Errors      []string
+}
+
+// DefaultImportMapping is used until the user saves their own mapping.
+func DefaultImportMapping(userID uint) common.ImportMapping {
+	return common.ImportMapping{
+		UserID:            userID,
+		Delimiter:         ",",
+		HasHeader:         true,
+		DateColumn:        "date",
+		DateFormat:        "2006-01-02",
+		AmountColumn:      "amount",
+		DescriptionColumn: "description",
+		CategoryColumn:    "category",
+		CurrencyColumn:    "currency",
+		DefaultCategory:   "Uncategorized",
+	}
+}
+
+// DetectFormat guesses the statement format from the file name and content.
+func DetectFormat(filename string, data []byte) string {
+	lower := strings.ToLower(filename)
+	if strings.HasSuffix(lower, ".ofx") || strings.HasSuffix(lower, ".qfx") {
+		return FormatOFX
+	}
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	if bytes.Contains(bytes.ToUpper(head), []byte("<OFX>")) || bytes.Contains(head, []byte("OFXHEADER")) {
+		return FormatOFX
+	}
+	return FormatCSV
+}
+
+// parseCSVStatement reads expense lines using mapping. Rows that are income
+// under the mapping's sign convention come back with an error so the preview
+// can show why they will not be imported.
+func parseCSVStatement(r io.Reader, mapping common.ImportMapping) ([]statementLine, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	if mapping.Delimiter != "" {
+		reader.Comma = []rune(mapping.Delimiter)[0]
+	}
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, errors.New("file is empty")
+	}
+
+	var header []string
+	first := 0
+	if mapping.HasHeader {
+		header = records[0]
+		first = 1
+	}
+
+	columns := make(map[string]int)
+	for field, name := range map[string]string{
+		"date":        mapping.DateColumn,
+		"amount":      mapping.AmountColumn,
+		"debit":       mapping.DebitColumn,
+		"credit":      mapping.CreditColumn,
+		"description": mapping.DescriptionColumn,
+		"category":    mapping.CategoryColumn,
+		"currency":    mapping.CurrencyColumn,
+	} {
+		if index, ok := columnIndex(header, name); ok {
+			columns[field] = index
+		}
+	}
+	if _, ok := columns["date"]; !ok {
+		return nil, fmt.Errorf("date column %q not found", mapping.DateColumn)
+	}
+	_, hasAmount := columns["amount"]
+	_, hasDebit := columns["debit"]
+	if !hasAmount && !hasDebit {
+		return nil, fmt.Errorf("amount column %q not found", mapping.AmountColumn)
+	}
+
+	var lines []statementLine
+	for i, record := range records[first:] {
+		field := func(name string) string {
+			if index, ok := columns[name]; ok && index < len(record) {
+				return strings.TrimSpace(record[index])
+			}
+			return ""
+		}
+		if strings.Join(record, "") == "" {
+			continue
+		}
+
+		line := statementLine{
+			Line:        first + i + 1,
+			Currency:    strings.ToUpper(field("currency")),
+			Description: field("description"),
+			Category:    field("category"),
+		}
+
+		date, err := time.Parse(mapping.DateFormat, field("date"))
+		if err != nil {
+			line.Errors = append(line.Errors, fmt.Sprintf("invalid date %q", field("date")))
+		}
+		line.Date = date
+
+		amount, err := csvAmount(field, hasDebit, mapping)
+		if err != nil {
+			line.Errors = append(line.Errors, err.Error())
+		}
+		line.Amount = amount
+
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// csvAmount returns the expense amount as a positive decimal string.
+func csvAmount(field func(string) string, hasDebit bool, mapping common.ImportMapping) (string, error) {
+	if hasDebit {
+		if debit := field("debit"); debit != "" {
+			amount, negative, err := normalizeAmount(debit, mapping.DecimalComma)
+			if err != nil || negative {
+				return "", fmt.Errorf("invalid debit %q", debit)
+			}
+			return amount, nil
+		}
+		if field("credit") != "" {
+			return "", errors.New("credit rows are not expenses")
+		}
+		return "", errors.New("missing amount")
+	}
+
+	raw := field("amount")
+	amount, negative, err := normalizeAmount(raw, mapping.DecimalComma)
+	if err != nil {
+		return "", fmt.Errorf("invalid amount %q", raw)
+	}
+	if negative != mapping.NegativeIsExpense {
+		return "", errors.New("income rows are not expenses")
+	}
+	return amount, nil
+}
+
+// normalizeAmount strips currency symbols, spaces and thousands separators and
+// reports the sign separately. "(12.50)" is treated as negative.
+func normalizeAmount(raw string, decimalComma bool) (string, bool, error) {
+	s := strings.TrimSpace(raw)
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = s[1 : len(s)-1]
+	}
+	if decimalComma {
+		s = strings.ReplaceAll(s, ".", "")
+		s = strings.ReplaceAll(s, ",", ".")
+	} else {
+		s = strings.ReplaceAll(s, ",", "")
+	}
+	s = strings.Map(func(r rune) rune {
+		if (r >= '0' && r <= '9') || r == '.' || r == '-' || r == '+' {
+			return r
+		}
+		return -1
+	}, s)
+	if strings.HasPrefix(s, "-") {
+		negative = !negative
+		s = s[1:]
+	}
+	s = strings.TrimPrefix(s, "+")
+
+	if !decimalPattern.MatchString(s) {
+		return "", false, errors.New("not a number")
+	}
+	return s, negative, nil
+}
+
+func columnIndex(header []string, name string) (int, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return 0, false
+	}
+	for i, h := range header {
+		if strings.EqualFold(strings.TrimSpace(h), name) {
+			return i, true
+		}
+	}
+	if n, err := strconv.Atoi(name); err == nil && n > 0 {
+		return n - 1, true
+	}
+	return 0, false
+}
+
+var decimalPattern = regexp.MustCompile(`^(\d+(\.\d*)?|\.\d+)$`)
+
+var ofxTag = regexp.MustCompile(`<(/?)([A-Za-z0-9.]+)>([^<]*)`)
+
+// parseOFXStatement reads debit transactions from OFX/QFX, accepting both the
+// SGML (1.x, unclosed tags) and XML (2.x) dialects.
+func parseOFXStatement(data []byte) ([]statementLine, error) {
+	var (
+		lines    []statementLine
+		current  map[string]string
+		currency string
+		count    int
+	)
+
+	flush := func() {
+		if current == nil {
+			return
+		}
+		count++
+		lines = append(lines, ofxLine(count, current, currency))
+		current = nil
+	}
+
+	for _, match := range ofxTag.FindAllSubmatch(data, -1) {
+		closing := len(match[1]) > 0
+		tag := strings.ToUpper(string(match[2]))
+		value := strings.TrimSpace(string(match[3]))
+
+		switch {
+		case tag == "STMTTRN" && !closing:
+			flush()
+			current = make(map[string]string)
+		case tag == "STMTTRN" || tag == "BANKTRANLIST":
+			flush()
+		case tag == "CURDEF" && !closing:
+			currency = strings.ToUpper(value)
+		case current != nil && !closing && value != "":
+			current[tag] = value
+		}
+	}
+	flush()
+
+	if count == 0 {
+		return nil, errors.New("no transactions found in OFX file")
+	}
+	return lines, nil
+}
+
+func ofxLine(n int, fields map[string]string, currency string) statementLine {
+	line := statementLine{Line: n, Currency: currency}
+
+	description := fields["NAME"]
+	if memo := fields["MEMO"]; memo != "" && memo != description {
+		description = strings.TrimSpace(description + " " + memo)
+	}
+	line.Description = description
+
+	posted := fields["DTPOSTED"]
+	if len(posted) >= 8 {
+		date, err := time.Parse("20060102", posted[:8])
+		if err == nil {
+			line.Date = date
+		}
+	}
+	if line.Date.IsZero() {
+		line.Errors = append(line.Errors, fmt.Sprintf("invalid date %q", posted))
+	}
+
+	amount, negative, err := normalizeAmount(fields["TRNAMT"], false)
+	switch {
+	case err != nil:
+		line.Errors = append(line.Errors, fmt.Sprintf("invalid amount %q", fields["TRNAMT"]))
+	case !negative:
+		line.Errors = append(line.Errors, "credit rows are not expenses")
+	default:
+		line.Amount = amount
+	}
+
+	return line
+}
@@ -0,0 +1,115 @@
+package expense
+
+import (
+	"errors"
+	"strings"
+	"fintrack/internal/category"
+	"fintrack/internal/common"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	defaultTagSuggestions = 10
+	maxTagSuggestions     = 50
+)
+
+// TagSuggestion is a tag offered for autocompletion with the number of the
+// workspace's expenses carrying it.
+type TagSuggestion struct {
+	Name  string `json:"name"`
+	Count int64  `json:"count"`
+}
+
+// SuggestTags returns the workspace's tags in use on expenses that are not
+// deleted that contain query, those starting with it first and then the most
+// used. An empty query lists the most used tags.
+func (s *Service) SuggestTags(workspaceID uint, query string, limit int) ([]TagSuggestion, error) {
+	if limit <= 0 {
+		limit = defaultTagSuggestions
+	} else if limit > maxTagSuggestions {
+		limit = maxTagSuggestions
+	}
+	key := escapeLike(strings.ToLower(category.Normalize(query)))
+
+	suggestions := []TagSuggestion{}
+	err := s.db.Raw(`SELECT tags.name, COUNT(*) AS count
+		FROM tags JOIN expense_tags ON expense_tags.tag_id = tags.id
+		JOIN expenses ON expenses.id = expense_tags.expense_id
+		WHERE tags.workspace_id = ? AND tags.name_key LIKE ? ESCAPE '\' AND expenses.deleted_at IS NULL
+		GROUP BY tags.id, tags.name, tags.name_key
+		ORDER BY CASE WHEN tags.name_key LIKE ? ESCAPE '\' THEN 0 ELSE 1 END, count DESC, tags.name_key
+		LIMIT ?`,
+		workspaceID, "%"+key+"%", key+"%", limit,
+	).Scan(&suggestions).Error
+	return suggestions, err
+}
+
+// resolveTags returns the workspace's tags named names, adding unknown ones.
+// Names are normalized like category names and repeats are dropped.
+func resolveTags(db *gorm.DB, workspaceID uint, names []string) ([]common.Tag, error) {
+	tags := []common.Tag{}
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = category.Normalize(name)
+		key := strings.ToLower(name)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		tag, err := resolveTag(db, workspaceID, name, key)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, *tag)
+	}
+	return tags, nil
+}
+
+// resolveTag returns the workspace's tag with key, adding it as name when
+// there is none.
+func resolveTag(db *gorm.DB, workspaceID uint, name, key string) (*common.Tag, error) {
+	var tag common.Tag
+	err := db.Where("workspace_id = ? AND name_key = ?", workspaceID, key).First(&tag).Error
+	if err == nil {
+		return &tag, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	tag = common.Tag{WorkspaceID: workspaceID, Name: name, NameKey: key}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&tag)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		// Created concurrently.
+		tag = common.Tag{}
+		if err := db.Where("workspace_id = ? AND name_key = ?", workspaceID, key).First(&tag).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &tag, nil
+}
+
+// setTags replaces the tags of expense with names.
+func setTags(tx *gorm.DB, expense *common.Expense, names []string) error {
+	tags, err := resolveTags(tx, expense.WorkspaceID, names)
+	if err != nil {
+		return err
+	}
+
+	association := tx.Model(expense).Association("Tags")
+	if len(tags) == 0 {
+		err = association.Clear()
+	} else {
+		err = association.Replace(tags)
+	}
+	if err != nil {
+		return err
+	}
+	expense.Tags = tags
+	return nil
+}
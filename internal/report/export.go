@@ -0,0 +1,67 @@
+package report
+
+import (
+	"encoding/json"
+	"time"
+	"fintrack/internal/common"
+	"fintrack/pkg/export"
+)
+
+var exportHeader = []interface{}{"id", "type", "period", "currency", "total_expenses", "expense_count", "created_at", "data"}
+
+// ExportReports writes the user's stored reports to w, streaming rows from the
+// database. An empty reportType exports every type.
+func (s *Service) ExportReports(workspaceID uint, reportType string, w export.Writer) error {
+	query := s.db.Model(&common.Report{}).Where("workspace_id = ?", workspaceID)
+	if reportType != "" {
+		query = query.Where("type = ?", reportType)
+	}
+
+	rows, err := query.Order("period DESC, id DESC").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if err := w.Write(exportHeader); err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var report common.Report
+		if err := s.db.ScanRows(rows, &report); err != nil {
+			return err
+		}
+
+		// Only the summary fields are lifted into columns; the full data
+		// stays in the last one.
+		var summary struct {
+			TotalExpenses json.Number `json:"total_expenses"`
+			Currency      string      `json:"currency"`
+			ExpenseCount  int64       `json:"expense_count"`
+		}
+		var total interface{}
+		data := export.JSON("null")
+		if json.Unmarshal([]byte(report.Data), &summary) == nil {
+			data = export.JSON(report.Data)
+			if summary.TotalExpenses != "" {
+				total = export.Number(summary.TotalExpenses)
+			}
+		}
+
+		err := w.Write([]interface{}{
+			report.ID,
+			report.Type,
+			report.Period,
+			summary.Currency,
+			total,
+			summary.ExpenseCount,
+			report.CreatedAt.UTC().Format(time.RFC3339),
+			data,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
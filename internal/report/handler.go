@@ -1,11 +1,17 @@
 package report
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"path"
 	"strconv"
 	"time"
+	"fintrack/internal/common"
+	"fintrack/pkg/export"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 type Handler struct {
@@ -21,8 +27,6 @@ func NewHandler(service *Service, logger *zap.Logger) *Handler {
 }
 
 func (h *Handler) GetMonthlyReport(c *gin.Context) {
-	userID := c.GetUint("user_id")
-	
 	yearStr := c.DefaultQuery("year", strconv.Itoa(time.Now().Year()))
 	monthStr := c.DefaultQuery("month", strconv.Itoa(int(time.Now().Month())))
 	
@@ -38,21 +42,154 @@ func (h *Handler) GetMonthlyReport(c *gin.Context) {
 		return
 	}
 
-	report, err := h.service.GenerateMonthlyReport(userID, year, month)
+	h.respondWithReport(c, MonthlyPeriod(year, month))
+}
+
+func (h *Handler) GetQuarterlyReport(c *gin.Context) {
+	now := time.Now()
+
+	year, err := strconv.Atoi(c.DefaultQuery("year", strconv.Itoa(now.Year())))
 	if err != nil {
-		h.logger.Error("Failed to generate monthly report", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid year"})
+		return
+	}
+
+	quarter, err := strconv.Atoi(c.DefaultQuery("quarter", strconv.Itoa((int(now.Month())-1)/3+1)))
+	if err != nil || quarter < 1 || quarter > 4 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quarter"})
+		return
+	}
+
+	h.respondWithReport(c, QuarterlyPeriod(year, quarter))
+}
+
+func (h *Handler) GetAnnualReport(c *gin.Context) {
+	year, err := strconv.Atoi(c.DefaultQuery("year", strconv.Itoa(time.Now().Year())))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid year"})
+		return
+	}
+
+	h.respondWithReport(c, AnnualPeriod(year))
+}
+
+func (h *Handler) GetWeeklyReport(c *gin.Context) {
+	currentYear, currentWeek := time.Now().ISOWeek()
+
+	year, err := strconv.Atoi(c.DefaultQuery("year", strconv.Itoa(currentYear)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid year"})
+		return
+	}
+
+	week, err := strconv.Atoi(c.DefaultQuery("week", strconv.Itoa(currentWeek)))
+	if err != nil || week < 1 || week > 53 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid week"})
+		return
+	}
+
+	period, err := WeeklyPeriod(year, week)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.respondWithReport(c, period)
+}
+
+func (h *Handler) GetRangeReport(c *gin.Context) {
+	from, err := time.Parse("2006-01-02", c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date"})
+		return
+	}
+
+	to, err := time.Parse("2006-01-02", c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date"})
+		return
+	}
+
+	period, err := RangePeriod(from, to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.respondWithReport(c, period)
+}
+
+// respondWithReport answers with the report for period when it is up to date
+// and otherwise with 202 and the job queued to build it.
+func (h *Handler) respondWithReport(c *gin.Context, period Period) {
+	report, job, err := h.service.RequestReport(c.GetUint("workspace_id"), c.GetUint("user_id"), period)
+	if err != nil {
+		h.logger.Error("Failed to request report", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, report)
+	if report != nil {
+		c.JSON(http.StatusOK, report)
+		return
+	}
+	c.Header("Location", fmt.Sprintf("%s/jobs/%d", path.Dir(c.FullPath()), job.ID))
+	c.JSON(http.StatusAccepted, gin.H{"job": job})
 }
 
-func (h *Handler) GetReports(c *gin.Context) {
+func (h *Handler) CreateReportJob(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
 	userID := c.GetUint("user_id")
+
+	var req common.ReportJobRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	period, err := PeriodFor(req, time.Now())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := h.service.EnqueueReport(workspaceID, userID, period)
+	if err != nil {
+		h.logger.Error("Failed to enqueue report", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
+
+func (h *Handler) GetReportJob(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+	jobID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	job, err := h.service.GetJob(workspaceID, uint(jobID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to get report job", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+func (h *Handler) GetReports(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
 	reportType := c.DefaultQuery("type", "monthly")
 
-	reports, err := h.service.GetReports(userID, reportType)
+	reports, err := h.service.GetReports(workspaceID, reportType)
 	if err != nil {
 		h.logger.Error("Failed to get reports", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -62,7 +199,41 @@ func (h *Handler) GetReports(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"reports": reports})
 }
 
+func (h *Handler) ExportReports(c *gin.Context) {
+	workspaceID := c.GetUint("workspace_id")
+
+	format := c.DefaultQuery("format", export.FormatCSV)
+	if !export.Supported(format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": export.ErrUnsupportedFormat.Error()})
+		return
+	}
+
+	c.Header("Content-Type", export.ContentType(format))
+	c.Header("Content-Disposition", `attachment; filename="reports.`+format+`"`)
+	c.Status(http.StatusOK)
+
+	w, err := export.NewWriter(format, c.Writer)
+	if err != nil {
+		h.logger.Error("Failed to export reports", zap.Error(err))
+		return
+	}
+	if err := h.service.ExportReports(workspaceID, c.Query("type"), w); err != nil {
+		h.logger.Error("Failed to export reports", zap.Error(err))
+		return
+	}
+	if err := w.Close(); err != nil {
+		h.logger.Error("Failed to export reports", zap.Error(err))
+	}
+}
+
 func (h *Handler) SetupRoutes(router *gin.RouterGroup) {
+	router.GET("/weekly", h.GetWeeklyReport)
 	router.GET("/monthly", h.GetMonthlyReport)
+	router.GET("/quarterly", h.GetQuarterlyReport)
+	router.GET("/annual", h.GetAnnualReport)
+	router.GET("/range", h.GetRangeReport)
 	router.GET("", h.GetReports)
-}
\ No newline at end of file
+	router.POST("", h.CreateReportJob)
+	router.GET("/jobs/:id", h.GetReportJob)
+	router.GET("/export", h.ExportReports)
+}
@@ -0,0 +1,55 @@
+package report
+
+import (
+	"time"
+	"fintrack/internal/common"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// Invalidator marks stored reports stale when an expense they cover changes,
+// so the next request regenerates them. It implements expense.ChangeListener
+// and runs inside the expense service.
+type Invalidator struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+func NewInvalidator(db *gorm.DB, logger *zap.Logger) *Invalidator {
+	return &Invalidator{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (i *Invalidator) ExpenseChanged(userID uint, before, after *common.Expense) {
+	var workspaceID uint
+	var dates []time.Time
+	for _, e := range []*common.Expense{before, after} {
+		if e != nil {
+			workspaceID = e.WorkspaceID
+			dates = append(dates, e.Date)
+		}
+	}
+
+	if err := i.invalidate(workspaceID, dates); err != nil {
+		i.logger.Error("Failed to invalidate reports", zap.Uint("workspace_id", workspaceID), zap.Error(err))
+	}
+}
+
+func (i *Invalidator) invalidate(workspaceID uint, dates []time.Time) error {
+	return i.db.Transaction(func(tx *gorm.DB) error {
+		if err := common.BumpExpenseVersion(tx, workspaceID); err != nil {
+			return err
+		}
+		for _, date := range dates {
+			err := tx.Model(&common.Report{}).
+				Where("workspace_id = ? AND source_from <= ? AND source_to > ?", workspaceID, date, date).
+				Update("stale", true).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,133 @@
+package report
+
+import (
+	"errors"
+	"time"
+	"fintrack/internal/common"
+	"gorm.io/gorm"
+)
+
+const (
+	// jobLease is how long a running job may go without finishing before
+	// another worker assumes its owner died and takes it over.
+	jobLease = 5 * time.Minute
+
+	// retryBackoff is the delay before the first retry; it doubles after each
+	// further failure.
+	retryBackoff = 10 * time.Second
+)
+
+// EnqueueReport queues a job for userID to build the workspace's report for
+// period. A job already waiting or running for the same report is returned
+// instead of a new one.
+func (s *Service) EnqueueReport(workspaceID, userID uint, period Period) (*common.ReportJob, error) {
+	var job common.ReportJob
+	err := s.db.Where("workspace_id = ? AND type = ? AND period = ? AND status IN ?",
+		workspaceID, period.Type, period.Name, []string{common.ReportJobPending, common.ReportJobRunning}).
+		First(&job).Error
+	if err == nil {
+		return &job, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	job = common.ReportJob{
+		WorkspaceID: workspaceID,
+		UserID:      userID,
+		Type:        period.Type,
+		Period:      period.Name,
+		PeriodStart: period.Start,
+		PeriodEnd:   period.End,
+		Status:      common.ReportJobPending,
+		RunAfter:    time.Now().UTC(),
+	}
+	if err := s.db.Create(&job).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// RequestReport returns the stored report for period if it is up to date and
+// otherwise queues a job to build it.
+func (s *Service) RequestReport(workspaceID, userID uint, period Period) (*common.Report, *common.ReportJob, error) {
+	report, err := s.freshReport(workspaceID, period)
+	if err != nil || report != nil {
+		return report, nil, err
+	}
+
+	job, err := s.EnqueueReport(workspaceID, userID, period)
+	return nil, job, err
+}
+
+func (s *Service) GetJob(workspaceID, jobID uint) (*common.ReportJob, error) {
+	var job common.ReportJob
+	if err := s.db.Where("id = ? AND workspace_id = ?", jobID, workspaceID).First(&job).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// claimJob marks the next due job as running and returns it, or nil when the
+// queue is empty. Workers race on the attempt count, so each job is claimed
+// by exactly one of them.
+func (s *Service) claimJob(now time.Time) (*common.ReportJob, error) {
+	for {
+		var job common.ReportJob
+		err := s.db.Where("(status = ? AND run_after <= ?) OR (status = ? AND started_at < ?)",
+			common.ReportJobPending, now, common.ReportJobRunning, now.Add(-jobLease)).
+			Order("run_after, id").
+			First(&job).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		result := s.db.Model(&common.ReportJob{}).
+			Where("id = ? AND status = ? AND attempts = ?", job.ID, job.Status, job.Attempts).
+			Updates(map[string]interface{}{
+				"status":     common.ReportJobRunning,
+				"attempts":   job.Attempts + 1,
+				"started_at": now,
+			})
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected == 1 {
+			job.Status = common.ReportJobRunning
+			job.Attempts++
+			job.StartedAt = &now
+			return &job, nil
+		}
+	}
+}
+
+// runJob builds the job's report and records the outcome, scheduling a retry
+// while attempts remain.
+func (s *Service) runJob(job *common.ReportJob, maxAttempts int) error {
+	period := Period{Type: job.Type, Name: job.Period, Start: job.PeriodStart, End: job.PeriodEnd}
+	report, err := s.generateReport(job.WorkspaceID, job.UserID, period)
+
+	now := time.Now().UTC()
+	updates := map[string]interface{}{"finished_at": now}
+	switch {
+	case err == nil:
+		updates["status"] = common.ReportJobDone
+		updates["report_id"] = report.ID
+		updates["error"] = ""
+	case job.Attempts >= maxAttempts:
+		updates["status"] = common.ReportJobFailed
+		updates["error"] = err.Error()
+	default:
+		updates["status"] = common.ReportJobPending
+		updates["error"] = err.Error()
+		updates["run_after"] = now.Add(retryBackoff << (job.Attempts - 1))
+	}
+
+	if updateErr := s.db.Model(job).Updates(updates).Error; updateErr != nil {
+		return updateErr
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+package report
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+	"fintrack/internal/common"
+)
+
+// Period is the window a report covers. End is exclusive.
+type Period struct {
+	Type  string
+	Name  string
+	Start time.Time
+	End   time.Time
+}
+
+func MonthlyPeriod(year, month int) Period {
+	start := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+	return Period{TypeMonthly, fmt.Sprintf("%d-%02d", year, month), start, start.AddDate(0, 1, 0)}
+}
+
+func QuarterlyPeriod(year, quarter int) Period {
+	start := time.Date(year, time.Month((quarter-1)*3+1), 1, 0, 0, 0, 0, time.UTC)
+	return Period{TypeQuarterly, fmt.Sprintf("%d-Q%d", year, quarter), start, start.AddDate(0, 3, 0)}
+}
+
+func AnnualPeriod(year int) Period {
+	start := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+	return Period{TypeAnnual, strconv.Itoa(year), start, start.AddDate(1, 0, 0)}
+}
+
+// WeeklyPeriod is ISO 8601 week of year (weeks start on Monday; week 1
+// contains January 4th).
+func WeeklyPeriod(year, week int) (Period, error) {
+	jan4 := time.Date(year, 1, 4, 0, 0, 0, 0, time.UTC)
+	start := jan4.AddDate(0, 0, -((int(jan4.Weekday())+6)%7)+(week-1)*7)
+	if y, w := start.ISOWeek(); y != year || w != week {
+		return Period{}, ErrInvalidWeek
+	}
+	return Period{TypeWeekly, fmt.Sprintf("%d-W%02d", year, week), start, start.AddDate(0, 0, 7)}, nil
+}
+
+// maxRangeYears bounds custom ranges, which are summarized month by month
+// and stored as a report each.
+const maxRangeYears = 10
+
+// RangePeriod covers the days from through to, both inclusive, spanning at
+// most maxRangeYears.
+func RangePeriod(from, to time.Time) (Period, error) {
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	end := to.AddDate(0, 0, 1)
+	if to.Before(from) || end.After(from.AddDate(maxRangeYears, 0, 0)) {
+		return Period{}, ErrInvalidRange
+	}
+	name := from.Format("2006-01-02") + ".." + to.Format("2006-01-02")
+	return Period{TypeRange, name, from, end}, nil
+}
+
+// PeriodFor resolves a job request. Fields left zero default to the period
+// containing now.
+func PeriodFor(req common.ReportJobRequest, now time.Time) (Period, error) {
+	year := req.Year
+	if year == 0 {
+		year = now.Year()
+	}
+
+	switch req.Type {
+	case TypeWeekly:
+		week := req.Week
+		if req.Year == 0 && week == 0 {
+			year, week = now.ISOWeek()
+		}
+		return WeeklyPeriod(year, week)
+	case TypeMonthly:
+		month := req.Month
+		if month == 0 {
+			month = int(now.Month())
+		}
+		if month < 1 || month > 12 {
+			return Period{}, ErrInvalidPeriod
+		}
+		return MonthlyPeriod(year, month), nil
+	case TypeQuarterly:
+		quarter := req.Quarter
+		if quarter == 0 {
+			quarter = (int(now.Month())-1)/3 + 1
+		}
+		if quarter < 1 || quarter > 4 {
+			return Period{}, ErrInvalidPeriod
+		}
+		return QuarterlyPeriod(year, quarter), nil
+	case TypeAnnual:
+		return AnnualPeriod(year), nil
+	case TypeRange:
+		from, err := time.Parse("2006-01-02", req.From)
+		if err != nil {
+			return Period{}, ErrInvalidRange
+		}
+		to, err := time.Parse("2006-01-02", req.To)
+		if err != nil {
+			return Period{}, ErrInvalidRange
+		}
+		return RangePeriod(from, to)
+	}
+	return Period{}, ErrInvalidPeriod
+}
+
+// previous returns the period of the same kind immediately before p; ranges
+// are compared with a window of the same length.
+func (p Period) previous() (time.Time, time.Time) {
+	switch p.Type {
+	case TypeMonthly:
+		return p.Start.AddDate(0, -1, 0), p.Start
+	case TypeQuarterly:
+		return p.Start.AddDate(0, -3, 0), p.Start
+	case TypeAnnual:
+		return p.Start.AddDate(-1, 0, 0), p.Start
+	}
+	days := int((p.End.Unix() - p.Start.Unix()) / (24 * 60 * 60))
+	return p.Start.AddDate(0, 0, -days), p.Start
+}
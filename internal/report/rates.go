@@ -0,0 +1,107 @@
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+	"fintrack/internal/common"
+	"gorm.io/gorm/clause"
+)
+
+// LoadExchangeRatesFile loads a CSV file of exchange rates; see LoadExchangeRates.
+func (s *Service) LoadExchangeRatesFile(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return s.LoadExchangeRates(f)
+}
+
+// LoadExchangeRates reads CSV with a header row naming the columns date, base,
+// quote and rate (in any order) and upserts every row. A row means one unit of
+// base was worth rate units of quote on date (YYYY-MM-DD).
+func (s *Service) LoadExchangeRates(r io.Reader) (int, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return 0, fmt.Errorf("reading header: %w", err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"date", "base", "quote", "rate"} {
+		if _, ok := columns[name]; !ok {
+			return 0, fmt.Errorf("missing %q column", name)
+		}
+	}
+
+	var rates []common.ExchangeRate
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		rate, err := parseRateRecord(record, columns)
+		if err != nil {
+			return 0, fmt.Errorf("line %d: %w", line, err)
+		}
+		rates = append(rates, rate)
+	}
+	if len(rates) == 0 {
+		return 0, nil
+	}
+
+	err = s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "base"}, {Name: "quote"}, {Name: "date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "updated_at"}),
+	}).CreateInBatches(&rates, 500).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return len(rates), nil
+}
+
+func parseRateRecord(record []string, columns map[string]int) (common.ExchangeRate, error) {
+	field := func(name string) string {
+		if i := columns[name]; i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	date, err := time.Parse("2006-01-02", field("date"))
+	if err != nil {
+		return common.ExchangeRate{}, fmt.Errorf("invalid date: %w", err)
+	}
+
+	base, quote := strings.ToUpper(field("base")), strings.ToUpper(field("quote"))
+	if !common.IsCurrencyCode(base) || !common.IsCurrencyCode(quote) {
+		return common.ExchangeRate{}, fmt.Errorf("invalid currency pair %q/%q", base, quote)
+	}
+
+	rate, ok := new(big.Rat).SetString(field("rate"))
+	if !ok || rate.Sign() <= 0 {
+		return common.ExchangeRate{}, fmt.Errorf("invalid rate %q", field("rate"))
+	}
+
+	return common.ExchangeRate{
+		Base:  base,
+		Quote: quote,
+		Date:  date,
+		Rate:  field("rate"),
+	}, nil
+}
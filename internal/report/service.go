@@ -3,9 +3,12 @@ package report
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"sort"
 	"time"
+	"fintrack/internal/category"
 	"fintrack/internal/common"
+	"fintrack/pkg/notify"
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
@@ -17,11 +20,78 @@ type Service struct {
 	logger *zap.Logger
 }
 
+const (
+	TypeWeekly    = "weekly"
+	TypeMonthly   = "monthly"
+	TypeQuarterly = "quarterly"
+	TypeAnnual    = "annual"
+	TypeRange     = "range"
+
+	largestExpenseCount = 5
+)
+
+var (
+	ErrInvalidRange  = errors.New("range end must not be before its start and the range must span at most 10 years")
+	ErrInvalidWeek   = errors.New("year has no such ISO week")
+	ErrInvalidPeriod = errors.New("invalid report period")
+)
+
+// ReportData is stored as a report's data. From and To are inclusive dates and
+// all amounts are in Currency.
 type ReportData struct {
-	TotalExpenses float64            `json:"total_expenses"`
-	ExpenseCount  int64              `json:"expense_count"`
-	Categories    map[string]float64 `json:"categories"`
-	Period        string             `json:"period"`
+	TotalExpenses common.Money            `json:"total_expenses"`
+	Currency      string                  `json:"currency"`
+	ExpenseCount  int64                   `json:"expense_count"`
+	Categories    map[string]common.Money `json:"categories"`
+	// ParentCategories rolls Categories up into their top-level categories.
+	ParentCategories map[string]common.Money `json:"parent_categories"`
+	// Tags totals tagged expenses per tag; an expense counts toward each of
+	// its tags, so tag totals may add up to more than TotalExpenses.
+	Tags            map[string]common.Money `json:"tags"`
+	Period          string                  `json:"period"`
+	From            string                  `json:"from"`
+	To              string                  `json:"to"`
+	Months          []MonthTotal            `json:"months"`
+	DailyAverage    common.Money            `json:"daily_average"`
+	LargestExpenses []LargestExpense        `json:"largest_expenses"`
+	Previous        *Comparison             `json:"previous,omitempty"`
+	Unconverted     []UnconvertedExpense    `json:"unconverted,omitempty"`
+}
+
+type MonthTotal struct {
+	Month string       `json:"month"`
+	Total common.Money `json:"total"`
+	Count int          `json:"count"`
+}
+
+type LargestExpense struct {
+	ExpenseID        uint         `json:"expense_id"`
+	Date             time.Time    `json:"date"`
+	Description      string       `json:"description"`
+	Category         string       `json:"category"`
+	Amount           common.Money `json:"amount"`
+	OriginalAmount   common.Money `json:"original_amount"`
+	OriginalCurrency string       `json:"original_currency"`
+}
+
+// Comparison summarises the previous equivalent period. ChangePercent is
+// omitted when nothing was spent in it.
+type Comparison struct {
+	From          string       `json:"from"`
+	To            string       `json:"to"`
+	TotalExpenses common.Money `json:"total_expenses"`
+	Change        common.Money `json:"change"`
+	ChangePercent *float64     `json:"change_percent,omitempty"`
+}
+
+// UnconvertedExpense is an expense left out of the totals because no exchange
+// rate into the base currency was available for its date.
+type UnconvertedExpense struct {
+	ExpenseID uint         `json:"expense_id"`
+	Amount    common.Money `json:"amount"`
+	Currency  string       `json:"currency"`
+	Date      time.Time    `json:"date"`
+	Reason    string       `json:"reason"`
 }
 
 func NewService(db *gorm.DB, redis *redis.Client, logger *zap.Logger) *Service {
@@ -32,99 +102,280 @@ func NewService(db *gorm.DB, redis *redis.Client, logger *zap.Logger) *Service {
 	}
 }
 
-func (s *Service) GenerateMonthlyReport(userID uint, year int, month int) (*common.Report, error) {
-	period := fmt.Sprintf("%d-%02d", year, month)
-	
-	// Check if report already exists
-	var existingReport common.Report
-	if err := s.db.Where("user_id = ? AND type = ? AND period = ?", userID, "monthly", period).First(&existingReport).Error; err == nil {
-		return &existingReport, nil
+func (s *Service) GenerateMonthlyReport(workspaceID, userID uint, year int, month int) (*common.Report, error) {
+	return s.generateReport(workspaceID, userID, MonthlyPeriod(year, month))
+}
+
+func (s *Service) GenerateQuarterlyReport(workspaceID, userID uint, year, quarter int) (*common.Report, error) {
+	return s.generateReport(workspaceID, userID, QuarterlyPeriod(year, quarter))
+}
+
+func (s *Service) GenerateAnnualReport(workspaceID, userID uint, year int) (*common.Report, error) {
+	return s.generateReport(workspaceID, userID, AnnualPeriod(year))
+}
+
+func (s *Service) GenerateWeeklyReport(workspaceID, userID uint, year, week int) (*common.Report, error) {
+	period, err := WeeklyPeriod(year, week)
+	if err != nil {
+		return nil, err
+	}
+	return s.generateReport(workspaceID, userID, period)
+}
+
+func (s *Service) GenerateRangeReport(workspaceID, userID uint, from, to time.Time) (*common.Report, error) {
+	period, err := RangePeriod(from, to)
+	if err != nil {
+		return nil, err
 	}
+	return s.generateReport(workspaceID, userID, period)
+}
 
-	// Generate report in background
-	reportChan := make(chan *ReportData, 1)
-	errorChan := make(chan error, 1)
+// freshReport returns the workspace's stored report for period, or nil if
+// there is none or expenses it covers changed since it was built.
+func (s *Service) freshReport(workspaceID uint, period Period) (*common.Report, error) {
+	var report common.Report
+	err := s.db.Where("workspace_id = ? AND type = ? AND period = ?", workspaceID, period.Type, period.Name).First(&report).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// Reports stored before staleness tracking have no generation time.
+	if report.Stale || report.GeneratedAt.IsZero() {
+		return nil, nil
+	}
+	return &report, nil
+}
 
-	go s.generateReportData(userID, year, month, "monthly", reportChan, errorChan)
+// generateReport returns the workspace's stored report for period,
+// regenerating it for userID when expenses it covers changed since it was
+// built.
+func (s *Service) generateReport(workspaceID, userID uint, period Period) (*common.Report, error) {
+	if report, err := s.freshReport(workspaceID, period); err != nil || report != nil {
+		return report, err
+	}
 
-	select {
-	case reportData := <-reportChan:
-		dataJSON, _ := json.Marshal(reportData)
-		
-		report := common.Report{
-			UserID: userID,
-			Type:   "monthly",
-			Period: period,
-			Data:   string(dataJSON),
-		}
+	version, err := common.ExpenseVersionOf(s.db, workspaceID)
+	if err != nil {
+		return nil, err
+	}
 
-		if err := s.db.Create(&report).Error; err != nil {
-			return nil, err
+	reportData, err := s.generateReportData(workspaceID, period)
+	if err != nil {
+		return nil, err
+	}
+	dataJSON, _ := json.Marshal(reportData)
+
+	var report common.Report
+	err = s.db.Where("workspace_id = ? AND type = ? AND period = ?", workspaceID, period.Type, period.Name).First(&report).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	sourceFrom, _ := period.previous()
+	report.WorkspaceID = workspaceID
+	report.UserID = userID
+	report.Type = period.Type
+	report.Period = period.Name
+	report.Data = string(dataJSON)
+	report.SourceFrom = sourceFrom
+	report.SourceTo = period.End
+	report.SourceVersion = version
+	report.Stale = false
+	report.GeneratedAt = time.Now().UTC()
+
+	if err := s.db.Save(&report).Error; err != nil {
+		return nil, err
+	}
+
+	// An expense written while generating may be missing from the data.
+	if current, err := common.ExpenseVersionOf(s.db, workspaceID); err == nil && current != version {
+		if err := s.db.Model(&report).Update("stale", true).Error; err == nil {
+			report.Stale = true
 		}
+	}
 
-		// Publish notification
-		s.publishNotification(userID, "monthly_report_generated", period)
-		
-		return &report, nil
-	case err := <-errorChan:
+	// Publish notification
+	s.publishNotification(userID, period.Type+"_report_generated", period.Name)
+
+	return &report, nil
+}
+
+func (s *Service) generateReportData(workspaceID uint, period Period) (*ReportData, error) {
+	baseCurrency := common.WorkspaceBaseCurrency(s.db, workspaceID)
+	converter := common.NewConverter(s.db)
+
+	reportData, err := s.summarize(workspaceID, period.Start, period.End, baseCurrency, converter)
+	if err != nil {
+		return nil, err
+	}
+	reportData.Period = period.Name
+
+	prevStart, prevEnd := period.previous()
+	previous, err := s.summarize(workspaceID, prevStart, prevEnd, baseCurrency, converter)
+	if err != nil {
+		return nil, err
+	}
+	if reportData.Previous, err = compare(reportData.TotalExpenses, previous); err != nil {
 		return nil, err
-	case <-time.After(30 * time.Second):
-		return nil, fmt.Errorf("report generation timeout")
 	}
+
+	return reportData, nil
 }
 
-func (s *Service) generateReportData(userID uint, year, month int, reportType string, reportChan chan<- *ReportData, errorChan chan<- error) {
+// summarize totals the workspace's expenses in [start, end) in baseCurrency.
+func (s *Service) summarize(workspaceID uint, start, end time.Time, baseCurrency string, converter *common.Converter) (*ReportData, error) {
 	var expenses []common.Expense
-	var total float64
-	var count int64
-	categories := make(map[string]float64)
-
-	startDate := time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
-	endDate := startDate.AddDate(0, 1, 0)
+	if err := s.db.Preload("Tags").Where("workspace_id = ? AND date >= ? AND date < ?", workspaceID, start, end).Find(&expenses).Error; err != nil {
+		return nil, err
+	}
 
-	query := s.db.Where("user_id = ? AND date >= ? AND date < ?", userID, startDate, endDate)
-	
-	if err := query.Find(&expenses).Error; err != nil {
-		errorChan <- err
-		return
+	roots, err := category.RootNames(s.db, workspaceID)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := query.Count(&count).Error; err != nil {
-		errorChan <- err
-		return
+	total := common.Zero(baseCurrency)
+	categories := make(map[string]common.Money)
+	parents := make(map[string]common.Money)
+	tags := make(map[string]common.Money)
+	months := make(map[string]*MonthTotal)
+	var breakdown []MonthTotal
+	for month := time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC); month.Before(end); month = month.AddDate(0, 1, 0) {
+		breakdown = append(breakdown, MonthTotal{Month: month.Format("2006-01"), Total: common.Zero(baseCurrency)})
+	}
+	for i := range breakdown {
+		months[breakdown[i].Month] = &breakdown[i]
 	}
 
+	var unconverted []UnconvertedExpense
+	var largest []LargestExpense
+
 	for _, expense := range expenses {
-		total += expense.Amount
-		categories[expense.Category] += expense.Amount
+		amount, err := converter.Convert(expense.Amount, baseCurrency, expense.Date)
+		if errors.Is(err, common.ErrRateNotFound) {
+			unconverted = append(unconverted, UnconvertedExpense{
+				ExpenseID: expense.ID,
+				Amount:    expense.Amount,
+				Currency:  expense.Amount.Currency,
+				Date:      expense.Date,
+				Reason:    err.Error(),
+			})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if total, err = total.Add(amount); err != nil {
+			return nil, err
+		}
+		if categories[expense.Category], err = categories[expense.Category].Add(amount); err != nil {
+			return nil, err
+		}
+		parent := expense.Category
+		if expense.CategoryID != nil && roots[*expense.CategoryID] != "" {
+			parent = roots[*expense.CategoryID]
+		}
+		if parents[parent], err = parents[parent].Add(amount); err != nil {
+			return nil, err
+		}
+		for _, tag := range expense.Tags {
+			if tags[tag.Name], err = tags[tag.Name].Add(amount); err != nil {
+				return nil, err
+			}
+		}
+		if month := months[expense.Date.Format("2006-01")]; month != nil {
+			if month.Total, err = month.Total.Add(amount); err != nil {
+				return nil, err
+			}
+			month.Count++
+		}
+
+		largest = append(largest, LargestExpense{
+			ExpenseID:        expense.ID,
+			Date:             expense.Date,
+			Description:      expense.Description,
+			Category:         expense.Category,
+			Amount:           amount,
+			OriginalAmount:   expense.Amount,
+			OriginalCurrency: expense.Amount.Currency,
+		})
 	}
 
-	reportData := &ReportData{
-		TotalExpenses: total,
-		ExpenseCount:  count,
-		Categories:    categories,
-		Period:        fmt.Sprintf("%d-%02d", year, month),
+	sort.SliceStable(largest, func(i, j int) bool {
+		return largest[i].Amount.Minor > largest[j].Amount.Minor
+	})
+	if len(largest) > largestExpenseCount {
+		largest = largest[:largestExpenseCount]
 	}
 
-	reportChan <- reportData
+	days := int64(end.Sub(start).Hours() / 24)
+	return &ReportData{
+		TotalExpenses:    total,
+		Currency:         baseCurrency,
+		ExpenseCount:     int64(len(expenses)),
+		Categories:       categories,
+		ParentCategories: parents,
+		Tags:             tags,
+		From:             start.Format("2006-01-02"),
+		To:               end.AddDate(0, 0, -1).Format("2006-01-02"),
+		Months:           breakdown,
+		DailyAverage:     common.NewMoney(divRound(total.Minor, days), baseCurrency),
+		LargestExpenses:  largest,
+		Unconverted:      unconverted,
+	}, nil
 }
 
-func (s *Service) publishNotification(userID uint, event, data string) {
-	notification := map[string]interface{}{
-		"user_id": userID,
-		"event":   event,
-		"data":    data,
-		"time":    time.Now(),
+func compare(total common.Money, previous *ReportData) (*Comparison, error) {
+	change, err := total.Sub(previous.TotalExpenses)
+	if err != nil {
+		return nil, err
+	}
+
+	comparison := &Comparison{
+		From:          previous.From,
+		To:            previous.To,
+		TotalExpenses: previous.TotalExpenses,
+		Change:        change,
 	}
+	if previous.TotalExpenses.Minor != 0 {
+		pct := float64(change.Minor*10000/previous.TotalExpenses.Minor) / 100
+		comparison.ChangePercent = &pct
+	}
+	return comparison, nil
+}
 
-	notificationJSON, _ := json.Marshal(notification)
-	s.redis.Publish(context.Background(), "notifications", notificationJSON)
+// divRound divides a by b rounding half away from zero.
+func divRound(a, b int64) int64 {
+	if b <= 0 {
+		return 0
+	}
+	q, r := a/b, a%b
+	if r < 0 {
+		r = -r
+	}
+	if 2*r >= b {
+		if a < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+	return q
 }
 
-func (s *Service) GetReports(userID uint, reportType string) ([]common.Report, error) {
+func (s *Service) publishNotification(userID uint, event, data string) {
+	if err := notify.Publish(context.Background(), s.redis, userID, event, data); err != nil {
+		s.logger.Warn("Failed to publish notification", zap.String("event", event), zap.Error(err))
+	}
+}
+
+func (s *Service) GetReports(workspaceID uint, reportType string) ([]common.Report, error) {
 	var reports []common.Report
-	err := s.db.Where("user_id = ? AND type = ?", userID, reportType).
+	err := s.db.Where("workspace_id = ? AND type = ?", workspaceID, reportType).
 		Order("created_at DESC").
 		Find(&reports).Error
 	return reports, err
-}
\ No newline at end of file
+}
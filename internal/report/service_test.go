@@ -0,0 +1,318 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"fintrack/internal/category"
+	"fintrack/internal/common"
+	"fintrack/pkg/export"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&common.User{}, &common.Workspace{}, &common.Expense{}, &common.Report{}, &common.ExchangeRate{}, &common.ExpenseVersion{}, &common.ReportJob{}, &common.Category{}, &common.Tag{})
+	return db
+}
+
+func TestReportService_LoadExchangeRates(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db, nil, zap.NewNop())
+
+	csv := "date,base,quote,rate\n2024-01-01,EUR,USD,1.10\n2024-01-01,EUR,USD,1.105\n2024-01-10,usd,jpy,145.5\n"
+	count, err := service.LoadExchangeRates(strings.NewReader(csv))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if count != 3 {
+		t.Errorf("Expected 3 rows read, got %d", count)
+	}
+
+	var stored int64
+	db.Model(&common.ExchangeRate{}).Count(&stored)
+	if stored != 2 {
+		t.Errorf("Expected duplicate pair/date to be upserted, got %d rows", stored)
+	}
+
+	if _, err := service.LoadExchangeRates(strings.NewReader("date,base,rate\n")); err == nil {
+		t.Error("Expected error for missing quote column")
+	}
+}
+
+func TestReportService_GenerateReportDataConvertsCurrencies(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db, nil, zap.NewNop())
+
+	db.Create(&common.Workspace{ID: 1, Name: "A", OwnerID: 1, BaseCurrency: "USD"})
+	service.LoadExchangeRates(strings.NewReader("date,base,quote,rate\n2024-01-01,EUR,USD,1.10\n"))
+
+	day := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+	db.Create(&[]common.Expense{
+		{WorkspaceID: 1, UserID: 1, Amount: common.MustParseMoney("10.00", "USD"), Category: "Food", Date: day},
+		{WorkspaceID: 1, UserID: 1, Amount: common.MustParseMoney("20.00", "EUR"), Category: "Food", Date: day},
+		{WorkspaceID: 1, UserID: 1, Amount: common.MustParseMoney("1000", "JPY"), Category: "Travel", Date: day},
+	})
+
+	data, err := service.generateReportData(1, MonthlyPeriod(2024, 1))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if data.TotalExpenses.String() != "32.00" || data.Currency != "USD" {
+		t.Errorf("Expected total 32.00 USD, got %s %s", data.TotalExpenses, data.Currency)
+	}
+	if len(data.Unconverted) != 1 || data.Unconverted[0].Currency != "JPY" {
+		t.Errorf("Expected the JPY expense to be listed as unconverted, got %+v", data.Unconverted)
+	}
+}
+
+func TestReportService_ExportReportsJSONL(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db, nil, zap.NewNop())
+
+	db.Create(&common.Report{WorkspaceID: 1, UserID: 1, Type: "monthly", Period: "2024-01", Data: `{"total_expenses":10.50,"currency":"EUR","expense_count":2}`})
+	db.Create(&common.Report{WorkspaceID: 1, UserID: 1, Type: "monthly", Period: "2024-02", Data: `{"total_expenses":3,"currency":"EUR","expense_count":1}`})
+	db.Create(&common.Report{WorkspaceID: 2, UserID: 2, Type: "monthly", Period: "2024-01", Data: `{}`})
+
+	var buf bytes.Buffer
+	w, _ := export.NewWriter(export.FormatJSONL, &buf)
+	if err := service.ExportReports(1, "monthly", w); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	w.Close()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %d: %s", len(lines), buf.String())
+	}
+
+	var first struct {
+		Period        string          `json:"period"`
+		TotalExpenses json.Number     `json:"total_expenses"`
+		Data          json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &first); err != nil {
+		t.Fatalf("Expected valid JSON, got %v", err)
+	}
+	if first.Period != "2024-02" || first.TotalExpenses != "3" || len(first.Data) == 0 {
+		t.Errorf("Unexpected first line %s", lines[0])
+	}
+	if !strings.Contains(lines[1], `"total_expenses":10.50`) {
+		t.Errorf("Expected exact total in second line, got %s", lines[1])
+	}
+}
+
+func TestReportService_GenerateRangeReportsBreakdownAndComparison(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db, nil, zap.NewNop())
+
+	db.Create(&common.Workspace{ID: 1, Name: "A", OwnerID: 1, BaseCurrency: "USD"})
+	date := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+	rent, _ := category.Resolve(db, 1, "Rent")
+	trip := common.Tag{WorkspaceID: 1, Name: "Berlin Trip", NameKey: "berlin trip"}
+	db.Create(&trip)
+	db.Create(&[]common.Expense{
+		{WorkspaceID: 1, UserID: 1, Amount: common.MustParseMoney("100.00", "USD"), Category: "Rent", CategoryID: &rent.ID, Date: date("2024-01-05"), Tags: []common.Tag{trip}},
+		{WorkspaceID: 1, UserID: 1, Amount: common.MustParseMoney("20.00", "USD"), Category: "Food", Date: date("2024-02-10"), Tags: []common.Tag{trip}},
+		{WorkspaceID: 1, UserID: 1, Amount: common.MustParseMoney("5.00", "USD"), Category: "Food", Date: date("2024-03-31")},
+		{WorkspaceID: 1, UserID: 1, Amount: common.MustParseMoney("50.00", "USD"), Category: "Food", Date: date("2023-12-01")},
+	})
+
+	report, err := service.GenerateQuarterlyReport(1, 1, 2024, 1)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if report.Period != "2024-Q1" || report.Type != TypeQuarterly {
+		t.Errorf("Expected quarterly report 2024-Q1, got %s %s", report.Type, report.Period)
+	}
+
+	var data ReportData
+	json.Unmarshal([]byte(report.Data), &data)
+	if data.From != "2024-01-01" || data.To != "2024-03-31" {
+		t.Errorf("Expected 2024-01-01..2024-03-31, got %s..%s", data.From, data.To)
+	}
+	if len(data.Months) != 3 || data.Months[1].Month != "2024-02" || data.Months[1].Total.String() != "20.00" {
+		t.Errorf("Unexpected month breakdown %+v", data.Months)
+	}
+	if data.ParentCategories["Housing"].String() != "100.00" || data.ParentCategories["Food"].String() != "25.00" || data.Categories["Rent"].String() != "100.00" {
+		t.Errorf("Expected rent to roll up into Housing, got %v", data.ParentCategories)
+	}
+	if len(data.Tags) != 1 || data.Tags["Berlin Trip"].String() != "120.00" {
+		t.Errorf("Expected 120.00 tagged Berlin Trip, got %v", data.Tags)
+	}
+	// 125.00 over the 91 days of Q1 2024.
+	if data.DailyAverage.String() != "1.37" {
+		t.Errorf("Expected daily average 1.37, got %s", data.DailyAverage)
+	}
+	if len(data.LargestExpenses) != 3 || data.LargestExpenses[0].Category != "Rent" {
+		t.Errorf("Expected largest expenses led by rent, got %+v", data.LargestExpenses)
+	}
+	if data.Previous == nil || data.Previous.From != "2023-10-01" || data.Previous.Change.String() != "75.00" || *data.Previous.ChangePercent != 150 {
+		t.Errorf("Unexpected comparison %+v", data.Previous)
+	}
+
+	rangeReport, err := service.GenerateRangeReport(1, 1, date("2024-02-01"), date("2024-02-29"))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	json.Unmarshal([]byte(rangeReport.Data), &data)
+	if data.Previous.From != "2024-01-03" || data.Previous.To != "2024-01-31" {
+		t.Errorf("Expected previous window 2024-01-03..2024-01-31, got %s..%s", data.Previous.From, data.Previous.To)
+	}
+
+	if _, err := service.GenerateRangeReport(1, 1, date("2024-02-02"), date("2024-02-01")); err != ErrInvalidRange {
+		t.Errorf("Expected ErrInvalidRange, got %v", err)
+	}
+	if _, err := RangePeriod(date("2014-01-01"), date("2023-12-31")); err != nil {
+		t.Errorf("Expected a 10-year range to be accepted, got %v", err)
+	}
+	if _, err := RangePeriod(date("0001-01-01"), date("9999-12-31")); err != ErrInvalidRange {
+		t.Errorf("Expected ErrInvalidRange for a range over 10 years, got %v", err)
+	}
+	if _, err := service.GenerateWeeklyReport(1, 1, 2021, 53); err != ErrInvalidWeek {
+		t.Errorf("Expected ErrInvalidWeek, got %v", err)
+	}
+}
+
+func TestReportService_RegeneratesStaleReports(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db, nil, zap.NewNop())
+	invalidator := NewInvalidator(db, zap.NewNop())
+
+	db.Create(&common.Workspace{ID: 1, Name: "A", OwnerID: 1, BaseCurrency: "USD"})
+	add := func(amount, date string) {
+		d, _ := time.Parse("2006-01-02", date)
+		expense := common.Expense{WorkspaceID: 1, UserID: 1, Amount: common.MustParseMoney(amount, "USD"), Category: "Food", Date: d}
+		db.Create(&expense)
+		invalidator.ExpenseChanged(1, nil, &expense)
+	}
+	total := func(report *common.Report) string {
+		var data ReportData
+		json.Unmarshal([]byte(report.Data), &data)
+		return data.TotalExpenses.String()
+	}
+
+	add("10.00", "2024-03-05")
+	first, err := service.GenerateMonthlyReport(1, 1, 2024, 3)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if first.SourceVersion != 1 || first.GeneratedAt.IsZero() || first.Stale {
+		t.Errorf("Expected fresh report at version 1, got version %d, stale %v", first.SourceVersion, first.Stale)
+	}
+
+	// April's expenses are outside March and its comparison period.
+	add("99.00", "2024-04-01")
+	cached, _ := service.GenerateMonthlyReport(1, 1, 2024, 3)
+	if cached.SourceVersion != 1 || !cached.GeneratedAt.Equal(first.GeneratedAt) {
+		t.Errorf("Expected the cached report, got version %d", cached.SourceVersion)
+	}
+
+	add("5.00", "2024-03-20")
+	var stored common.Report
+	db.First(&stored, first.ID)
+	if !stored.Stale {
+		t.Fatalf("Expected report to be marked stale")
+	}
+
+	regenerated, err := service.GenerateMonthlyReport(1, 1, 2024, 3)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if regenerated.ID != first.ID || regenerated.Stale || regenerated.SourceVersion != 3 {
+		t.Errorf("Expected report %d regenerated at version 3, got report %d at version %d", first.ID, regenerated.ID, regenerated.SourceVersion)
+	}
+	if total(regenerated) != "15.00" {
+		t.Errorf("Expected total 15.00, got %s", total(regenerated))
+	}
+
+	// A change in February moves March's comparison, so it is stale too.
+	add("1.00", "2024-02-10")
+	db.First(&stored, first.ID)
+	if !stored.Stale {
+		t.Errorf("Expected a change in the comparison period to mark the report stale")
+	}
+
+	// A failed lookup of the stale report must not be taken for a missing one.
+	lookups := 0
+	db.Callback().Query().Before("gorm:query").Register("fail_report_lookup", func(tx *gorm.DB) {
+		if tx.Statement.Table == "reports" {
+			if lookups++; lookups == 2 {
+				tx.AddError(errors.New("connection reset"))
+			}
+		}
+	})
+	if _, err := service.GenerateMonthlyReport(1, 1, 2024, 3); err == nil {
+		t.Errorf("Expected the lookup error, got none")
+	}
+	db.Callback().Query().Remove("fail_report_lookup")
+	var count int64
+	db.Model(&common.Report{}).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected no duplicate report, got %d reports", count)
+	}
+}
+
+func TestReportService_ReportJobsRetryAndComplete(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db, nil, zap.NewNop())
+
+	db.Create(&common.Workspace{ID: 1, Name: "A", OwnerID: 1, BaseCurrency: "USD"})
+	db.Create(&common.Expense{WorkspaceID: 1, UserID: 1, Amount: common.MustParseMoney("8.00", "USD"), Category: "Food", Date: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)})
+
+	period, err := PeriodFor(common.ReportJobRequest{Type: TypeMonthly, Year: 2024, Month: 5}, time.Now())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	report, job, err := service.RequestReport(1, 1, period)
+	if err != nil || report != nil || job == nil {
+		t.Fatalf("Expected a queued job, got report %v, job %v, error %v", report, job, err)
+	}
+	if again, _ := service.EnqueueReport(1, 1, period); again.ID != job.ID {
+		t.Errorf("Expected the pending job %d to be reused, got %d", job.ID, again.ID)
+	}
+
+	// Break the first attempt by hiding the expenses table.
+	db.Migrator().RenameTable("expenses", "expenses_hidden")
+	now := time.Now().UTC()
+	claimed, _ := service.claimJob(now)
+	if claimed == nil || claimed.ID != job.ID {
+		t.Fatalf("Expected to claim job %d, got %v", job.ID, claimed)
+	}
+	if next, _ := service.claimJob(now); next != nil {
+		t.Errorf("Expected a running job not to be claimed twice")
+	}
+	if err := service.runJob(claimed, 2); err == nil {
+		t.Fatalf("Expected the first attempt to fail")
+	}
+	stored, _ := service.GetJob(1, job.ID)
+	if stored.Status != common.ReportJobPending || stored.Error == "" || !stored.RunAfter.After(now) {
+		t.Errorf("Expected a pending retry with an error, got %+v", stored)
+	}
+
+	db.Migrator().RenameTable("expenses_hidden", "expenses")
+	claimed, _ = service.claimJob(stored.RunAfter)
+	if claimed == nil || claimed.Attempts != 2 {
+		t.Fatalf("Expected the retry to be claimed as attempt 2, got %+v", claimed)
+	}
+	if err := service.runJob(claimed, 2); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	stored, _ = service.GetJob(1, job.ID)
+	if stored.Status != common.ReportJobDone || stored.ReportID == nil {
+		t.Fatalf("Expected a finished job with a report, got %+v", stored)
+	}
+	report, job, _ = service.RequestReport(1, 1, period)
+	if report == nil || job != nil || report.ID != *stored.ReportID {
+		t.Errorf("Expected the generated report to be served directly, got %v and %v", report, job)
+	}
+}
@@ -0,0 +1,85 @@
+package report
+
+import (
+	"context"
+	"sync"
+	"time"
+	"go.uber.org/zap"
+)
+
+// WorkerPool processes queued report jobs with a fixed number of workers.
+// Several report service replicas may share one queue.
+type WorkerPool struct {
+	service     *Service
+	logger      *zap.Logger
+	workers     int
+	interval    time.Duration
+	maxAttempts int
+}
+
+func NewWorkerPool(service *Service, logger *zap.Logger, workers int, interval time.Duration, maxAttempts int) *WorkerPool {
+	if workers < 1 {
+		workers = 1
+	}
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	return &WorkerPool{
+		service:     service,
+		logger:      logger,
+		workers:     workers,
+		interval:    interval,
+		maxAttempts: maxAttempts,
+	}
+}
+
+// Run starts the workers and blocks until ctx is cancelled and every job in
+// progress has finished.
+func (p *WorkerPool) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < p.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.work(ctx)
+		}()
+	}
+	wg.Wait()
+}
+
+func (p *WorkerPool) work(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		// Drain the queue before waiting for the next tick.
+		for ctx.Err() == nil && p.runNext() {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runNext processes one job and reports whether there was one.
+func (p *WorkerPool) runNext() bool {
+	job, err := p.service.claimJob(time.Now().UTC())
+	if err != nil {
+		p.logger.Error("Failed to claim report job", zap.Error(err))
+		return false
+	}
+	if job == nil {
+		return false
+	}
+
+	if err := p.service.runJob(job, p.maxAttempts); err != nil {
+		p.logger.Warn("Report job failed",
+			zap.Uint("job_id", job.ID),
+			zap.Int("attempt", job.Attempts),
+			zap.Error(err))
+	}
+	return true
+}
@@ -0,0 +1,219 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"fintrack/internal/common"
+	"fintrack/internal/workspace"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrEmailTaken       = errors.New("email is already registered")
+	ErrPasswordRequired = errors.New("current password is required to change the email")
+)
+
+// ownedPurged are the models holding a user's own data. They have no
+// DeletedAt column and are removed outright: they only mean something while
+// the account exists. Expenses and budgets belong to workspaces; see
+// workspace.RemoveUser.
+var ownedPurged = []interface{}{
+	&common.ImportMapping{},
+	&common.ImportBatch{},
+	&common.RefreshToken{},
+	&common.UserToken{},
+	&common.TOTPCredential{},
+	&common.RecoveryCode{},
+	&common.APIKey{},
+}
+
+func (s *Service) GetUser(userID uint) (*common.User, error) {
+	var user common.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// UpdateProfile applies the fields set in req. A new email must be verified
+// again; a new base currency also becomes the personal workspace's.
+func (s *Service) UpdateProfile(userID uint, req common.UpdateProfileRequest) (*common.User, bool, error) {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	updates := map[string]interface{}{}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return nil, false, errors.New("name cannot be empty")
+		}
+		updates["name"] = name
+	}
+
+	currencyChanged := false
+	if req.BaseCurrency != nil {
+		baseCurrency := strings.ToUpper(strings.TrimSpace(*req.BaseCurrency))
+		if !common.IsCurrencyCode(baseCurrency) {
+			return nil, false, errors.New("base currency must be a three-letter ISO 4217 code")
+		}
+		if baseCurrency != user.BaseCurrency {
+			updates["base_currency"] = baseCurrency
+			currencyChanged = true
+		}
+	}
+
+	emailChanged := false
+	if req.Email != nil && !strings.EqualFold(*req.Email, user.Email) {
+		if req.CurrentPassword == "" {
+			return nil, false, ErrPasswordRequired
+		}
+		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+			return nil, false, ErrInvalidCredentials
+		}
+
+		var taken int64
+		if err := s.db.Unscoped().Model(&common.User{}).Where("email = ? AND id <> ?", *req.Email, userID).Count(&taken).Error; err != nil {
+			return nil, false, err
+		}
+		if taken > 0 {
+			return nil, false, ErrEmailTaken
+		}
+		updates["email"] = *req.Email
+		updates["email_verified"] = false
+		updates["email_verified_at"] = nil
+		emailChanged = true
+	}
+
+	if len(updates) == 0 {
+		return user, false, nil
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(updates).Error; err != nil {
+			return err
+		}
+		if emailChanged {
+			// Tokens mailed to the old address must not vouch for the new
+			// one: a password reset also verifies the email.
+			if err := tx.Model(&common.UserToken{}).
+				Where("user_id = ? AND used_at IS NULL", user.ID).
+				Update("used_at", time.Now()).Error; err != nil {
+				return err
+			}
+			if err := auditEvent(tx, &user.ID, common.AuditEmailChanged, "", ""); err != nil {
+				return err
+			}
+		}
+		if currencyChanged {
+			personal, err := workspace.PersonalWorkspace(tx, userID)
+			if err != nil {
+				return err
+			}
+			return workspace.SetBaseCurrency(tx, personal.ID, updates["base_currency"].(string))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	user, err = s.GetUser(userID)
+	return user, emailChanged, err
+}
+
+// ChangePassword replaces the password and signs out every session, including
+// the caller's, whose replacement tokens are returned.
+func (s *Service) ChangePassword(userID uint, jti string, expiresAt time.Time, req common.ChangePasswordRequest) (*common.AuthResponse, error) {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.CurrentPassword)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("password", string(hashedPassword)).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&common.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return auditEvent(tx, &user.ID, common.AuditPasswordChanged, "", "")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.revokeAccessToken(jti, expiresAt); err != nil {
+		return nil, err
+	}
+	return s.issueTokens(*user)
+}
+
+// DeleteAccount soft-deletes the user with their personal workspace, hands
+// shared workspaces they own to another member, and removes everything
+// derived from them. The user row is anonymized so the email can be
+// registered again.
+func (s *Service) DeleteAccount(userID uint, password, jti string, expiresAt time.Time) error {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return ErrInvalidCredentials
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// The user service may run before the other services have created
+		// their tables.
+		for _, model := range ownedPurged {
+			if !tx.Migrator().HasTable(model) {
+				continue
+			}
+			if err := tx.Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := workspace.RemoveUser(tx, userID); err != nil {
+			return err
+		}
+
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"email":    fmt.Sprintf("deleted-%d@deleted.invalid", user.ID),
+			"name":     "Deleted user",
+			"password": "",
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(user).Error; err != nil {
+			return err
+		}
+		return auditEvent(tx, &user.ID, common.AuditAccountDeleted, "", "")
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.revokeAccessToken(jti, expiresAt)
+}
+
+func (s *Service) revokeAccessToken(jti string, expiresAt time.Time) error {
+	if s.revocations == nil || jti == "" {
+		return nil
+	}
+	return s.revocations.Revoke(context.Background(), jti, expiresAt)
+}
@@ -0,0 +1,300 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"fintrack/internal/common"
+	"fintrack/pkg/auth"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultAdminPageSize = 50
+	maxAdminPageSize     = 200
+)
+
+var (
+	ErrAccountDisabled   = errors.New("account has been disabled")
+	ErrCannotDisableSelf = errors.New("administrators cannot disable their own account")
+	ErrCannotDemoteSelf  = errors.New("administrators cannot remove their own admin role")
+)
+
+// Statuses UserFilter.Status accepts.
+const (
+	UserStatusActive     = "active"
+	UserStatusDisabled   = "disabled"
+	UserStatusLocked     = "locked"
+	UserStatusUnverified = "unverified"
+)
+
+// UserFilter narrows the admin user list. Query matches name or email.
+type UserFilter struct {
+	Query  string
+	Role   string
+	Status string
+	Limit  int
+	Offset int
+}
+
+type UserList struct {
+	Users []common.User `json:"users"`
+	Total int64         `json:"total"`
+}
+
+// SystemStats is a snapshot of the whole installation for administrators.
+type SystemStats struct {
+	Users struct {
+		Total      int64 `json:"total"`
+		Active     int64 `json:"active"`
+		Disabled   int64 `json:"disabled"`
+		Locked     int64 `json:"locked"`
+		Verified   int64 `json:"verified"`
+		TwoFactor  int64 `json:"two_factor"`
+		NewLast30d int64 `json:"new_last_30d"`
+		WithRoles  int64 `json:"with_roles"`
+	} `json:"users"`
+	Workspaces      int64     `json:"workspaces"`
+	Expenses        int64     `json:"expenses"`
+	ExpensesLast30d int64     `json:"expenses_last_30d"`
+	Budgets         int64     `json:"budgets"`
+	ActiveAPIKeys   int64     `json:"active_api_keys"`
+	GeneratedAt     time.Time `json:"generated_at"`
+}
+
+// ListUsers returns one page of accounts matching filter, newest first.
+func (s *Service) ListUsers(filter UserFilter) (*UserList, error) {
+	query := s.db.Model(&common.User{})
+
+	if q := strings.ToLower(strings.TrimSpace(filter.Query)); q != "" {
+		pattern := "%" + escapeLike(q) + "%"
+		query = query.Where("(LOWER(email) LIKE ? ESCAPE '\\' OR LOWER(name) LIKE ? ESCAPE '\\')", pattern, pattern)
+	}
+	if filter.Role != "" {
+		if !auth.ValidUserRole(filter.Role) {
+			return nil, fmt.Errorf("unknown role %q", filter.Role)
+		}
+		query = query.Where("(' ' || roles || ' ') LIKE ?", "% "+filter.Role+" %")
+	}
+
+	now := time.Now()
+	switch filter.Status {
+	case "":
+	case UserStatusActive:
+		query = query.Where("disabled_at IS NULL")
+	case UserStatusDisabled:
+		query = query.Where("disabled_at IS NOT NULL")
+	case UserStatusLocked:
+		query = query.Where("locked_until > ?", now)
+	case UserStatusUnverified:
+		query = query.Where("email_verified = ?", false)
+	default:
+		return nil, fmt.Errorf("unknown status %q", filter.Status)
+	}
+
+	var list UserList
+	if err := query.Count(&list.Total).Error; err != nil {
+		return nil, err
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultAdminPageSize
+	}
+	if limit > maxAdminPageSize {
+		limit = maxAdminPageSize
+	}
+	err := query.Order("created_at DESC, id DESC").Limit(limit).Offset(filter.Offset).Find(&list.Users).Error
+	if err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// DisableUser blocks an account from logging in, refreshing tokens and using
+// API keys. Access tokens already issued run out within AccessTokenTTL.
+func (s *Service) DisableUser(adminID, userID uint, reason string) (*common.User, error) {
+	if adminID == userID {
+		return nil, ErrCannotDisableSelf
+	}
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled() {
+		return user, nil
+	}
+
+	now := time.Now()
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("disabled_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&common.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error; err != nil {
+			return err
+		}
+		return auditEvent(tx, &user.ID, common.AuditAccountDisabled, "", adminDetail(adminID, reason))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *Service) EnableUser(adminID, userID uint) (*common.User, error) {
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !user.Disabled() {
+		return user, nil
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("disabled_at", nil).Error; err != nil {
+			return err
+		}
+		return auditEvent(tx, &user.ID, common.AuditAccountEnabled, "", adminDetail(adminID, ""))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// SetUserRoles replaces the account roles of userID. Administrators cannot
+// drop their own admin role, so there is always one left to undo mistakes.
+func (s *Service) SetUserRoles(adminID, userID uint, roles []string) (*common.User, error) {
+	normalized, err := normalizeRoles(roles)
+	if err != nil {
+		return nil, err
+	}
+	if adminID == userID && !containsString(normalized, auth.UserRoleAdmin) {
+		return nil, ErrCannotDemoteSelf
+	}
+
+	user, err := s.GetUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	value := strings.Join(normalized, " ")
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("roles", value).Error; err != nil {
+			return err
+		}
+		detail := adminDetail(adminID, "roles: "+value)
+		return auditEvent(tx, &user.ID, common.AuditRolesChanged, "", detail)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// GrantAdmin makes the accounts registered under emails administrators. It
+// bootstraps the first administrators from configuration; unknown emails are
+// returned so the caller can report them.
+func GrantAdmin(db *gorm.DB, emails []string) ([]string, error) {
+	var missing []string
+	for _, email := range emails {
+		var user common.User
+		err := db.Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(email))).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			missing = append(missing, email)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if containsString(user.RoleList(), auth.UserRoleAdmin) {
+			continue
+		}
+
+		roles := strings.Join(append(user.RoleList(), auth.UserRoleAdmin), " ")
+		if err := db.Model(&user).Update("roles", roles).Error; err != nil {
+			return nil, err
+		}
+	}
+	return missing, nil
+}
+
+// Stats counts users and data across every workspace. Tables owned by other
+// services are skipped when this database has not been migrated for them.
+func (s *Service) Stats() (*SystemStats, error) {
+	now := time.Now()
+	monthAgo := now.AddDate(0, 0, -30)
+	stats := &SystemStats{GeneratedAt: now.UTC()}
+
+	counts := []struct {
+		model interface{}
+		query string
+		args  []interface{}
+		into  *int64
+	}{
+		{&common.User{}, "", nil, &stats.Users.Total},
+		{&common.User{}, "disabled_at IS NULL", nil, &stats.Users.Active},
+		{&common.User{}, "disabled_at IS NOT NULL", nil, &stats.Users.Disabled},
+		{&common.User{}, "locked_until > ?", []interface{}{now}, &stats.Users.Locked},
+		{&common.User{}, "email_verified = ?", []interface{}{true}, &stats.Users.Verified},
+		{&common.User{}, "created_at >= ?", []interface{}{monthAgo}, &stats.Users.NewLast30d},
+		{&common.User{}, "roles <> ''", nil, &stats.Users.WithRoles},
+		{&common.TOTPCredential{}, "enabled = ?", []interface{}{true}, &stats.Users.TwoFactor},
+		{&common.Workspace{}, "", nil, &stats.Workspaces},
+		{&common.Expense{}, "", nil, &stats.Expenses},
+		{&common.Expense{}, "created_at >= ?", []interface{}{monthAgo}, &stats.ExpensesLast30d},
+		{&common.Budget{}, "", nil, &stats.Budgets},
+		{&common.APIKey{}, "revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", []interface{}{now}, &stats.ActiveAPIKeys},
+	}
+	for _, count := range counts {
+		if !s.db.Migrator().HasTable(count.model) {
+			continue
+		}
+		query := s.db.Model(count.model)
+		if count.query != "" {
+			query = query.Where(count.query, count.args...)
+		}
+		if err := query.Count(count.into).Error; err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+func normalizeRoles(requested []string) ([]string, error) {
+	roles := []string{}
+	for _, role := range requested {
+		role = strings.ToLower(strings.TrimSpace(role))
+		if !auth.ValidUserRole(role) {
+			return nil, fmt.Errorf("unknown role %q; valid roles are %s", role, strings.Join(auth.AllUserRoles, ", "))
+		}
+		if !containsString(roles, role) {
+			roles = append(roles, role)
+		}
+	}
+	return roles, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func adminDetail(adminID uint, detail string) string {
+	if detail == "" {
+		return fmt.Sprintf("by user %d", adminID)
+	}
+	return fmt.Sprintf("by user %d; %s", adminID, detail)
+}
+
+// escapeLike makes s match literally inside a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_").Replace(s)
+}
@@ -0,0 +1,180 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"fintrack/internal/common"
+	"fintrack/pkg/auth"
+	"gorm.io/gorm"
+)
+
+const (
+	maxAPIKeys = 20
+	// lastUsedResolution bounds how often using a key writes last_used_at.
+	lastUsedResolution = time.Minute
+)
+
+var (
+	ErrTooManyAPIKeys = fmt.Errorf("at most %d active API keys are allowed", maxAPIKeys)
+	ErrAPIKeyNotFound = errors.New("API key not found")
+)
+
+// CreateAPIKey issues a key with the requested scopes. The key itself is only
+// in the returned value; the database keeps its hash.
+func (s *Service) CreateAPIKey(userID uint, req common.APIKeyRequest) (*common.NewAPIKey, error) {
+	scopes, err := normalizeScopes(req.Scopes)
+	if err != nil {
+		return nil, err
+	}
+
+	var expiresAt *time.Time
+	if req.ExpiresAt != "" {
+		t, err := parseExpiry(req.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+		expiresAt = &t
+	}
+
+	var active int64
+	if err := s.db.Model(&common.APIKey{}).Where("user_id = ? AND revoked_at IS NULL", userID).Count(&active).Error; err != nil {
+		return nil, err
+	}
+	if active >= maxAPIKeys {
+		return nil, ErrTooManyAPIKeys
+	}
+
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	prefix := auth.APIKeyPrefix + id[:8]
+	key := prefix + "_" + secret
+
+	record := common.APIKey{
+		UserID:    userID,
+		Name:      strings.TrimSpace(req.Name),
+		Prefix:    prefix,
+		KeyHash:   hashToken(key),
+		Scopes:    strings.Join(scopes, " "),
+		ExpiresAt: expiresAt,
+	}
+	if err := s.db.Create(&record).Error; err != nil {
+		return nil, err
+	}
+	return &common.NewAPIKey{APIKey: record, Key: key}, nil
+}
+
+func (s *Service) ListAPIKeys(userID uint) ([]common.APIKey, error) {
+	var keys []common.APIKey
+	err := s.db.Where("user_id = ?", userID).Order("created_at DESC").Find(&keys).Error
+	return keys, err
+}
+
+// RevokeAPIKey stops a key working on the next request that uses it.
+func (s *Service) RevokeAPIKey(userID, keyID uint) error {
+	result := s.db.Model(&common.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", keyID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		var count int64
+		if err := s.db.Model(&common.APIKey{}).Where("id = ? AND user_id = ?", keyID, userID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrAPIKeyNotFound
+		}
+	}
+	return nil
+}
+
+// APIKeyStore verifies API keys for the auth middleware in any service that
+// shares the database.
+type APIKeyStore struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyStore(db *gorm.DB) *APIKeyStore {
+	return &APIKeyStore{db: db}
+}
+
+func (s *APIKeyStore) VerifyAPIKey(ctx context.Context, key string) (*auth.APIKeyPrincipal, error) {
+	var record common.APIKey
+	err := s.db.WithContext(ctx).Where("key_hash = ?", hashToken(key)).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, auth.ErrInvalidAPIKey
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if record.RevokedAt != nil || (record.ExpiresAt != nil && !record.ExpiresAt.After(now)) {
+		return nil, auth.ErrInvalidAPIKey
+	}
+
+	var disabled int64
+	err = s.db.WithContext(ctx).Model(&common.User{}).Where("id = ? AND disabled_at IS NOT NULL", record.UserID).Count(&disabled).Error
+	if err != nil {
+		return nil, err
+	}
+	if disabled > 0 {
+		return nil, auth.ErrInvalidAPIKey
+	}
+
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) >= lastUsedResolution {
+		err := s.db.WithContext(ctx).Model(&record).Update("last_used_at", now).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &auth.APIKeyPrincipal{
+		KeyID:  record.ID,
+		UserID: record.UserID,
+		Scopes: record.ScopeList(),
+	}, nil
+}
+
+func normalizeScopes(requested []string) ([]string, error) {
+	seen := make(map[string]bool)
+	var scopes []string
+	for _, scope := range requested {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+		if !auth.ValidScope(scope) {
+			return nil, fmt.Errorf("unknown scope %q; valid scopes are %s", scope, strings.Join(auth.AllScopes, ", "))
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+	return scopes, nil
+}
+
+func parseExpiry(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t, err = time.Parse("2006-01-02", value)
+	}
+	if err != nil {
+		return time.Time{}, errors.New("expires_at must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+	}
+	if !t.After(time.Now()) {
+		return time.Time{}, errors.New("expires_at must be in the future")
+	}
+	return t, nil
+}
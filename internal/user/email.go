@@ -0,0 +1,201 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"fintrack/internal/common"
+	"fintrack/pkg/mail"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	VerificationTokenTTL  = 48 * time.Hour
+	PasswordResetTokenTTL = time.Hour
+)
+
+var (
+	ErrInvalidUserToken     = errors.New("invalid or expired token")
+	ErrEmailAlreadyVerified = errors.New("email is already verified")
+)
+
+// SendVerificationEmail mails userID a link confirming their address. Links
+// sent earlier stop working.
+func (s *Service) SendVerificationEmail(userID uint) error {
+	var user common.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return ErrEmailAlreadyVerified
+	}
+
+	token, err := s.createUserToken(s.db, user.ID, common.TokenPurposeVerifyEmail, VerificationTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.sendMail(user.Email, "Verify your FinTrack email address", fmt.Sprintf(
+		"Hi %s,\n\nConfirm your email address with this code, which expires in %s:\n\n%s\n%s\nIf you did not create a FinTrack account you can ignore this email.\n",
+		user.Name, VerificationTokenTTL, token, s.link("/verify-email", token)))
+}
+
+func (s *Service) VerifyEmail(token string) (*common.User, error) {
+	var user common.User
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		record, err := consumeUserToken(tx, token, common.TokenPurposeVerifyEmail)
+		if err != nil {
+			return err
+		}
+		if err := tx.First(&user, record.UserID).Error; err != nil {
+			return ErrInvalidUserToken
+		}
+		return markVerified(tx, &user)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// ForgotPassword mails a reset link when email belongs to an account. It
+// returns nil for unknown addresses so callers cannot probe for accounts.
+func (s *Service) ForgotPassword(email string) error {
+	var user common.User
+	err := s.db.Where("email = ?", email).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := s.createUserToken(s.db, user.ID, common.TokenPurposeResetPassword, PasswordResetTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.sendMail(user.Email, "Reset your FinTrack password", fmt.Sprintf(
+		"Hi %s,\n\nUse this code to choose a new password. It expires in %s and works once:\n\n%s\n%s\nIf you did not ask to reset your password you can ignore this email.\n",
+		user.Name, PasswordResetTokenTTL, token, s.link("/reset-password", token)))
+}
+
+// ResetPassword sets a new password and signs the user out of every session,
+// since whoever held the old password may still hold a refresh token. Access
+// tokens already issued run out within AccessTokenTTL.
+func (s *Service) ResetPassword(token, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		record, err := consumeUserToken(tx, token, common.TokenPurposeResetPassword)
+		if err != nil {
+			return err
+		}
+
+		var user common.User
+		if err := tx.First(&user, record.UserID).Error; err != nil {
+			return ErrInvalidUserToken
+		}
+		// Proving control of the inbox also lifts a lockout.
+		if err := tx.Model(&user).Updates(map[string]interface{}{
+			"password":     string(hashedPassword),
+			"locked_until": nil,
+		}).Error; err != nil {
+			return err
+		}
+		// Receiving the reset email proves the address too.
+		if err := markVerified(tx, &user); err != nil {
+			return err
+		}
+
+		return tx.Model(&common.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", user.ID).
+			Update("revoked_at", time.Now()).Error
+	})
+}
+
+// createUserToken issues a token for purpose and invalidates any the user
+// still holds for the same purpose.
+func (s *Service) createUserToken(db *gorm.DB, userID uint, purpose string, ttl time.Duration) (string, error) {
+	value, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&common.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&common.UserToken{
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: hashToken(value),
+			ExpiresAt: now.Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+// consumeUserToken marks the token used, failing if it is unknown, expired,
+// already used, or lost a race with a concurrent use.
+func consumeUserToken(tx *gorm.DB, value, purpose string) (*common.UserToken, error) {
+	var record common.UserToken
+	if err := tx.Where("token_hash = ? AND purpose = ?", hashToken(value), purpose).First(&record).Error; err != nil {
+		return nil, ErrInvalidUserToken
+	}
+	if record.UsedAt != nil || time.Now().After(record.ExpiresAt) {
+		return nil, ErrInvalidUserToken
+	}
+
+	result := tx.Model(&record).Where("used_at IS NULL").Update("used_at", time.Now())
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvalidUserToken
+	}
+	return &record, nil
+}
+
+func markVerified(tx *gorm.DB, user *common.User) error {
+	if user.EmailVerified {
+		return nil
+	}
+	now := time.Now()
+	user.EmailVerified = true
+	user.EmailVerifiedAt = &now
+	return tx.Model(user).Updates(map[string]interface{}{
+		"email_verified":    true,
+		"email_verified_at": now,
+	}).Error
+}
+
+func (s *Service) sendMail(to, subject, body string) error {
+	if s.mailer == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return s.mailer.Send(ctx, mail.Message{To: to, Subject: subject, Body: body})
+}
+
+// link points at the page that accepts token, when an app URL is configured.
+func (s *Service) link(path, token string) string {
+	if s.appURL == "" {
+		return ""
+	}
+	return fmt.Sprintf("\nOr open %s%s?token=%s\n", strings.TrimRight(s.appURL, "/"), path, url.QueryEscape(token))
+}
@@ -1,10 +1,16 @@
 package user
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 	"fintrack/internal/common"
+	"fintrack/pkg/auth"
+	"fintrack/pkg/middleware"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
+	"gorm.io/gorm"
 )
 
 type Handler struct {
@@ -33,6 +39,11 @@ func (h *Handler) Register(c *gin.Context) {
 		return
 	}
 
+	// The account exists either way; the user can ask for another email.
+	if err := h.service.SendVerificationEmail(response.User.ID); err != nil {
+		h.logger.Error("Failed to send verification email", zap.Uint("user_id", response.User.ID), zap.Error(err))
+	}
+
 	c.JSON(http.StatusCreated, response)
 }
 
@@ -43,17 +54,612 @@ func (h *Handler) Login(c *gin.Context) {
 		return
 	}
 
-	response, err := h.service.Login(req)
+	response, challenge, err := h.service.Login(req, c.ClientIP())
+	if h.refused(c, err) {
+		return
+	}
+	if errors.Is(err, ErrAccountDisabled) {
+		h.logger.Warn("Login refused", zap.Error(err))
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		h.logger.Error("Login failed", zap.Error(err))
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 		return
 	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *Handler) LoginTwoFactor(c *gin.Context) {
+	var req common.TwoFactorLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := h.service.CompleteLogin(req.ChallengeToken, req.Code, c.ClientIP())
+	if h.refused(c, err) {
+		return
+	}
+	if errors.Is(err, ErrAccountDisabled) {
+		h.logger.Warn("Two-factor login refused", zap.Error(err))
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, ErrInvalidChallenge) || errors.Is(err, ErrInvalidTwoFactorCode) || errors.Is(err, ErrTwoFactorNotEnabled) {
+		h.logger.Warn("Two-factor login failed", zap.Error(err))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Two-factor login failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// refused answers 429 with Retry-After when err is a login lockout.
+func (h *Handler) refused(c *gin.Context, err error) bool {
+	var retry *RetryError
+	if !errors.As(err, &retry) {
+		return false
+	}
+
+	h.logger.Warn("Login refused", zap.String("ip", c.ClientIP()), zap.Error(err))
+	seconds := int(math.Ceil(retry.RetryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error(), "retry_after": seconds})
+	return true
+}
+
+func (h *Handler) Refresh(c *gin.Context) {
+	var req common.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := h.service.Refresh(req.RefreshToken)
+	if errors.Is(err, ErrAccountDisabled) {
+		h.logger.Warn("Refresh refused", zap.Error(err))
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrRefreshTokenReused) {
+		h.logger.Warn("Refresh failed", zap.Error(err))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Refresh failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *Handler) Logout(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req common.LogoutRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	err := h.service.Logout(userID, c.GetString("jti"), c.GetTime("token_expires_at"), req.RefreshToken)
+	if errors.Is(err, ErrInvalidRefreshToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Logout failed", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+func (h *Handler) VerifyEmail(c *gin.Context) {
+	var req common.VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.service.VerifyEmail(req.Token)
+	if errors.Is(err, ErrInvalidUserToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to verify email", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+func (h *Handler) ResendVerification(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	err := h.service.SendVerificationEmail(userID)
+	if errors.Is(err, ErrEmailAlreadyVerified) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to send verification email", zap.Uint("user_id", userID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Verification email sent"})
+}
+
+// ForgotPassword answers the same way whether or not the account exists.
+func (h *Handler) ForgotPassword(c *gin.Context) {
+	var req common.ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.ForgotPassword(req.Email); err != nil {
+		h.logger.Error("Failed to send password reset email", zap.Error(err))
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If an account exists for that email, a reset link has been sent"})
+}
+
+func (h *Handler) ResetPassword(c *gin.Context) {
+	var req common.ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.service.ResetPassword(req.Token, req.Password)
+	if errors.Is(err, ErrInvalidUserToken) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to reset password", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+}
+
+func (h *Handler) SetupTwoFactor(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	setup, err := h.service.SetupTwoFactor(userID)
+	if errors.Is(err, ErrTwoFactorAlreadyEnabled) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to set up two-factor authentication", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, setup)
+}
+
+func (h *Handler) EnableTwoFactor(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req common.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.service.EnableTwoFactor(userID, req.Code)
+	if err != nil {
+		h.twoFactorError(c, "Failed to enable two-factor authentication", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func (h *Handler) DisableTwoFactor(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req common.DisableTwoFactorRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.DisableTwoFactor(userID, req.Password, req.Code); err != nil {
+		h.twoFactorError(c, "Failed to disable two-factor authentication", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+func (h *Handler) RegenerateRecoveryCodes(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req common.TwoFactorCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	codes, err := h.service.RegenerateRecoveryCodes(userID, req.Code)
+	if err != nil {
+		h.twoFactorError(c, "Failed to regenerate recovery codes", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func (h *Handler) twoFactorError(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, ErrTwoFactorAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrTwoFactorNotSetUp), errors.Is(err, ErrTwoFactorNotEnabled), errors.Is(err, ErrInvalidTwoFactorCode):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInvalidCredentials):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	default:
+		h.logger.Error(message, zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func (h *Handler) GetProfile(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	user, err := h.service.GetUser(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		h.logger.Error("Failed to get user", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+func (h *Handler) UpdateProfile(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req common.UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, emailChanged, err := h.service.UpdateProfile(userID, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidCredentials):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		case errors.Is(err, ErrEmailTaken):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		default:
+			h.logger.Error("Failed to update profile", zap.Error(err))
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if emailChanged {
+		if err := h.service.SendVerificationEmail(userID); err != nil {
+			h.logger.Error("Failed to send verification email", zap.Uint("user_id", userID), zap.Error(err))
+		}
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+func (h *Handler) ChangePassword(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req common.ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := h.service.ChangePassword(userID, c.GetString("jti"), c.GetTime("token_expires_at"), req)
+	if errors.Is(err, ErrInvalidCredentials) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to change password", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	c.JSON(http.StatusOK, response)
 }
 
+func (h *Handler) DeleteAccount(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req common.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.service.DeleteAccount(userID, req.Password, c.GetString("jti"), c.GetTime("token_expires_at"))
+	if errors.Is(err, ErrInvalidCredentials) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to delete account", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted successfully"})
+}
+
+func (h *Handler) CreateAPIKey(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req common.APIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key, err := h.service.CreateAPIKey(userID, req)
+	if err != nil {
+		h.logger.Error("Failed to create API key", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, key)
+}
+
+func (h *Handler) ListAPIKeys(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	keys, err := h.service.ListAPIKeys(userID)
+	if err != nil {
+		h.logger.Error("Failed to list API keys", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+func (h *Handler) RevokeAPIKey(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	keyID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	err = h.service.RevokeAPIKey(userID, uint(keyID))
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to revoke API key", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+}
+
+// GetJWKS publishes the keys access tokens are verified with. Verifiers cache
+// the document and refetch early when they see an unknown kid.
+func (h *Handler) GetJWKS(c *gin.Context) {
+	jwks, err := h.service.JWKS()
+	if err != nil {
+		h.logger.Error("Failed to load signing keys", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, jwks)
+}
+
+func (h *Handler) ListUsers(c *gin.Context) {
+	filter := UserFilter{
+		Query:  c.Query("q"),
+		Role:   c.Query("role"),
+		Status: c.Query("status"),
+	}
+	var err error
+	if limit := c.Query("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+	}
+	if offset := c.Query("offset"); offset != "" {
+		if filter.Offset, err = strconv.Atoi(offset); err != nil || filter.Offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid offset"})
+			return
+		}
+	}
+
+	list, err := h.service.ListUsers(filter)
+	if err != nil {
+		h.logger.Error("Failed to list users", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+func (h *Handler) GetUser(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	user, err := h.service.GetUser(uint(userID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to get user", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+func (h *Handler) DisableUser(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req common.DisableUserRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	user, err := h.service.DisableUser(c.GetUint("user_id"), uint(userID), req.Reason)
+	h.adminResult(c, "Failed to disable user", user, err)
+}
+
+func (h *Handler) EnableUser(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	user, err := h.service.EnableUser(c.GetUint("user_id"), uint(userID))
+	h.adminResult(c, "Failed to enable user", user, err)
+}
+
+func (h *Handler) SetUserRoles(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req common.UserRolesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	user, err := h.service.SetUserRoles(c.GetUint("user_id"), uint(userID), req.Roles)
+	h.adminResult(c, "Failed to set user roles", user, err)
+}
+
+func (h *Handler) adminResult(c *gin.Context, message string, user *common.User, err error) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if errors.Is(err, ErrCannotDisableSelf) || errors.Is(err, ErrCannotDemoteSelf) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		h.logger.Error(message, zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+func (h *Handler) GetStats(c *gin.Context) {
+	stats, err := h.service.Stats()
+	if err != nil {
+		h.logger.Error("Failed to compute stats", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
 func (h *Handler) SetupRoutes(router *gin.RouterGroup) {
 	router.POST("/register", h.Register)
 	router.POST("/login", h.Login)
-}
\ No newline at end of file
+	router.POST("/login/2fa", h.LoginTwoFactor)
+	router.POST("/refresh", h.Refresh)
+	router.POST("/verify-email", h.VerifyEmail)
+	router.POST("/forgot-password", h.ForgotPassword)
+	router.POST("/reset-password", h.ResetPassword)
+}
+
+// SetupProtectedRoutes registers routes that need an authenticated user; the
+// caller installs the auth middleware on router.
+func (h *Handler) SetupProtectedRoutes(router *gin.RouterGroup) {
+	router.POST("/logout", h.Logout)
+	router.GET("/me", h.GetProfile)
+	router.PATCH("/me", h.UpdateProfile)
+	router.PUT("/me/password", h.ChangePassword)
+	router.DELETE("/me", h.DeleteAccount)
+	router.POST("/api-keys", h.CreateAPIKey)
+	router.GET("/api-keys", h.ListAPIKeys)
+	router.DELETE("/api-keys/:id", h.RevokeAPIKey)
+	router.POST("/verify-email/resend", h.ResendVerification)
+	router.POST("/2fa/setup", h.SetupTwoFactor)
+	router.POST("/2fa/enable", h.EnableTwoFactor)
+	router.POST("/2fa/disable", h.DisableTwoFactor)
+	router.POST("/2fa/recovery-codes", h.RegenerateRecoveryCodes)
+}
+
+// SetupAdminRoutes registers the administration API, each route guarded by
+// the permission it needs; the caller installs the auth middleware on router.
+func (h *Handler) SetupAdminRoutes(router *gin.RouterGroup) {
+	router.GET("/users", middleware.RequirePermission(auth.PermUsersRead), h.ListUsers)
+	router.GET("/users/:id", middleware.RequirePermission(auth.PermUsersRead), h.GetUser)
+	router.POST("/users/:id/disable", middleware.RequirePermission(auth.PermUsersWrite), h.DisableUser)
+	router.POST("/users/:id/enable", middleware.RequirePermission(auth.PermUsersWrite), h.EnableUser)
+	router.PUT("/users/:id/roles", middleware.RequirePermission(auth.PermUsersWrite), h.SetUserRoles)
+	router.GET("/stats", middleware.RequirePermission(auth.PermStatsRead), h.GetStats)
+}
@@ -0,0 +1,293 @@
+package user
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"fintrack/internal/common"
+	"fintrack/pkg/auth"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	rsaKeyBits = 2048
+
+	// activationDelay is how long a new key is published before it signs, so
+	// remote verifiers, which refetch the JWKS at most every
+	// auth.JWKSRefetchInterval, know it before its first token arrives. The
+	// margin covers clock skew between replicas.
+	activationDelay = 2 * auth.JWKSRefetchInterval
+)
+
+// KeyManager owns the access token signing keys. Keys live in the database so
+// every user service replica signs with the same key and publishes the same
+// JWKS. A rotation publishes the new key at once and lets it take over
+// signing after activationDelay; the key it replaces is then retired but
+// stays published for the overlap window, which is never shorter than
+// AccessTokenTTL.
+type KeyManager struct {
+	db        *gorm.DB
+	algorithm string
+	rotation  time.Duration
+	overlap   time.Duration
+	now       func() time.Time
+
+	mu      sync.Mutex
+	signers map[string]crypto.Signer
+}
+
+func NewKeyManager(db *gorm.DB, algorithm string, rotation, overlap time.Duration) (*KeyManager, error) {
+	if algorithm != auth.AlgRS256 && algorithm != auth.AlgEdDSA {
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+	if overlap < AccessTokenTTL {
+		overlap = AccessTokenTTL
+	}
+	return &KeyManager{
+		db:        db,
+		algorithm: algorithm,
+		rotation:  rotation,
+		overlap:   overlap,
+		now:       time.Now,
+		signers:   make(map[string]crypto.Signer),
+	}, nil
+}
+
+// Sign signs claims with the current key, creating the first key if needed.
+func (m *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	now := m.now()
+	key, err := m.current(now)
+	if err != nil {
+		return "", err
+	}
+	if key == nil {
+		if key, err = m.Rotate(now); err != nil {
+			return "", err
+		}
+	}
+
+	signer, err := m.signer(key)
+	if err != nil {
+		return "", err
+	}
+
+	method := jwt.GetSigningMethod(key.Algorithm)
+	if method == nil {
+		return "", fmt.Errorf("key %s has unsupported algorithm %q", key.ID, key.Algorithm)
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(signer)
+}
+
+// RotateIfDue rotates when there is no key or the latest is older than the
+// rotation interval, and drops keys whose overlap window has passed.
+func (m *KeyManager) RotateIfDue(now time.Time) (bool, error) {
+	if err := m.db.Where("expires_at <= ?", now).Delete(&common.SigningKey{}).Error; err != nil {
+		return false, err
+	}
+
+	key, err := m.latest()
+	if err != nil {
+		return false, err
+	}
+	if key != nil && now.Sub(key.CreatedAt) < m.rotation {
+		return false, nil
+	}
+	if _, err := m.Rotate(now); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Rotate creates a new signing key and schedules the keys created before it
+// to retire once it has been published for activationDelay; they keep
+// signing until then. Replicas rotating at the same moment each keep their
+// own key unretired, and the newest of those signs until the next rotation
+// retires them all.
+func (m *KeyManager) Rotate(now time.Time) (*common.SigningKey, error) {
+	key, err := newSigningKey(m.algorithm, now)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(key).Error; err != nil {
+			return err
+		}
+		return tx.Model(&common.SigningKey{}).
+			Where("retired_at IS NULL AND created_at < ?", key.CreatedAt).
+			Updates(map[string]interface{}{
+				"retired_at": now.Add(activationDelay),
+				"expires_at": now.Add(activationDelay + m.overlap),
+			}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// JWKS returns the public keys of every key that is still published.
+func (m *KeyManager) JWKS() (*auth.JWKS, error) {
+	var keys []common.SigningKey
+	if err := m.published(m.now()).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+
+	set := &auth.JWKS{Keys: make([]auth.JWK, 0, len(keys))}
+	for _, key := range keys {
+		public, err := parsePublicKey(key.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", key.ID, err)
+		}
+		jwk, err := auth.NewJWK(key.ID, key.Algorithm, public)
+		if err != nil {
+			return nil, err
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
+
+// PublicKey lets the user service verify its own tokens without going
+// through the JWKS endpoint.
+func (m *KeyManager) PublicKey(ctx context.Context, kid string) (auth.PublicKey, error) {
+	var key common.SigningKey
+	err := m.published(m.now()).WithContext(ctx).Where("id = ?", kid).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return auth.PublicKey{}, auth.ErrUnknownKey
+	}
+	if err != nil {
+		return auth.PublicKey{}, err
+	}
+
+	public, err := parsePublicKey(key.PublicKey)
+	if err != nil {
+		return auth.PublicKey{}, err
+	}
+	return auth.PublicKey{Alg: key.Algorithm, Key: public}, nil
+}
+
+func (m *KeyManager) published(now time.Time) *gorm.DB {
+	return m.db.Model(&common.SigningKey{}).Where("expires_at IS NULL OR expires_at > ?", now)
+}
+
+// current returns the key that signs at now: the newest one published for
+// activationDelay and not yet retired. Until there is one, as right after the
+// first key is created, the oldest key not yet retired signs. It returns nil
+// when there are no keys.
+func (m *KeyManager) current(now time.Time) (*common.SigningKey, error) {
+	var key common.SigningKey
+	active := m.db.Where("retired_at IS NULL OR retired_at > ?", now).Session(&gorm.Session{})
+	err := active.Where("created_at <= ?", now.Add(-activationDelay)).
+		Order("created_at DESC").First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		err = active.Order("created_at ASC").First(&key).Error
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// latest returns the newest key not scheduled to retire, or nil when there
+// is none.
+func (m *KeyManager) latest() (*common.SigningKey, error) {
+	var key common.SigningKey
+	err := m.db.Where("retired_at IS NULL").Order("created_at DESC").First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (m *KeyManager) signer(key *common.SigningKey) (crypto.Signer, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if signer, ok := m.signers[key.ID]; ok {
+		return signer, nil
+	}
+
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("key %s: invalid private key PEM", key.ID)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", key.ID, err)
+	}
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("key %s: unsupported private key type %T", key.ID, parsed)
+	}
+	m.signers[key.ID] = signer
+	return signer, nil
+}
+
+func newSigningKey(algorithm string, now time.Time) (*common.SigningKey, error) {
+	var private crypto.Signer
+	switch algorithm {
+	case auth.AlgRS256:
+		key, err := rsa.GenerateKey(rand.Reader, rsaKeyBits)
+		if err != nil {
+			return nil, err
+		}
+		private = key
+	case auth.AlgEdDSA:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		private = key
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return nil, err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	kid := make([]byte, 8)
+	if _, err := rand.Read(kid); err != nil {
+		return nil, err
+	}
+
+	return &common.SigningKey{
+		ID:         hex.EncodeToString(kid),
+		Algorithm:  algorithm,
+		PrivateKey: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privateDER})),
+		PublicKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})),
+		CreatedAt:  now,
+	}, nil
+}
+
+func parsePublicKey(data string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(data))
+	if block == nil {
+		return nil, errors.New("invalid public key PEM")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
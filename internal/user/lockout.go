@@ -0,0 +1,160 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"fintrack/internal/common"
+	"gorm.io/gorm"
+)
+
+const (
+	LoginFailureWindow   = 15 * time.Minute
+	AccountLockThreshold = 5
+	AccountLockDuration  = 15 * time.Minute
+	IPFailureThreshold   = 20
+	// Failures beyond delayFreeFailures are answered after a delay that
+	// doubles each time, up to maxLoginDelay.
+	delayFreeFailures = 2
+	maxLoginDelay     = 8 * time.Second
+)
+
+var (
+	ErrAccountLocked   = errors.New("account temporarily locked after too many failed login attempts")
+	ErrTooManyAttempts = errors.New("too many failed login attempts; try again later")
+)
+
+// RetryError refuses a login for RetryAfter.
+type RetryError struct {
+	Err        error
+	RetryAfter time.Duration
+}
+
+func (e *RetryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+// checkLoginAllowed refuses logins from an IP or for an account that has
+// failed too often, before any password is checked. Unknown emails are
+// refused by their counter alone so they answer like locked accounts.
+func (s *Service) checkLoginAllowed(ctx context.Context, user *common.User, email, ip string) error {
+	if user != nil && user.LockedUntil != nil && user.LockedUntil.After(time.Now()) {
+		return &RetryError{Err: ErrAccountLocked, RetryAfter: time.Until(*user.LockedUntil)}
+	}
+	if s.attempts == nil {
+		return nil
+	}
+
+	count, ttl, err := s.attempts.Count(ctx, ipKey(ip))
+	if err != nil {
+		return err
+	}
+	if count >= IPFailureThreshold {
+		return &RetryError{Err: ErrTooManyAttempts, RetryAfter: ttl}
+	}
+
+	if user == nil {
+		count, ttl, err := s.attempts.Count(ctx, accountKey(email))
+		if err != nil {
+			return err
+		}
+		if count >= AccountLockThreshold {
+			return &RetryError{Err: ErrAccountLocked, RetryAfter: ttl}
+		}
+	}
+	return nil
+}
+
+// loginFailed counts a failed password or second factor, slows the caller
+// down, and locks the account once it crosses the threshold. It returns the
+// error to answer with in place of failure.
+func (s *Service) loginFailed(ctx context.Context, user *common.User, email, ip string, failure error) error {
+	if s.attempts == nil {
+		return failure
+	}
+
+	ipCount, _, err := s.attempts.Fail(ctx, ipKey(ip))
+	if err != nil {
+		return err
+	}
+	if ipCount == IPFailureThreshold {
+		if err := s.audit(nil, common.AuditIPThrottled, ip, fmt.Sprintf("%d failed logins within %s", ipCount, LoginFailureWindow)); err != nil {
+			return err
+		}
+	}
+
+	count, _, err := s.attempts.Fail(ctx, accountKey(email))
+	if err != nil {
+		return err
+	}
+	if count >= AccountLockThreshold {
+		if user == nil {
+			return &RetryError{Err: ErrAccountLocked, RetryAfter: AccountLockDuration}
+		}
+		return s.lockAccount(ctx, user, ip, count)
+	}
+
+	if count > delayFreeFailures {
+		delay := time.Second << uint(count-delayFreeFailures-1)
+		if delay > maxLoginDelay {
+			delay = maxLoginDelay
+		}
+		s.sleep(delay)
+	}
+	return failure
+}
+
+// loginSucceeded clears the account's failures; the IP keeps its count so
+// one good account cannot launder guesses against others.
+func (s *Service) loginSucceeded(ctx context.Context, email string) error {
+	if s.attempts == nil {
+		return nil
+	}
+	return s.attempts.Reset(ctx, accountKey(email))
+}
+
+func (s *Service) lockAccount(ctx context.Context, user *common.User, ip string, failures int64) error {
+	until := time.Now().Add(AccountLockDuration)
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("locked_until", until).Error; err != nil {
+			return err
+		}
+		return auditEvent(tx, &user.ID, common.AuditAccountLocked, ip, fmt.Sprintf("%d failed logins; locked until %s", failures, until.UTC().Format(time.RFC3339)))
+	})
+	if err != nil {
+		return err
+	}
+	user.LockedUntil = &until
+
+	if err := s.attempts.Reset(ctx, accountKey(user.Email)); err != nil {
+		return err
+	}
+	return &RetryError{Err: ErrAccountLocked, RetryAfter: AccountLockDuration}
+}
+
+func (s *Service) audit(userID *uint, event, ip, detail string) error {
+	return auditEvent(s.db, userID, event, ip, detail)
+}
+
+func auditEvent(db *gorm.DB, userID *uint, event, ip, detail string) error {
+	return db.Create(&common.AuditEvent{
+		UserID: userID,
+		Event:  event,
+		IP:     ip,
+		Detail: detail,
+	}).Error
+}
+
+func accountKey(email string) string {
+	return "login:account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "login:ip:" + ip
+}
@@ -0,0 +1,50 @@
+package user
+
+import (
+	"context"
+	"time"
+	"go.uber.org/zap"
+)
+
+// KeyRotator periodically rotates the signing key once it reaches the
+// rotation age and prunes keys past their overlap window.
+type KeyRotator struct {
+	keys     *KeyManager
+	logger   *zap.Logger
+	interval time.Duration
+}
+
+func NewKeyRotator(keys *KeyManager, logger *zap.Logger, interval time.Duration) *KeyRotator {
+	return &KeyRotator{
+		keys:     keys,
+		logger:   logger,
+		interval: interval,
+	}
+}
+
+// Run checks immediately and then on every tick until ctx is cancelled.
+func (r *KeyRotator) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.runOnce()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *KeyRotator) runOnce() {
+	rotated, err := r.keys.RotateIfDue(time.Now())
+	if err != nil {
+		r.logger.Error("Failed to rotate signing key", zap.Error(err))
+		return
+	}
+	if rotated {
+		r.logger.Info("Rotated signing key")
+	}
+}
@@ -1,81 +1,124 @@
 package user
 
 import (
+	"context"
 	"errors"
+	"strings"
 	"time"
 	"fintrack/internal/common"
-	"github.com/golang-jwt/jwt/v5"
+	"fintrack/internal/workspace"
+	"fintrack/pkg/auth"
+	"fintrack/pkg/mail"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
 type Service struct {
-	db        *gorm.DB
-	jwtSecret string
+	db          *gorm.DB
+	keys        *KeyManager
+	revocations *auth.RevocationList
+	attempts    *auth.AttemptCounter
+	mailer      mail.Mailer
+	appURL      string
+	sleep       func(time.Duration)
 }
 
-func NewService(db *gorm.DB, jwtSecret string) *Service {
+// NewService builds the user service. A nil attempts disables brute-force
+// protection, a nil mailer sends nothing, and appURL is the web frontend base
+// used in emailed links.
+func NewService(db *gorm.DB, keys *KeyManager, revocations *auth.RevocationList, attempts *auth.AttemptCounter, mailer mail.Mailer, appURL string) *Service {
 	return &Service{
-		db:        db,
-		jwtSecret: jwtSecret,
+		db:          db,
+		keys:        keys,
+		revocations: revocations,
+		attempts:    attempts,
+		mailer:      mailer,
+		appURL:      appURL,
+		sleep:       time.Sleep,
 	}
 }
 
 func (s *Service) Register(req common.RegisterRequest) (*common.AuthResponse, error) {
+	baseCurrency := strings.ToUpper(strings.TrimSpace(req.BaseCurrency))
+	if baseCurrency == "" {
+		baseCurrency = common.DefaultCurrency
+	}
+	if !common.IsCurrencyCode(baseCurrency) {
+		return nil, errors.New("base currency must be a three-letter ISO 4217 code")
+	}
+
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return nil, err
 	}
 
 	user := common.User{
-		Email:    req.Email,
-		Password: string(hashedPassword),
-		Name:     req.Name,
+		Email:        req.Email,
+		Password:     string(hashedPassword),
+		Name:         req.Name,
+		BaseCurrency: baseCurrency,
 	}
 
-	if err := s.db.Create(&user).Error; err != nil {
-		return nil, err
-	}
-
-	token, err := s.generateToken(user.ID, user.Email)
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		_, err := workspace.PersonalWorkspace(tx, user.ID)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return &common.AuthResponse{
-		Token: token,
-		User:  user,
-	}, nil
+	return s.issueTokens(user)
 }
 
-func (s *Service) Login(req common.LoginRequest) (*common.AuthResponse, error) {
+// Login checks the password and issues tokens, or a challenge to pass to
+// CompleteLogin when the account has two-factor authentication enabled.
+// Repeated failures from ip or for the account are slowed down and then
+// refused for a while with a *RetryError.
+func (s *Service) Login(req common.LoginRequest, ip string) (*common.AuthResponse, *common.LoginChallenge, error) {
+	ctx := context.Background()
+
+	var found *common.User
 	var user common.User
-	if err := s.db.Where("email = ?", req.Email).First(&user).Error; err != nil {
-		return nil, errors.New("invalid credentials")
+	err := s.db.Where("email = ?", req.Email).First(&user).Error
+	if err == nil {
+		found = &user
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, err
+	}
+
+	if err := s.checkLoginAllowed(ctx, found, req.Email, ip); err != nil {
+		return nil, nil, err
+	}
+	if found == nil {
+		return nil, nil, s.loginFailed(ctx, nil, req.Email, ip, ErrInvalidCredentials)
 	}
 
 	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		return nil, errors.New("invalid credentials")
+		return nil, nil, s.loginFailed(ctx, &user, req.Email, ip, ErrInvalidCredentials)
+	}
+	// Only said once the password is right, so it does not reveal accounts.
+	if user.Disabled() {
+		return nil, nil, ErrAccountDisabled
 	}
 
-	token, err := s.generateToken(user.ID, user.Email)
+	enabled, err := s.twoFactorEnabled(user.ID)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-
-	return &common.AuthResponse{
-		Token: token,
-		User:  user,
-	}, nil
-}
-
-func (s *Service) generateToken(userID uint, email string) (string, error) {
-	claims := jwt.MapClaims{
-		"user_id": userID,
-		"email":   email,
-		"exp":     time.Now().Add(time.Hour * 24).Unix(),
+	if enabled {
+		// The account's failures carry over until the second factor passes.
+		challenge, err := s.loginChallenge(user)
+		return nil, challenge, err
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(s.jwtSecret))
-}
\ No newline at end of file
+	if err := s.loginSucceeded(ctx, user.Email); err != nil {
+		return nil, nil, err
+	}
+	response, err := s.issueTokens(user)
+	return response, nil, err
+}
@@ -1,21 +1,46 @@
 package user
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 	"fintrack/internal/common"
+	"fintrack/internal/workspace"
+	"fintrack/pkg/auth"
+	"fintrack/pkg/mail"
+	"fintrack/pkg/middleware"
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
 func setupTestDB() *gorm.DB {
 	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
-	db.AutoMigrate(&common.User{})
+	db.AutoMigrate(&common.User{}, &common.RefreshToken{}, &common.SigningKey{}, &common.UserToken{}, &common.TOTPCredential{}, &common.RecoveryCode{}, &common.AuditEvent{}, &common.APIKey{}, &common.Workspace{}, &common.WorkspaceMember{}, &common.WorkspaceInvitation{})
 	return db
 }
 
+func newTestKeys(t *testing.T, db *gorm.DB, algorithm string) *KeyManager {
+	keys, err := NewKeyManager(db, algorithm, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatalf("Expected key manager, got error: %v", err)
+	}
+	return keys
+}
+
 func TestUserService_Register(t *testing.T) {
 	db := setupTestDB()
-	service := NewService(db, "test-secret")
+	service := NewService(db, newTestKeys(t, db, auth.AlgEdDSA), auth.NewRevocationList(nil), nil, nil, "")
 
 	req := common.RegisterRequest{
 		Email:    "test@example.com",
@@ -39,7 +64,7 @@ func TestUserService_Register(t *testing.T) {
 
 func TestUserService_Login(t *testing.T) {
 	db := setupTestDB()
-	service := NewService(db, "test-secret")
+	service := NewService(db, newTestKeys(t, db, auth.AlgEdDSA), auth.NewRevocationList(nil), nil, nil, "")
 
 	// First register a user
 	registerReq := common.RegisterRequest{
@@ -55,7 +80,7 @@ func TestUserService_Login(t *testing.T) {
 		Password: "password123",
 	}
 
-	response, err := service.Login(loginReq)
+	response, _, err := service.Login(loginReq, "127.0.0.1")
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
@@ -63,4 +88,678 @@ func TestUserService_Login(t *testing.T) {
 	if response.User.Email != loginReq.Email {
 		t.Errorf("Expected email %s, got %s", loginReq.Email, response.User.Email)
 	}
-}
\ No newline at end of file
+}
+func TestUserService_RefreshRotatesAndDetectsReuse(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db, newTestKeys(t, db, auth.AlgEdDSA), auth.NewRevocationList(nil), nil, nil, "")
+
+	registered, err := service.Register(common.RegisterRequest{Email: "test@example.com", Password: "password123", Name: "Test User"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if registered.RefreshToken == "" {
+		t.Fatal("Expected a refresh token")
+	}
+
+	refreshed, err := service.Refresh(registered.RefreshToken)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if refreshed.RefreshToken == registered.RefreshToken || refreshed.Token == "" {
+		t.Error("Expected a new refresh token and access token")
+	}
+
+	// Replaying the first token revokes the whole family, including the new one.
+	if _, err := service.Refresh(registered.RefreshToken); err != ErrRefreshTokenReused {
+		t.Fatalf("Expected ErrRefreshTokenReused, got %v", err)
+	}
+	if _, err := service.Refresh(refreshed.RefreshToken); err != ErrRefreshTokenReused {
+		t.Errorf("Expected the rotated token to be revoked, got %v", err)
+	}
+
+	var stored common.RefreshToken
+	db.Where("token_hash = ?", hashToken(refreshed.RefreshToken)).First(&stored)
+	if stored.RevokedAt == nil {
+		t.Error("Expected the rotated token to be revoked")
+	}
+}
+
+func TestUserService_LogoutRevokesTokens(t *testing.T) {
+	db := setupTestDB()
+	revocations := auth.NewRevocationList(nil)
+	service := NewService(db, newTestKeys(t, db, auth.AlgEdDSA), revocations, nil, nil, "")
+
+	response, _ := service.Register(common.RegisterRequest{Email: "test@example.com", Password: "password123", Name: "Test User"})
+
+	router := gin.New()
+	router.Use(middleware.AuthMiddleware(service.keys, revocations, nil))
+	router.GET("/me", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	router.POST("/logout", NewHandler(service, zap.NewNop()).Logout)
+
+	request := func(method, path, body string) int {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+response.Token)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := request(http.MethodGet, "/me", ""); code != http.StatusOK {
+		t.Fatalf("Expected 200 before logout, got %d", code)
+	}
+	if code := request(http.MethodPost, "/logout", `{"refresh_token":"`+response.RefreshToken+`"}`); code != http.StatusOK {
+		t.Fatalf("Expected 200 from logout, got %d", code)
+	}
+	if code := request(http.MethodGet, "/me", ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 after logout, got %d", code)
+	}
+	if _, err := service.Refresh(response.RefreshToken); err == nil {
+		t.Error("Expected the refresh token to be revoked by logout")
+	}
+}
+
+func TestKeyManager_RotationKeepsOldKeysVerifiable(t *testing.T) {
+	db := setupTestDB()
+	keys := newTestKeys(t, db, auth.AlgRS256)
+	clock := time.Now()
+	keys.now = func() time.Time { return clock }
+	service := NewService(db, keys, auth.NewRevocationList(nil), nil, nil, "")
+	handler := NewHandler(service, zap.NewNop())
+
+	jwksServer := gin.New()
+	jwksServer.GET("/.well-known/jwks.json", handler.GetJWKS)
+	server := httptest.NewServer(jwksServer)
+	defer server.Close()
+	jwksURL := server.URL + "/.well-known/jwks.json"
+
+	before, _ := service.Register(common.RegisterRequest{Email: "test@example.com", Password: "password123", Name: "Test User"})
+
+	status := func(keySet auth.KeySet, token string) int {
+		router := gin.New()
+		router.Use(middleware.AuthMiddleware(keySet, nil, nil))
+		router.GET("/me", func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	remote := auth.NewRemoteKeySet(jwksURL, time.Minute)
+	if code := status(remote, before.Token); code != http.StatusOK {
+		t.Errorf("Expected token from the first key to verify, got %d", code)
+	}
+
+	// Right after a rotation the old key still signs: remote has just
+	// fetched the JWKS and may not refetch to learn the new key yet.
+	rotatedAt := clock.Add(time.Hour)
+	clock = rotatedAt
+	if _, err := keys.Rotate(rotatedAt); err != nil {
+		t.Fatalf("Expected rotation to succeed, got error: %v", err)
+	}
+	pending, _, _ := service.Login(common.LoginRequest{Email: "test@example.com", Password: "password123"}, "127.0.0.1")
+	if code := status(remote, pending.Token); code != http.StatusOK {
+		t.Errorf("Expected a token signed during activation to verify with the cached keys, got %d", code)
+	}
+
+	clock = rotatedAt.Add(activationDelay)
+	after, _, _ := service.Login(common.LoginRequest{Email: "test@example.com", Password: "password123"}, "127.0.0.1")
+	if after.Token[:strings.Index(after.Token, ".")] == before.Token[:strings.Index(before.Token, ".")] {
+		t.Errorf("Expected the new key to sign once activated")
+	}
+	if code := status(auth.NewRemoteKeySet(jwksURL, time.Minute), after.Token); code != http.StatusOK {
+		t.Errorf("Expected token from the new key to verify, got %d", code)
+	}
+	if code := status(auth.NewRemoteKeySet(jwksURL, time.Minute), before.Token); code != http.StatusOK {
+		t.Errorf("Expected token from the retired key to verify during the overlap, got %d", code)
+	}
+
+	jwks, _ := keys.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("Expected 2 published keys during the overlap, got %d", len(jwks.Keys))
+	}
+
+	if _, err := keys.RotateIfDue(rotatedAt.Add(2 * time.Hour)); err != nil {
+		t.Fatalf("Expected pruning to succeed, got error: %v", err)
+	}
+	jwks, _ = keys.JWKS()
+	for _, jwk := range jwks.Keys {
+		if jwk.Alg != auth.AlgRS256 || jwk.Kty != "RSA" {
+			t.Errorf("Expected RS256 RSA keys, got %s %s", jwk.Alg, jwk.Kty)
+		}
+	}
+	if code := status(auth.NewRemoteKeySet(jwksURL, time.Minute), before.Token); code != http.StatusUnauthorized {
+		t.Errorf("Expected token from a pruned key to be rejected, got %d", code)
+	}
+}
+
+var mailedToken = regexp.MustCompile(`(?m)^([A-Za-z0-9_-]{43})\r?$`)
+
+// lastMailedToken returns the token in the newest message in dir and how many
+// messages there are.
+func lastMailedToken(t *testing.T, dir string) (string, int) {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) == 0 {
+		return "", 0
+	}
+	data, err := os.ReadFile(files[len(files)-1])
+	if err != nil {
+		t.Fatalf("Expected to read mail, got error: %v", err)
+	}
+	match := mailedToken.FindSubmatch(data)
+	if match == nil {
+		t.Fatalf("Expected a token in mail, got %q", data)
+	}
+	return string(match[1]), len(files)
+}
+
+func TestUserService_VerifyEmailAndResetPassword(t *testing.T) {
+	db := setupTestDB()
+	dir := t.TempDir()
+	mailer := mail.NewFileMailer(dir, "FinTrack <no-reply@fintrack.local>", zap.NewNop())
+	service := NewService(db, newTestKeys(t, db, auth.AlgEdDSA), auth.NewRevocationList(nil), nil, mailer, "http://localhost:8000")
+
+	response, _ := service.Register(common.RegisterRequest{Email: "test@example.com", Password: "password123", Name: "Test User"})
+	if response.User.EmailVerified {
+		t.Error("Expected a new user to be unverified")
+	}
+	if err := service.SendVerificationEmail(response.User.ID); err != nil {
+		t.Fatalf("Expected verification email, got error: %v", err)
+	}
+	token, _ := lastMailedToken(t, dir)
+
+	user, err := service.VerifyEmail(token)
+	if err != nil {
+		t.Fatalf("Expected verification to succeed, got error: %v", err)
+	}
+	if !user.EmailVerified || user.EmailVerifiedAt == nil {
+		t.Error("Expected the user to be verified")
+	}
+	if _, err := service.VerifyEmail(token); err != ErrInvalidUserToken {
+		t.Errorf("Expected a used token to be rejected, got %v", err)
+	}
+	if err := service.SendVerificationEmail(response.User.ID); err != ErrEmailAlreadyVerified {
+		t.Errorf("Expected ErrEmailAlreadyVerified, got %v", err)
+	}
+
+	if err := service.ForgotPassword("nobody@example.com"); err != nil {
+		t.Fatalf("Expected unknown emails to be ignored, got error: %v", err)
+	}
+	if _, count := lastMailedToken(t, dir); count != 1 {
+		t.Fatalf("Expected no mail for an unknown email, got %d messages", count)
+	}
+
+	service.ForgotPassword("test@example.com")
+	first, _ := lastMailedToken(t, dir)
+	service.ForgotPassword("test@example.com")
+	reset, count := lastMailedToken(t, dir)
+	if count != 3 {
+		t.Fatalf("Expected 3 messages, got %d", count)
+	}
+	if err := service.ResetPassword(first, "newpassword"); err != ErrInvalidUserToken {
+		t.Errorf("Expected a superseded reset token to be rejected, got %v", err)
+	}
+	if err := service.ResetPassword(reset, "newpassword"); err != nil {
+		t.Fatalf("Expected reset to succeed, got error: %v", err)
+	}
+	if err := service.ResetPassword(reset, "otherpassword"); err != ErrInvalidUserToken {
+		t.Errorf("Expected a used reset token to be rejected, got %v", err)
+	}
+
+	if _, _, err := service.Login(common.LoginRequest{Email: "test@example.com", Password: "password123"}, "127.0.0.1"); err == nil {
+		t.Error("Expected the old password to stop working")
+	}
+	if _, _, err := service.Login(common.LoginRequest{Email: "test@example.com", Password: "newpassword"}, "127.0.0.1"); err != nil {
+		t.Errorf("Expected the new password to work, got error: %v", err)
+	}
+	if _, err := service.Refresh(response.RefreshToken); err == nil {
+		t.Error("Expected the reset to revoke existing refresh tokens")
+	}
+}
+
+func TestUserService_TwoFactorLogin(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db, newTestKeys(t, db, auth.AlgEdDSA), auth.NewRevocationList(nil), nil, nil, "")
+
+	registered, _ := service.Register(common.RegisterRequest{Email: "test@example.com", Password: "password123", Name: "Test User"})
+	userID := registered.User.ID
+	login := common.LoginRequest{Email: "test@example.com", Password: "password123"}
+
+	setup, err := service.SetupTwoFactor(userID)
+	if err != nil {
+		t.Fatalf("Expected setup to succeed, got error: %v", err)
+	}
+	if !strings.HasPrefix(setup.URI, "otpauth://totp/FinTrack:test@example.com?") {
+		t.Errorf("Expected an otpauth URI, got %s", setup.URI)
+	}
+	if response, challenge, _ := service.Login(login, "127.0.0.1"); response == nil || challenge != nil {
+		t.Fatal("Expected login without a challenge until two-factor is enabled")
+	}
+
+	step := auth.TOTPStep(time.Now())
+	code, _ := auth.TOTPCode(setup.Secret, step)
+	if _, err := service.EnableTwoFactor(userID, "000000"); err != ErrInvalidTwoFactorCode && code != "000000" {
+		t.Errorf("Expected a wrong code to be rejected, got %v", err)
+	}
+	recoveryCodes, err := service.EnableTwoFactor(userID, code)
+	if err != nil {
+		t.Fatalf("Expected enabling to succeed, got error: %v", err)
+	}
+	if len(recoveryCodes) != recoveryCodeCount {
+		t.Fatalf("Expected %d recovery codes, got %d", recoveryCodeCount, len(recoveryCodes))
+	}
+
+	response, challenge, err := service.Login(login, "127.0.0.1")
+	if err != nil || response != nil || challenge == nil || !challenge.MFARequired {
+		t.Fatalf("Expected a challenge instead of tokens, got %v %v %v", response, challenge, err)
+	}
+	if _, err := service.CompleteLogin(challenge.ChallengeToken, code, "127.0.0.1"); err != ErrInvalidTwoFactorCode {
+		t.Errorf("Expected a replayed code to be rejected, got %v", err)
+	}
+	if _, err := service.CompleteLogin(registered.Token, code, "127.0.0.1"); err != ErrInvalidChallenge {
+		t.Errorf("Expected an access token to be rejected as a challenge, got %v", err)
+	}
+
+	next, _ := auth.TOTPCode(setup.Secret, step+1)
+	completed, err := service.CompleteLogin(challenge.ChallengeToken, next, "127.0.0.1")
+	if err != nil || completed.Token == "" {
+		t.Fatalf("Expected tokens for a valid code, got error: %v", err)
+	}
+
+	recovery := strings.ToUpper(recoveryCodes[0])
+	if _, err := service.CompleteLogin(challenge.ChallengeToken, recovery, "127.0.0.1"); err != nil {
+		t.Errorf("Expected a recovery code to work, got error: %v", err)
+	}
+	if _, err := service.CompleteLogin(challenge.ChallengeToken, recovery, "127.0.0.1"); err != ErrInvalidTwoFactorCode {
+		t.Errorf("Expected a used recovery code to be rejected, got %v", err)
+	}
+
+	if err := service.DisableTwoFactor(userID, "wrongpassword", recoveryCodes[1]); err != ErrInvalidCredentials {
+		t.Errorf("Expected ErrInvalidCredentials, got %v", err)
+	}
+	if err := service.DisableTwoFactor(userID, "password123", recoveryCodes[1]); err != nil {
+		t.Fatalf("Expected disabling to succeed, got error: %v", err)
+	}
+	if response, challenge, _ := service.Login(login, "127.0.0.1"); response == nil || challenge != nil {
+		t.Error("Expected login without a challenge after disabling two-factor")
+	}
+}
+
+func TestUserService_LoginLockout(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db, newTestKeys(t, db, auth.AlgEdDSA), auth.NewRevocationList(nil), auth.NewAttemptCounter(nil, LoginFailureWindow), nil, "")
+	var delays []time.Duration
+	service.sleep = func(d time.Duration) {
+		delays = append(delays, d)
+	}
+
+	service.Register(common.RegisterRequest{Email: "test@example.com", Password: "password123", Name: "Test User"})
+	service.Register(common.RegisterRequest{Email: "other@example.com", Password: "password123", Name: "Other User"})
+	wrong := common.LoginRequest{Email: "test@example.com", Password: "wrong"}
+
+	for i := 1; i < AccountLockThreshold; i++ {
+		if _, _, err := service.Login(wrong, "10.0.0.1"); err != ErrInvalidCredentials {
+			t.Fatalf("Expected ErrInvalidCredentials on attempt %d, got %v", i, err)
+		}
+	}
+	if len(delays) != 2 || delays[0] != time.Second || delays[1] != 2*time.Second {
+		t.Errorf("Expected delays of 1s and 2s, got %v", delays)
+	}
+
+	_, _, err := service.Login(wrong, "10.0.0.1")
+	var retry *RetryError
+	if !errors.As(err, &retry) || !errors.Is(err, ErrAccountLocked) || retry.RetryAfter != AccountLockDuration {
+		t.Fatalf("Expected the account to lock, got %v", err)
+	}
+	var user common.User
+	db.Where("email = ?", "test@example.com").First(&user)
+	if user.LockedUntil == nil || !user.LockedUntil.After(time.Now()) {
+		t.Error("Expected locked_until to be set")
+	}
+	var locks int64
+	db.Model(&common.AuditEvent{}).Where("event = ? AND user_id = ?", common.AuditAccountLocked, user.ID).Count(&locks)
+	if locks != 1 {
+		t.Errorf("Expected 1 lockout audit event, got %d", locks)
+	}
+	if _, _, err := service.Login(common.LoginRequest{Email: "test@example.com", Password: "password123"}, "10.0.0.2"); !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("Expected the right password to be refused while locked, got %v", err)
+	}
+
+	for i := 0; i < AccountLockThreshold; i++ {
+		service.Login(common.LoginRequest{Email: "nobody@example.com", Password: "wrong"}, "10.0.0.3")
+	}
+	if _, _, err := service.Login(common.LoginRequest{Email: "nobody@example.com", Password: "wrong"}, "10.0.0.4"); !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("Expected unknown emails to lock like accounts, got %v", err)
+	}
+
+	for i := 0; i < IPFailureThreshold; i++ {
+		service.Login(common.LoginRequest{Email: fmt.Sprintf("guess%d@example.com", i), Password: "wrong"}, "10.0.0.9")
+	}
+	if _, _, err := service.Login(common.LoginRequest{Email: "other@example.com", Password: "password123"}, "10.0.0.9"); !errors.Is(err, ErrTooManyAttempts) {
+		t.Errorf("Expected the IP to be throttled, got %v", err)
+	}
+	if response, _, err := service.Login(common.LoginRequest{Email: "other@example.com", Password: "password123"}, "10.0.0.10"); err != nil || response == nil {
+		t.Errorf("Expected other IPs to still log in, got %v", err)
+	}
+	var throttles int64
+	db.Model(&common.AuditEvent{}).Where("event = ? AND ip = ?", common.AuditIPThrottled, "10.0.0.9").Count(&throttles)
+	if throttles != 1 {
+		t.Errorf("Expected 1 IP throttle audit event, got %d", throttles)
+	}
+}
+
+func TestUserService_LoginLockoutWithoutRedis(t *testing.T) {
+	db := setupTestDB()
+	down := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer down.Close()
+	service := NewService(db, newTestKeys(t, db, auth.AlgEdDSA), auth.NewRevocationList(nil), auth.NewAttemptCounter(down, LoginFailureWindow), nil, "")
+	service.sleep = func(time.Duration) {}
+
+	service.Register(common.RegisterRequest{Email: "test@example.com", Password: "password123", Name: "Test User"})
+	if response, _, err := service.Login(common.LoginRequest{Email: "test@example.com", Password: "password123"}, "10.0.0.1"); err != nil || response == nil {
+		t.Fatalf("Expected login to work while Redis is down, got %v", err)
+	}
+
+	wrong := common.LoginRequest{Email: "test@example.com", Password: "wrong"}
+	for i := 1; i < AccountLockThreshold; i++ {
+		if _, _, err := service.Login(wrong, "10.0.0.1"); err != ErrInvalidCredentials {
+			t.Fatalf("Expected ErrInvalidCredentials on attempt %d, got %v", i, err)
+		}
+	}
+	if _, _, err := service.Login(wrong, "10.0.0.1"); !errors.Is(err, ErrAccountLocked) {
+		t.Errorf("Expected the account to lock while Redis is down, got %v", err)
+	}
+}
+
+func TestUserService_UpdateProfileAndChangePassword(t *testing.T) {
+	db := setupTestDB()
+	db.AutoMigrate(&common.Report{})
+	service := NewService(db, newTestKeys(t, db, auth.AlgEdDSA), auth.NewRevocationList(nil), nil, nil, "")
+
+	registered, _ := service.Register(common.RegisterRequest{Email: "test@example.com", Password: "password123", Name: "Test User"})
+	service.Register(common.RegisterRequest{Email: "other@example.com", Password: "password123", Name: "Other User"})
+	userID := registered.User.ID
+	personal, _ := workspace.PersonalWorkspace(db, userID)
+	db.Create(&common.Report{WorkspaceID: personal.ID, UserID: userID, Type: "monthly", Period: "2024-01", Data: "{}"})
+
+	name, currency, email := "Renamed", "eur", "new@example.com"
+	user, emailChanged, err := service.UpdateProfile(userID, common.UpdateProfileRequest{Name: &name, BaseCurrency: &currency})
+	if err != nil || emailChanged {
+		t.Fatalf("Expected profile update without email change, got %v", err)
+	}
+	if user.Name != "Renamed" || user.BaseCurrency != "EUR" {
+		t.Errorf("Expected Renamed/EUR, got %s/%s", user.Name, user.BaseCurrency)
+	}
+	var report common.Report
+	db.Where("user_id = ?", userID).First(&report)
+	if !report.Stale {
+		t.Error("Expected a base currency change to mark reports stale")
+	}
+	personal, _ = workspace.PersonalWorkspace(db, userID)
+	if personal.BaseCurrency != "EUR" {
+		t.Errorf("Expected the personal workspace in EUR, got %s", personal.BaseCurrency)
+	}
+
+	if _, _, err := service.UpdateProfile(userID, common.UpdateProfileRequest{Email: &email}); err != ErrPasswordRequired {
+		t.Errorf("Expected ErrPasswordRequired, got %v", err)
+	}
+	taken := "other@example.com"
+	if _, _, err := service.UpdateProfile(userID, common.UpdateProfileRequest{Email: &taken, CurrentPassword: "password123"}); err != ErrEmailTaken {
+		t.Errorf("Expected ErrEmailTaken, got %v", err)
+	}
+	reset, _ := service.createUserToken(db, userID, common.TokenPurposeResetPassword, PasswordResetTokenTTL)
+	user, emailChanged, err = service.UpdateProfile(userID, common.UpdateProfileRequest{Email: &email, CurrentPassword: "password123"})
+	if err != nil || !emailChanged || user.Email != email || user.EmailVerified {
+		t.Fatalf("Expected an unverified email change, got %v", err)
+	}
+	if err := service.ResetPassword(reset, "otherpassword"); err != ErrInvalidUserToken {
+		t.Errorf("Expected a reset token issued before the email change to be rejected, got %v", err)
+	}
+	if user, _ = service.GetUser(userID); user.EmailVerified {
+		t.Error("Expected the new email to stay unverified")
+	}
+
+	request := common.ChangePasswordRequest{CurrentPassword: "wrong", NewPassword: "newpassword"}
+	if _, err := service.ChangePassword(userID, "", time.Time{}, request); err != ErrInvalidCredentials {
+		t.Errorf("Expected ErrInvalidCredentials, got %v", err)
+	}
+	request.CurrentPassword = "password123"
+	response, err := service.ChangePassword(userID, "", time.Time{}, request)
+	if err != nil || response.RefreshToken == "" {
+		t.Fatalf("Expected new tokens, got error: %v", err)
+	}
+	if _, err := service.Refresh(registered.RefreshToken); err == nil {
+		t.Error("Expected the old session to be signed out")
+	}
+	if _, err := service.Refresh(response.RefreshToken); err != nil {
+		t.Errorf("Expected the new session to work, got error: %v", err)
+	}
+}
+
+func TestUserService_DeleteAccountCascades(t *testing.T) {
+	db := setupTestDB()
+	db.AutoMigrate(&common.Expense{}, &common.Budget{}, &common.Report{}, &common.ExpenseVersion{})
+	service := NewService(db, newTestKeys(t, db, auth.AlgEdDSA), auth.NewRevocationList(nil), nil, nil, "")
+
+	registered, _ := service.Register(common.RegisterRequest{Email: "test@example.com", Password: "password123", Name: "Test User"})
+	other, _ := service.Register(common.RegisterRequest{Email: "other@example.com", Password: "password123", Name: "Other User"})
+	userID := registered.User.ID
+
+	for _, id := range []uint{userID, other.User.ID} {
+		personal, _ := workspace.PersonalWorkspace(db, id)
+		db.Create(&common.Expense{WorkspaceID: personal.ID, UserID: id, Amount: common.MustParseMoney("10.00", "USD"), Category: "Food", Date: time.Now()})
+		db.Create(&common.Budget{WorkspaceID: personal.ID, UserID: id, Category: "Food", Period: "monthly", Limit: common.MustParseMoney("100.00", "USD")})
+		db.Create(&common.Report{WorkspaceID: personal.ID, UserID: id, Type: "monthly", Period: "2024-01", Data: "{}"})
+	}
+
+	if err := service.DeleteAccount(userID, "wrong", "", time.Time{}); err != ErrInvalidCredentials {
+		t.Errorf("Expected ErrInvalidCredentials, got %v", err)
+	}
+	if err := service.DeleteAccount(userID, "password123", "", time.Time{}); err != nil {
+		t.Fatalf("Expected deletion to succeed, got error: %v", err)
+	}
+
+	var count int64
+	db.Model(&common.Expense{}).Where("user_id = ?", userID).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected expenses to be deleted, got %d", count)
+	}
+	db.Unscoped().Model(&common.Expense{}).Where("user_id = ? AND deleted_at IS NOT NULL", userID).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected the expense to be soft-deleted, got %d", count)
+	}
+	db.Model(&common.Budget{}).Where("user_id = ?", userID).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected budgets to be deleted, got %d", count)
+	}
+	db.Model(&common.Report{}).Where("user_id = ?", userID).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected reports to be removed, got %d", count)
+	}
+	db.Model(&common.Expense{}).Where("user_id = ?", other.User.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected other users' expenses to remain, got %d", count)
+	}
+
+	if _, err := service.GetUser(userID); err != gorm.ErrRecordNotFound {
+		t.Errorf("Expected the user to be gone, got %v", err)
+	}
+	if _, err := service.Refresh(registered.RefreshToken); err == nil {
+		t.Error("Expected the refresh token to stop working")
+	}
+	if _, err := service.Register(common.RegisterRequest{Email: "test@example.com", Password: "password123", Name: "New User"}); err != nil {
+		t.Errorf("Expected the email to be free again, got error: %v", err)
+	}
+}
+
+func TestUserService_APIKeysEnforceScopes(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db, newTestKeys(t, db, auth.AlgEdDSA), auth.NewRevocationList(nil), nil, nil, "")
+	registered, _ := service.Register(common.RegisterRequest{Email: "test@example.com", Password: "password123", Name: "Test User"})
+	userID := registered.User.ID
+
+	if _, err := service.CreateAPIKey(userID, common.APIKeyRequest{Name: "bad", Scopes: []string{"admin"}}); err == nil {
+		t.Error("Expected an unknown scope to be rejected")
+	}
+	created, err := service.CreateAPIKey(userID, common.APIKeyRequest{Name: "script", Scopes: []string{"expenses:read", "reports:write"}})
+	if err != nil {
+		t.Fatalf("Expected API key, got error: %v", err)
+	}
+	if !strings.HasPrefix(created.Key, created.Prefix+"_") {
+		t.Errorf("Expected key to start with its prefix %s, got %s", created.Prefix, created.Key)
+	}
+	body, _ := json.Marshal(created)
+	if !strings.Contains(string(body), `"scopes":["expenses:read","reports:write"]`) || !strings.Contains(string(body), created.Key) {
+		t.Errorf("Expected scopes and key in the creation response, got %s", body)
+	}
+
+	router := gin.New()
+	routes := func(path, read, write string) {
+		group := router.Group(path)
+		group.Use(middleware.AuthMiddleware(service.keys, nil, NewAPIKeyStore(db)), middleware.RequireScopes(read, write))
+		group.GET("", func(c *gin.Context) { c.Status(http.StatusOK) })
+		group.POST("", func(c *gin.Context) { c.Status(http.StatusCreated) })
+	}
+	routes("/expenses", auth.ScopeExpensesRead, auth.ScopeExpensesWrite)
+	routes("/reports", auth.ScopeReportsRead, auth.ScopeReportsWrite)
+	routes("/budgets", auth.ScopeBudgetsRead, auth.ScopeBudgetsWrite)
+
+	request := func(method, path, header, value string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set(header, value)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	cases := []struct {
+		method, path, header, value string
+		want                        int
+	}{
+		{http.MethodGet, "/expenses", "Authorization", "Bearer " + created.Key, http.StatusOK},
+		{http.MethodPost, "/expenses", "Authorization", "Bearer " + created.Key, http.StatusForbidden},
+		{http.MethodGet, "/reports", "X-API-Key", created.Key, http.StatusOK},
+		{http.MethodPost, "/reports", "X-API-Key", created.Key, http.StatusCreated},
+		{http.MethodGet, "/budgets", "X-API-Key", created.Key, http.StatusForbidden},
+		{http.MethodPost, "/budgets", "Authorization", "Bearer " + registered.Token, http.StatusCreated},
+		{http.MethodGet, "/expenses", "X-API-Key", created.Key + "x", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		if code := request(tc.method, tc.path, tc.header, tc.value); code != tc.want {
+			t.Errorf("Expected %d for %s %s, got %d", tc.want, tc.method, tc.path, code)
+		}
+	}
+
+	keys, _ := service.ListAPIKeys(userID)
+	if len(keys) != 1 || keys[0].LastUsedAt == nil {
+		t.Fatalf("Expected one key with a last-used time, got %+v", keys)
+	}
+	if err := service.RevokeAPIKey(userID+1, created.ID); err != ErrAPIKeyNotFound {
+		t.Errorf("Expected ErrAPIKeyNotFound for another user, got %v", err)
+	}
+	if err := service.RevokeAPIKey(userID, created.ID); err != nil {
+		t.Fatalf("Expected revoke to succeed, got error: %v", err)
+	}
+	if code := request(http.MethodGet, "/expenses", "X-API-Key", created.Key); code != http.StatusUnauthorized {
+		t.Errorf("Expected a revoked key to be rejected, got %d", code)
+	}
+}
+
+func TestUserService_AdminRolesAndDisable(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db, newTestKeys(t, db, auth.AlgEdDSA), auth.NewRevocationList(nil), nil, nil, "")
+	admin, _ := service.Register(common.RegisterRequest{Email: "admin@example.com", Password: "password123", Name: "Admin"})
+	target, _ := service.Register(common.RegisterRequest{Email: "jane@example.com", Password: "password123", Name: "Jane Doe"})
+	service.Register(common.RegisterRequest{Email: "other@example.com", Password: "password123", Name: "Other"})
+
+	missing, err := GrantAdmin(db, []string{"Admin@Example.com", "nobody@example.com"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(missing) != 1 || missing[0] != "nobody@example.com" {
+		t.Errorf("Expected nobody@example.com to be reported missing, got %v", missing)
+	}
+
+	adminLogin, _, err := service.Login(common.LoginRequest{Email: "admin@example.com", Password: "password123"}, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("Expected admin login, got error: %v", err)
+	}
+	created, _ := service.CreateAPIKey(admin.User.ID, common.APIKeyRequest{Name: "script", Scopes: []string{"expenses:read"}})
+
+	router := gin.New()
+	group := router.Group("/admin")
+	group.Use(middleware.AuthMiddleware(service.keys, nil, NewAPIKeyStore(db)))
+	NewHandler(service, zap.NewNop()).SetupAdminRoutes(group)
+
+	request := func(method, path, header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set(header, value)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request(http.MethodGet, "/admin/users?q=JANE", "Authorization", "Bearer "+adminLogin.Token)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"total":1`) || !strings.Contains(w.Body.String(), "jane@example.com") {
+		t.Errorf("Expected the search to find Jane only, got %d %s", w.Code, w.Body.String())
+	}
+	if w := request(http.MethodGet, "/admin/stats", "Authorization", "Bearer "+target.Token); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for a user without roles, got %d", w.Code)
+	}
+	if w := request(http.MethodGet, "/admin/stats", "X-API-Key", created.Key); w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for an API key, got %d", w.Code)
+	}
+	w = request(http.MethodGet, "/admin/stats", "Authorization", "Bearer "+adminLogin.Token)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"total":3`) {
+		t.Errorf("Expected stats for 3 users, got %d %s", w.Code, w.Body.String())
+	}
+
+	if _, err := service.SetUserRoles(admin.User.ID, admin.User.ID, nil); err != ErrCannotDemoteSelf {
+		t.Errorf("Expected ErrCannotDemoteSelf, got %v", err)
+	}
+	supported, err := service.SetUserRoles(admin.User.ID, target.User.ID, []string{"support", "support"})
+	if err != nil || supported.Roles != "support" {
+		t.Fatalf("Expected the support role, got %+v, %v", supported, err)
+	}
+	list, _ := service.ListUsers(UserFilter{Role: auth.UserRoleSupport})
+	if list.Total != 1 || list.Users[0].ID != target.User.ID {
+		t.Errorf("Expected only Jane to hold the support role, got %+v", list)
+	}
+
+	if _, err := service.DisableUser(admin.User.ID, admin.User.ID, ""); err != ErrCannotDisableSelf {
+		t.Errorf("Expected ErrCannotDisableSelf, got %v", err)
+	}
+	disabled, err := service.DisableUser(admin.User.ID, target.User.ID, "chargeback")
+	if err != nil || !disabled.Disabled() {
+		t.Fatalf("Expected the account to be disabled, got %+v, %v", disabled, err)
+	}
+	if _, _, err := service.Login(common.LoginRequest{Email: "jane@example.com", Password: "password123"}, "10.0.0.2"); err != ErrAccountDisabled {
+		t.Errorf("Expected ErrAccountDisabled on login, got %v", err)
+	}
+	if _, err := service.Refresh(target.RefreshToken); err == nil {
+		t.Error("Expected refresh to fail for a disabled account")
+	}
+	list, _ = service.ListUsers(UserFilter{Status: UserStatusDisabled})
+	if list.Total != 1 {
+		t.Errorf("Expected 1 disabled account, got %d", list.Total)
+	}
+
+	if _, err := service.EnableUser(admin.User.ID, target.User.ID); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	login, _, err := service.Login(common.LoginRequest{Email: "jane@example.com", Password: "password123"}, "10.0.0.2")
+	if err != nil {
+		t.Fatalf("Expected login after re-enabling, got error: %v", err)
+	}
+	if w := request(http.MethodGet, "/admin/users/"+fmt.Sprint(admin.User.ID), "Authorization", "Bearer "+login.Token); w.Code != http.StatusOK {
+		t.Errorf("Expected support to read users, got %d", w.Code)
+	}
+	if w := request(http.MethodPost, "/admin/users/"+fmt.Sprint(admin.User.ID)+"/disable", "Authorization", "Bearer "+login.Token); w.Code != http.StatusForbidden {
+		t.Errorf("Expected support not to disable users, got %d", w.Code)
+	}
+}
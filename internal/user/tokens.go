@@ -0,0 +1,214 @@
+package user
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+	"fintrack/internal/common"
+	"fintrack/pkg/auth"
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected; all sessions from this login have been revoked")
+)
+
+// issueTokens starts a new refresh token family for user.
+func (s *Service) issueTokens(user common.User) (*common.AuthResponse, error) {
+	if user.Disabled() {
+		return nil, ErrAccountDisabled
+	}
+
+	family, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, _, err := s.createRefreshToken(s.db, user.ID, family)
+	if err != nil {
+		return nil, err
+	}
+	return s.authResponse(user, refresh)
+}
+
+func (s *Service) authResponse(user common.User, refresh string) (*common.AuthResponse, error) {
+	token, err := s.generateToken(user)
+	if err != nil {
+		return nil, err
+	}
+
+	return &common.AuthResponse{
+		Token:        token,
+		RefreshToken: refresh,
+		ExpiresIn:    int(AccessTokenTTL.Seconds()),
+		User:         user,
+	}, nil
+}
+
+func (s *Service) createRefreshToken(db *gorm.DB, userID uint, family string) (string, *common.RefreshToken, error) {
+	value, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	record := common.RefreshToken{
+		UserID:    userID,
+		FamilyID:  family,
+		TokenHash: hashToken(value),
+		ExpiresAt: time.Now().Add(RefreshTokenTTL),
+	}
+	if err := db.Create(&record).Error; err != nil {
+		return "", nil, err
+	}
+	return value, &record, nil
+}
+
+// Refresh exchanges a refresh token for a new access and refresh token. A
+// token can be used once; presenting it again revokes its whole family, since
+// either the client or an attacker holds a stolen copy.
+func (s *Service) Refresh(refreshToken string) (*common.AuthResponse, error) {
+	var record common.RefreshToken
+	if err := s.db.Where("token_hash = ?", hashToken(refreshToken)).First(&record).Error; err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if record.RevokedAt != nil {
+		if err := s.revokeFamily(record.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, ErrRefreshTokenReused
+	}
+	if time.Now().After(record.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	var user common.User
+	if err := s.db.First(&user, record.UserID).Error; err != nil {
+		return nil, ErrInvalidRefreshToken
+	}
+	if user.Disabled() {
+		return nil, ErrAccountDisabled
+	}
+
+	var next string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		value, replacement, err := s.createRefreshToken(tx, record.UserID, record.FamilyID)
+		if err != nil {
+			return err
+		}
+
+		// Losing this race means a concurrent refresh already used the token.
+		result := tx.Model(&record).Where("revoked_at IS NULL").Updates(map[string]interface{}{
+			"revoked_at":     time.Now(),
+			"replaced_by_id": replacement.ID,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		next = value
+		return nil
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		if revokeErr := s.revokeFamily(record.FamilyID); revokeErr != nil {
+			return nil, revokeErr
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return s.authResponse(user, next)
+}
+
+// Logout revokes the access token identified by jti and, when given, the
+// refresh token family it was issued with.
+func (s *Service) Logout(userID uint, jti string, expiresAt time.Time, refreshToken string) error {
+	if err := s.revokeAccessToken(jti, expiresAt); err != nil {
+		return err
+	}
+
+	if refreshToken == "" {
+		return nil
+	}
+	var record common.RefreshToken
+	err := s.db.Where("token_hash = ? AND user_id = ?", hashToken(refreshToken), userID).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return err
+	}
+	return s.revokeFamily(record.FamilyID)
+}
+
+func (s *Service) revokeFamily(family string) error {
+	return s.db.Model(&common.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", family).
+		Update("revoked_at", time.Now()).Error
+}
+
+func (s *Service) JWKS() (*auth.JWKS, error) {
+	return s.keys.JWKS()
+}
+
+// generateToken signs an access token for user. The roles it carries are
+// read again on every refresh, so role changes apply within AccessTokenTTL.
+func (s *Service) generateToken(user common.User) (string, error) {
+	jti, err := randomID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"user_id": user.ID,
+		"email":   user.Email,
+		"typ":     "access",
+		"jti":     jti,
+		"iat":     now.Unix(),
+		"exp":     now.Add(AccessTokenTTL).Unix(),
+	}
+	if roles := user.RoleList(); len(roles) > 0 {
+		claims["roles"] = roles
+	}
+
+	return s.keys.Sign(claims)
+}
+
+// randomID returns a 128-bit random hex identifier.
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// randomToken returns a 256-bit random secret for handing to clients.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
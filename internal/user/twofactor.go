@@ -0,0 +1,321 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+	"fintrack/internal/common"
+	"fintrack/pkg/auth"
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	ChallengeTokenTTL  = 5 * time.Minute
+	totpIssuer         = "FinTrack"
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 16
+)
+
+var (
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrInvalidChallenge        = errors.New("invalid or expired login challenge")
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotSetUp       = errors.New("two-factor authentication has not been set up")
+)
+
+var recoveryEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// SetupTwoFactor starts enrollment with a fresh secret. Login is unaffected
+// until EnableTwoFactor confirms a code from it.
+func (s *Service) SetupTwoFactor(userID uint) (*common.TwoFactorSetup, error) {
+	var user common.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	credential, err := s.totpCredential(s.db, userID)
+	if err != nil {
+		return nil, err
+	}
+	if credential != nil && credential.Enabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&common.TOTPCredential{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&common.TOTPCredential{UserID: userID, Secret: secret}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &common.TwoFactorSetup{
+		Secret: secret,
+		URI:    auth.TOTPURI(totpIssuer, user.Email, secret),
+	}, nil
+}
+
+// EnableTwoFactor turns on two-factor login once code matches the pending
+// secret, and returns the recovery codes. They are only shown this once.
+func (s *Service) EnableTwoFactor(userID uint, code string) ([]string, error) {
+	var codes []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		credential, err := s.totpCredential(tx, userID)
+		if err != nil {
+			return err
+		}
+		if credential == nil {
+			return ErrTwoFactorNotSetUp
+		}
+		if credential.Enabled {
+			return ErrTwoFactorAlreadyEnabled
+		}
+		if err := useTOTPCode(tx, credential, code); err != nil {
+			return err
+		}
+		if err := tx.Model(credential).Update("enabled", true).Error; err != nil {
+			return err
+		}
+
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// DisableTwoFactor needs the password as well as a code, so a stolen session
+// alone cannot weaken the account.
+func (s *Service) DisableTwoFactor(userID uint, password, code string) error {
+	var user common.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		return ErrInvalidCredentials
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.verifySecondFactor(tx, userID, code); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&common.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", userID).Delete(&common.TOTPCredential{}).Error
+	})
+}
+
+// RegenerateRecoveryCodes replaces every recovery code, used or not.
+func (s *Service) RegenerateRecoveryCodes(userID uint, code string) ([]string, error) {
+	var codes []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.verifySecondFactor(tx, userID, code); err != nil {
+			return err
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// CompleteLogin exchanges a challenge from Login and a TOTP or recovery code
+// for tokens. Wrong codes count towards the account lockout like wrong
+// passwords.
+func (s *Service) CompleteLogin(challengeToken, code, ip string) (*common.AuthResponse, error) {
+	ctx := context.Background()
+	userID, err := s.parseChallenge(challengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var user common.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, ErrInvalidChallenge
+	}
+	if err := s.checkLoginAllowed(ctx, &user, user.Email, ip); err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		return s.verifySecondFactor(tx, userID, code)
+	})
+	if errors.Is(err, ErrInvalidTwoFactorCode) {
+		return nil, s.loginFailed(ctx, &user, user.Email, ip, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.loginSucceeded(ctx, user.Email); err != nil {
+		return nil, err
+	}
+	return s.issueTokens(user)
+}
+
+// twoFactorEnabled reports whether Login must stop at a challenge.
+func (s *Service) twoFactorEnabled(userID uint) (bool, error) {
+	credential, err := s.totpCredential(s.db, userID)
+	if err != nil {
+		return false, err
+	}
+	return credential != nil && credential.Enabled, nil
+}
+
+func (s *Service) loginChallenge(user common.User) (*common.LoginChallenge, error) {
+	jti, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	token, err := s.keys.Sign(jwt.MapClaims{
+		"user_id": user.ID,
+		"typ":     "mfa_challenge",
+		"jti":     jti,
+		"iat":     now.Unix(),
+		"exp":     now.Add(ChallengeTokenTTL).Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &common.LoginChallenge{
+		MFARequired:    true,
+		ChallengeToken: token,
+		ExpiresIn:      int(ChallengeTokenTTL.Seconds()),
+	}, nil
+}
+
+func (s *Service) parseChallenge(challengeToken string) (uint, error) {
+	token, err := jwt.Parse(challengeToken, auth.Keyfunc(context.Background(), s.keys), auth.ValidMethods)
+	if err != nil || !token.Valid {
+		return 0, ErrInvalidChallenge
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	userID, hasUser := claims["user_id"].(float64)
+	exp, _ := claims.GetExpirationTime()
+	if !ok || !hasUser || exp == nil || claims["typ"] != "mfa_challenge" {
+		return 0, ErrInvalidChallenge
+	}
+	return uint(userID), nil
+}
+
+// verifySecondFactor accepts a current TOTP code or an unused recovery code.
+func (s *Service) verifySecondFactor(tx *gorm.DB, userID uint, code string) error {
+	credential, err := s.totpCredential(tx, userID)
+	if err != nil {
+		return err
+	}
+	if credential == nil || !credential.Enabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	code = strings.TrimSpace(code)
+	if len(code) == auth.TOTPDigits {
+		return useTOTPCode(tx, credential, code)
+	}
+	return useRecoveryCode(tx, userID, code)
+}
+
+func (s *Service) totpCredential(db *gorm.DB, userID uint) (*common.TOTPCredential, error) {
+	var credential common.TOTPCredential
+	err := db.Where("user_id = ?", userID).First(&credential).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &credential, nil
+}
+
+// useTOTPCode accepts code once; the conditional update loses to any
+// concurrent use of the same or a later step.
+func useTOTPCode(tx *gorm.DB, credential *common.TOTPCredential, code string) error {
+	step, ok := auth.ValidateTOTP(credential.Secret, code, time.Now())
+	if !ok || step <= credential.LastUsedStep {
+		return ErrInvalidTwoFactorCode
+	}
+
+	result := tx.Model(credential).Where("last_used_step < ?", step).Update("last_used_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func useRecoveryCode(tx *gorm.DB, userID uint, code string) error {
+	var record common.RecoveryCode
+	err := tx.Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, hashToken(normalizeRecoveryCode(code))).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrInvalidTwoFactorCode
+	}
+	if err != nil {
+		return err
+	}
+
+	result := tx.Model(&record).Where("used_at IS NULL").Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&common.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	records := make([]common.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, recoveryCodeLength*5/8)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		raw := recoveryEncoding.EncodeToString(b)
+		codes[i] = raw[:4] + "-" + raw[4:8] + "-" + raw[8:12] + "-" + raw[12:]
+		records[i] = common.RecoveryCode{UserID: userID, CodeHash: hashToken(raw)}
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes so codes can be typed
+// the way they were written down.
+func normalizeRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(code))
+}
@@ -0,0 +1,316 @@
+package workspace
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"fintrack/internal/common"
+	"fintrack/pkg/auth"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type Handler struct {
+	service *Service
+	logger  *zap.Logger
+}
+
+func NewHandler(service *Service, logger *zap.Logger) *Handler {
+	return &Handler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+func (h *Handler) CreateWorkspace(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	var req common.WorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	workspace, err := h.service.CreateWorkspace(userID, req)
+	if err != nil {
+		h.logger.Error("Failed to create workspace", zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, workspace)
+}
+
+func (h *Handler) GetWorkspaces(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	memberships, err := h.service.ListWorkspaces(userID)
+	if err != nil {
+		h.logger.Error("Failed to get workspaces", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"workspaces": memberships})
+}
+
+func (h *Handler) GetWorkspace(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	workspaceID, ok := parseID(c, "id", "Invalid workspace ID")
+	if !ok {
+		return
+	}
+
+	workspace, role, err := h.service.GetWorkspace(userID, workspaceID)
+	if err != nil {
+		h.fail(c, "Failed to get workspace", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"workspace": workspace, "role": role})
+}
+
+func (h *Handler) UpdateWorkspace(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	workspaceID, ok := parseID(c, "id", "Invalid workspace ID")
+	if !ok {
+		return
+	}
+
+	var req common.UpdateWorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	workspace, err := h.service.UpdateWorkspace(userID, workspaceID, req)
+	if err != nil {
+		h.fail(c, "Failed to update workspace", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, workspace)
+}
+
+func (h *Handler) DeleteWorkspace(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	workspaceID, ok := parseID(c, "id", "Invalid workspace ID")
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeleteWorkspace(userID, workspaceID); err != nil {
+		h.fail(c, "Failed to delete workspace", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Workspace deleted successfully"})
+}
+
+func (h *Handler) GetMembers(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	workspaceID, ok := parseID(c, "id", "Invalid workspace ID")
+	if !ok {
+		return
+	}
+
+	members, err := h.service.ListMembers(userID, workspaceID)
+	if err != nil {
+		h.fail(c, "Failed to get workspace members", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"members": members})
+}
+
+func (h *Handler) UpdateMember(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	workspaceID, ok := parseID(c, "id", "Invalid workspace ID")
+	if !ok {
+		return
+	}
+	memberID, ok := parseID(c, "userId", "Invalid user ID")
+	if !ok {
+		return
+	}
+
+	var req common.MemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	member, err := h.service.UpdateMemberRole(userID, workspaceID, memberID, req.Role)
+	if err != nil {
+		h.fail(c, "Failed to update workspace member", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, member)
+}
+
+func (h *Handler) RemoveMember(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	workspaceID, ok := parseID(c, "id", "Invalid workspace ID")
+	if !ok {
+		return
+	}
+	memberID, ok := parseID(c, "userId", "Invalid user ID")
+	if !ok {
+		return
+	}
+
+	if err := h.service.RemoveMember(userID, workspaceID, memberID); err != nil {
+		h.fail(c, "Failed to remove workspace member", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed successfully"})
+}
+
+func (h *Handler) CreateInvitation(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	workspaceID, ok := parseID(c, "id", "Invalid workspace ID")
+	if !ok {
+		return
+	}
+
+	var req common.InvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	invitation, err := h.service.Invite(userID, workspaceID, req)
+	if err != nil {
+		h.fail(c, "Failed to invite workspace member", err)
+		return
+	}
+
+	// The invitation stands either way; it can be sent again by inviting anew.
+	if err := h.service.SendInvitationEmail(invitation); err != nil {
+		h.logger.Error("Failed to send invitation email", zap.Uint("invitation_id", invitation.ID), zap.Error(err))
+	}
+
+	c.JSON(http.StatusCreated, invitation)
+}
+
+func (h *Handler) GetInvitations(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	workspaceID, ok := parseID(c, "id", "Invalid workspace ID")
+	if !ok {
+		return
+	}
+
+	invitations, err := h.service.ListInvitations(userID, workspaceID)
+	if err != nil {
+		h.fail(c, "Failed to get invitations", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invitations": invitations})
+}
+
+func (h *Handler) RevokeInvitation(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	workspaceID, ok := parseID(c, "id", "Invalid workspace ID")
+	if !ok {
+		return
+	}
+	invitationID, ok := parseID(c, "invitationId", "Invalid invitation ID")
+	if !ok {
+		return
+	}
+
+	if err := h.service.RevokeInvitation(userID, workspaceID, invitationID); err != nil {
+		h.fail(c, "Failed to revoke invitation", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation revoked successfully"})
+}
+
+func (h *Handler) GetMyInvitations(c *gin.Context) {
+	userID := c.GetUint("user_id")
+
+	invitations, err := h.service.PendingInvitations(userID)
+	if err != nil {
+		h.logger.Error("Failed to get invitations", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invitations": invitations})
+}
+
+func (h *Handler) AcceptInvitation(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	invitationID, ok := parseID(c, "invitationId", "Invalid invitation ID")
+	if !ok {
+		return
+	}
+
+	member, err := h.service.AcceptInvitation(userID, invitationID)
+	if err != nil {
+		h.fail(c, "Failed to accept invitation", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, member)
+}
+
+func (h *Handler) DeclineInvitation(c *gin.Context) {
+	userID := c.GetUint("user_id")
+	invitationID, ok := parseID(c, "invitationId", "Invalid invitation ID")
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeclineInvitation(userID, invitationID); err != nil {
+		h.fail(c, "Failed to decline invitation", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation declined"})
+}
+
+func (h *Handler) fail(c *gin.Context, message string, err error) {
+	switch {
+	case errors.Is(err, ErrWorkspaceNotFound), errors.Is(err, ErrMemberNotFound), errors.Is(err, ErrInvitationNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, auth.ErrInsufficientRole), errors.Is(err, ErrEmailNotVerified):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrAlreadyMember), errors.Is(err, ErrInvitationClosed):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		h.logger.Error(message, zap.Error(err))
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	}
+}
+
+func parseID(c *gin.Context, param, message string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(param), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func (h *Handler) SetupRoutes(router *gin.RouterGroup) {
+	router.POST("", h.CreateWorkspace)
+	router.GET("", h.GetWorkspaces)
+	router.GET("/invitations", h.GetMyInvitations)
+	router.POST("/invitations/:invitationId/accept", h.AcceptInvitation)
+	router.POST("/invitations/:invitationId/decline", h.DeclineInvitation)
+
+	router.GET("/:id", h.GetWorkspace)
+	router.PATCH("/:id", h.UpdateWorkspace)
+	router.DELETE("/:id", h.DeleteWorkspace)
+	router.GET("/:id/members", h.GetMembers)
+	router.PUT("/:id/members/:userId", h.UpdateMember)
+	router.DELETE("/:id/members/:userId", h.RemoveMember)
+	router.POST("/:id/invitations", h.CreateInvitation)
+	router.GET("/:id/invitations", h.GetInvitations)
+	router.DELETE("/:id/invitations/:invitationId", h.RevokeInvitation)
+}
@@ -0,0 +1,207 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"fintrack/internal/common"
+	"fintrack/pkg/auth"
+	"fintrack/pkg/mail"
+	"gorm.io/gorm"
+)
+
+// Invite offers role in a shared workspace to email. A pending invitation to
+// the same address is replaced.
+func (s *Service) Invite(userID, workspaceID uint, req common.InvitationRequest) (*common.WorkspaceInvitation, error) {
+	if req.Role != auth.RoleEditor && req.Role != auth.RoleViewer {
+		return nil, fmt.Errorf("role must be %s or %s", auth.RoleEditor, auth.RoleViewer)
+	}
+	workspace, _, err := s.requireRole(workspaceID, userID, auth.RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+	if workspace.Personal() {
+		return nil, ErrPersonalWorkspace
+	}
+
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	var members int64
+	err = s.db.Model(&common.WorkspaceMember{}).
+		Joins("JOIN users ON users.id = workspace_members.user_id").
+		Where("workspace_members.workspace_id = ? AND LOWER(users.email) = ?", workspaceID, email).
+		Count(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	if members > 0 {
+		return nil, ErrAlreadyMember
+	}
+
+	invitation := common.WorkspaceInvitation{
+		WorkspaceID: workspaceID,
+		Email:       email,
+		Role:        req.Role,
+		InvitedByID: userID,
+		Status:      common.InvitationPending,
+		ExpiresAt:   time.Now().Add(InvitationTTL),
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&common.WorkspaceInvitation{}).
+			Where("workspace_id = ? AND email = ? AND status = ?", workspaceID, email, common.InvitationPending).
+			Updates(map[string]interface{}{"status": common.InvitationRevoked, "responded_at": time.Now()}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&invitation).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &invitation, nil
+}
+
+// SendInvitationEmail tells the invitee about invitation.
+func (s *Service) SendInvitationEmail(invitation *common.WorkspaceInvitation) error {
+	var workspace common.Workspace
+	if err := s.db.First(&workspace, invitation.WorkspaceID).Error; err != nil {
+		return err
+	}
+	var inviter common.User
+	if err := s.db.First(&inviter, invitation.InvitedByID).Error; err != nil {
+		return err
+	}
+
+	return s.sendMail(invitation.Email, fmt.Sprintf("%s invited you to %s on FinTrack", inviter.Name, workspace.Name), fmt.Sprintf(
+		"Hi,\n\n%s has invited you to join the workspace %q as %s. The invitation expires in %s.\n\nSign in to FinTrack with this email address to accept or decline it.%s\n",
+		inviter.Name, workspace.Name, invitation.Role, InvitationTTL, s.link("/workspaces/invitations")))
+}
+
+// ListInvitations returns a workspace's invitations for its owner.
+func (s *Service) ListInvitations(userID, workspaceID uint) ([]common.WorkspaceInvitation, error) {
+	if _, _, err := s.requireRole(workspaceID, userID, auth.RoleOwner); err != nil {
+		return nil, err
+	}
+
+	var invitations []common.WorkspaceInvitation
+	err := s.db.Where("workspace_id = ?", workspaceID).Order("created_at DESC").Find(&invitations).Error
+	return invitations, err
+}
+
+func (s *Service) RevokeInvitation(userID, workspaceID, invitationID uint) error {
+	if _, _, err := s.requireRole(workspaceID, userID, auth.RoleOwner); err != nil {
+		return err
+	}
+
+	result := s.db.Model(&common.WorkspaceInvitation{}).
+		Where("id = ? AND workspace_id = ? AND status = ?", invitationID, workspaceID, common.InvitationPending).
+		Updates(map[string]interface{}{"status": common.InvitationRevoked, "responded_at": time.Now()})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvitationNotFound
+	}
+	return nil
+}
+
+// PendingInvitations returns the unexpired invitations sent to the user's
+// email address.
+func (s *Service) PendingInvitations(userID uint) ([]common.WorkspaceInvitation, error) {
+	var user common.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	var invitations []common.WorkspaceInvitation
+	err := s.db.Preload("Workspace").
+		Where("email = ? AND status = ? AND expires_at > ?", strings.ToLower(user.Email), common.InvitationPending, time.Now()).
+		Order("created_at DESC").
+		Find(&invitations).Error
+	return invitations, err
+}
+
+// AcceptInvitation makes the user a member with the invited role. The user's
+// verified email must be the one invited.
+func (s *Service) AcceptInvitation(userID, invitationID uint) (*common.WorkspaceMember, error) {
+	var member common.WorkspaceMember
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		invitation, err := s.respond(tx, userID, invitationID, common.InvitationAccepted)
+		if err != nil {
+			return err
+		}
+
+		if _, err := memberRole(tx, invitation.WorkspaceID, userID); err == nil {
+			return ErrAlreadyMember
+		} else if !errors.Is(err, auth.ErrNotWorkspaceMember) {
+			return err
+		}
+
+		member = common.WorkspaceMember{WorkspaceID: invitation.WorkspaceID, UserID: userID, Role: invitation.Role}
+		return tx.Create(&member).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+func (s *Service) DeclineInvitation(userID, invitationID uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		_, err := s.respond(tx, userID, invitationID, common.InvitationDeclined)
+		return err
+	})
+}
+
+// respond moves a pending invitation addressed to userID to status.
+func (s *Service) respond(tx *gorm.DB, userID, invitationID uint, status string) (*common.WorkspaceInvitation, error) {
+	var user common.User
+	if err := tx.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	var invitation common.WorkspaceInvitation
+	err := tx.Where("id = ? AND email = ?", invitationID, strings.ToLower(user.Email)).First(&invitation).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvitationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !user.EmailVerified {
+		return nil, ErrEmailNotVerified
+	}
+	if invitation.Status != common.InvitationPending || !invitation.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvitationClosed
+	}
+
+	result := tx.Model(&common.WorkspaceInvitation{}).
+		Where("id = ? AND status = ?", invitation.ID, common.InvitationPending).
+		Updates(map[string]interface{}{"status": status, "responded_at": time.Now()})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrInvitationClosed
+	}
+	invitation.Status = status
+	return &invitation, nil
+}
+
+func (s *Service) sendMail(to, subject, body string) error {
+	if s.mailer == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return s.mailer.Send(ctx, mail.Message{To: to, Subject: subject, Body: body})
+}
+
+// link points at a page of the web frontend, when an app URL is configured.
+func (s *Service) link(path string) string {
+	if s.appURL == "" {
+		return ""
+	}
+	return fmt.Sprintf("\n\n%s%s", strings.TrimRight(s.appURL, "/"), path)
+}
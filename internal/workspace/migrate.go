@@ -0,0 +1,45 @@
+package workspace
+
+import (
+	"fintrack/internal/common"
+	"gorm.io/gorm"
+)
+
+// workspaceScoped are the tables that gained a workspace_id column when
+// workspaces were introduced; rows from before then belong to their user.
+// A table is skipped until the service owning it has added the column.
+var workspaceScoped = []string{"expenses", "recurring_expenses", "import_batches", "reports", "report_jobs", "budgets"}
+
+// Migrate gives every user a personal workspace and moves rows recorded
+// before workspaces existed into it. It must run after AutoMigrate has
+// created the workspace tables and columns and is a no-op once done.
+func Migrate(db *gorm.DB) error {
+	var userIDs []uint
+	err := db.Model(&common.User{}).
+		Where("id NOT IN (?)", db.Model(&common.Workspace{}).Select("personal_owner_id").Where("personal_owner_id IS NOT NULL")).
+		Pluck("id", &userIDs).Error
+	if err != nil {
+		return err
+	}
+	for _, userID := range userIDs {
+		if _, err := PersonalWorkspace(db, userID); err != nil {
+			return err
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range workspaceScoped {
+			if !tx.Migrator().HasTable(table) || !tx.Migrator().HasColumn(table, "workspace_id") {
+				continue
+			}
+			err := tx.Exec(
+				"UPDATE " + table + " SET workspace_id = (SELECT id FROM workspaces WHERE workspaces.personal_owner_id = " + table + ".user_id) " +
+					"WHERE workspace_id = 0 AND EXISTS (SELECT 1 FROM workspaces WHERE workspaces.personal_owner_id = " + table + ".user_id)",
+			).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
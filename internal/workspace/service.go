@@ -0,0 +1,426 @@
+package workspace
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"fintrack/internal/common"
+	"fintrack/pkg/auth"
+	"fintrack/pkg/mail"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	PersonalWorkspaceName = "Personal"
+	InvitationTTL         = 7 * 24 * time.Hour
+)
+
+var (
+	ErrWorkspaceNotFound  = errors.New("workspace not found")
+	ErrMemberNotFound     = errors.New("member not found")
+	ErrInvitationNotFound = errors.New("invitation not found")
+	ErrPersonalWorkspace  = errors.New("personal workspaces cannot be shared or deleted")
+	ErrAlreadyMember      = errors.New("user is already a member of this workspace")
+	ErrOwnerRole          = errors.New("the workspace owner cannot be removed or change role")
+	ErrInvitationClosed   = errors.New("invitation is no longer pending")
+	ErrEmailNotVerified   = errors.New("verify your email address before answering invitations")
+)
+
+// Resolver checks workspace membership for the workspace middleware in any
+// service that shares the database.
+type Resolver struct {
+	db *gorm.DB
+}
+
+func NewResolver(db *gorm.DB) *Resolver {
+	return &Resolver{db: db}
+}
+
+func (r *Resolver) ResolveWorkspace(ctx context.Context, userID, workspaceID uint) (uint, string, error) {
+	db := r.db.WithContext(ctx)
+	if workspaceID == 0 {
+		personal, err := PersonalWorkspace(db, userID)
+		if err != nil {
+			return 0, "", err
+		}
+		workspaceID = personal.ID
+	}
+
+	role, err := memberRole(db, workspaceID, userID)
+	if err != nil {
+		return 0, "", err
+	}
+	return workspaceID, role, nil
+}
+
+// PersonalWorkspace returns userID's personal workspace, creating it on first
+// use in the user's base currency.
+func PersonalWorkspace(db *gorm.DB, userID uint) (*common.Workspace, error) {
+	var workspace common.Workspace
+	err := db.Where("personal_owner_id = ?", userID).First(&workspace).Error
+	if err == nil {
+		return &workspace, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	var user common.User
+	if err := db.Select("id", "base_currency").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	workspace = common.Workspace{
+		Name:            PersonalWorkspaceName,
+		OwnerID:         user.ID,
+		PersonalOwnerID: &user.ID,
+		BaseCurrency:    user.BaseCurrency,
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&workspace).Error; err != nil {
+			return err
+		}
+		// Another request created it first.
+		if workspace.ID == 0 {
+			return nil
+		}
+		return tx.Create(&common.WorkspaceMember{WorkspaceID: workspace.ID, UserID: user.ID, Role: auth.RoleOwner}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if workspace.ID == 0 {
+		return PersonalWorkspace(db, userID)
+	}
+	return &workspace, nil
+}
+
+// SetBaseCurrency changes the currency a workspace reports in and marks its
+// reports stale so they are rebuilt in it.
+func SetBaseCurrency(tx *gorm.DB, workspaceID uint, currency string) error {
+	if err := tx.Model(&common.Workspace{}).Where("id = ?", workspaceID).Update("base_currency", currency).Error; err != nil {
+		return err
+	}
+	if !tx.Migrator().HasTable(&common.Report{}) {
+		return nil
+	}
+	return tx.Model(&common.Report{}).Where("workspace_id = ?", workspaceID).Update("stale", true).Error
+}
+
+func memberRole(db *gorm.DB, workspaceID, userID uint) (string, error) {
+	var member common.WorkspaceMember
+	err := db.Where("workspace_id = ? AND user_id = ?", workspaceID, userID).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", auth.ErrNotWorkspaceMember
+	}
+	if err != nil {
+		return "", err
+	}
+	return member.Role, nil
+}
+
+type Service struct {
+	db     *gorm.DB
+	mailer mail.Mailer
+	appURL string
+}
+
+// NewService builds the workspace management service. A nil mailer sends no
+// invitation emails; appURL is the web frontend base used in their links.
+func NewService(db *gorm.DB, mailer mail.Mailer, appURL string) *Service {
+	return &Service{
+		db:     db,
+		mailer: mailer,
+		appURL: appURL,
+	}
+}
+
+// requireRole loads the workspace for a member holding at least minimum.
+// Non-members get ErrWorkspaceNotFound so workspace IDs cannot be probed.
+func (s *Service) requireRole(workspaceID, userID uint, minimum string) (*common.Workspace, string, error) {
+	role, err := memberRole(s.db, workspaceID, userID)
+	if errors.Is(err, auth.ErrNotWorkspaceMember) {
+		return nil, "", ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	if !auth.RoleAtLeast(role, minimum) {
+		return nil, "", auth.ErrInsufficientRole
+	}
+
+	var workspace common.Workspace
+	err = s.db.First(&workspace, workspaceID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", ErrWorkspaceNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return &workspace, role, nil
+}
+
+func (s *Service) CreateWorkspace(userID uint, req common.WorkspaceRequest) (*common.Workspace, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, errors.New("name cannot be empty")
+	}
+
+	baseCurrency := strings.ToUpper(strings.TrimSpace(req.BaseCurrency))
+	if baseCurrency == "" {
+		personal, err := PersonalWorkspace(s.db, userID)
+		if err != nil {
+			return nil, err
+		}
+		baseCurrency = personal.BaseCurrency
+	}
+	if !common.IsCurrencyCode(baseCurrency) {
+		return nil, errors.New("base currency must be a three-letter ISO 4217 code")
+	}
+
+	workspace := common.Workspace{Name: name, OwnerID: userID, BaseCurrency: baseCurrency}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&workspace).Error; err != nil {
+			return err
+		}
+		return tx.Create(&common.WorkspaceMember{WorkspaceID: workspace.ID, UserID: userID, Role: auth.RoleOwner}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &workspace, nil
+}
+
+// ListWorkspaces returns the user's memberships with their workspaces, the
+// personal workspace first.
+func (s *Service) ListWorkspaces(userID uint) ([]common.WorkspaceMember, error) {
+	if _, err := PersonalWorkspace(s.db, userID); err != nil {
+		return nil, err
+	}
+
+	var members []common.WorkspaceMember
+	err := s.db.Preload("Workspace").
+		Joins("JOIN workspaces ON workspaces.id = workspace_members.workspace_id AND workspaces.deleted_at IS NULL").
+		Where("workspace_members.user_id = ?", userID).
+		Order("workspaces.personal_owner_id IS NULL, workspaces.created_at").
+		Find(&members).Error
+	return members, err
+}
+
+func (s *Service) GetWorkspace(userID, workspaceID uint) (*common.Workspace, string, error) {
+	return s.requireRole(workspaceID, userID, auth.RoleViewer)
+}
+
+// UpdateWorkspace renames the workspace or changes its base currency. Only
+// the owner may.
+func (s *Service) UpdateWorkspace(userID, workspaceID uint, req common.UpdateWorkspaceRequest) (*common.Workspace, error) {
+	workspace, _, err := s.requireRole(workspaceID, userID, auth.RoleOwner)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if req.Name != nil {
+			name := strings.TrimSpace(*req.Name)
+			if name == "" {
+				return errors.New("name cannot be empty")
+			}
+			if err := tx.Model(workspace).Update("name", name).Error; err != nil {
+				return err
+			}
+		}
+		if req.BaseCurrency != nil {
+			baseCurrency := strings.ToUpper(strings.TrimSpace(*req.BaseCurrency))
+			if !common.IsCurrencyCode(baseCurrency) {
+				return errors.New("base currency must be a three-letter ISO 4217 code")
+			}
+			if baseCurrency != workspace.BaseCurrency {
+				return SetBaseCurrency(tx, workspace.ID, baseCurrency)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	workspace, _, err = s.requireRole(workspaceID, userID, auth.RoleOwner)
+	return workspace, err
+}
+
+// DeleteWorkspace soft-deletes a shared workspace with its expenses and
+// removes everything derived from them. Personal workspaces are kept.
+func (s *Service) DeleteWorkspace(userID, workspaceID uint) error {
+	workspace, _, err := s.requireRole(workspaceID, userID, auth.RoleOwner)
+	if err != nil {
+		return err
+	}
+	if workspace.Personal() {
+		return ErrPersonalWorkspace
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return deleteWorkspace(tx, workspace.ID)
+	})
+}
+
+func (s *Service) ListMembers(userID, workspaceID uint) ([]common.WorkspaceMember, error) {
+	if _, _, err := s.requireRole(workspaceID, userID, auth.RoleViewer); err != nil {
+		return nil, err
+	}
+
+	var members []common.WorkspaceMember
+	err := s.db.Preload("User").Where("workspace_id = ?", workspaceID).Order("created_at").Find(&members).Error
+	return members, err
+}
+
+// UpdateMemberRole makes a member an editor or viewer. Only the owner may,
+// and the owner's own role is fixed.
+func (s *Service) UpdateMemberRole(userID, workspaceID, memberID uint, role string) (*common.WorkspaceMember, error) {
+	if role != auth.RoleEditor && role != auth.RoleViewer {
+		return nil, fmt.Errorf("role must be %s or %s", auth.RoleEditor, auth.RoleViewer)
+	}
+	if _, _, err := s.requireRole(workspaceID, userID, auth.RoleOwner); err != nil {
+		return nil, err
+	}
+
+	var member common.WorkspaceMember
+	err := s.db.Where("workspace_id = ? AND user_id = ?", workspaceID, memberID).First(&member).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrMemberNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if member.Role == auth.RoleOwner {
+		return nil, ErrOwnerRole
+	}
+
+	if err := s.db.Model(&member).Update("role", role).Error; err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// RemoveMember takes memberID out of the workspace. The owner may remove
+// anyone else; other members may only remove themselves.
+func (s *Service) RemoveMember(userID, workspaceID, memberID uint) error {
+	minimum := auth.RoleOwner
+	if memberID == userID {
+		minimum = auth.RoleViewer
+	}
+	if _, _, err := s.requireRole(workspaceID, userID, minimum); err != nil {
+		return err
+	}
+
+	role, err := memberRole(s.db, workspaceID, memberID)
+	if errors.Is(err, auth.ErrNotWorkspaceMember) {
+		return ErrMemberNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if role == auth.RoleOwner {
+		return ErrOwnerRole
+	}
+
+	return s.db.Where("workspace_id = ? AND user_id = ?", workspaceID, memberID).Delete(&common.WorkspaceMember{}).Error
+}
+
+// deleteWorkspace removes a workspace and its data within tx. The user
+// service may run before the other services have created their tables.
+// Attachments are left to the expense service's sweeper, which also deletes
+// their blobs.
+func deleteWorkspace(tx *gorm.DB, workspaceID uint) error {
+	for _, join := range []string{"expense_tags", "category_rule_tags"} {
+		if !tx.Migrator().HasTable(join) {
+			continue
+		}
+		if err := tx.Exec("DELETE FROM "+join+" WHERE tag_id IN (SELECT id FROM tags WHERE workspace_id = ?)", workspaceID).Error; err != nil {
+			return err
+		}
+	}
+	for _, model := range []interface{}{
+		&common.Expense{},
+		&common.RecurringExpense{},
+		&common.Report{},
+		&common.ReportJob{},
+		&common.ImportBatch{},
+		&common.ExpenseVersion{},
+		&common.ExpenseSplit{},
+		&common.Settlement{},
+		&common.Budget{},
+		&common.CategoryRule{},
+		&common.Category{},
+		&common.Tag{},
+		&common.WorkspaceInvitation{},
+		&common.WorkspaceMember{},
+	} {
+		if !tx.Migrator().HasTable(model) {
+			continue
+		}
+		if err := tx.Where("workspace_id = ?", workspaceID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Delete(&common.Workspace{}, workspaceID).Error
+}
+
+// RemoveUser deletes userID's personal workspace and their memberships in
+// others. A shared workspace they own passes to its longest-standing editor,
+// or viewer when it has no editors, so the other members keep their data;
+// only shared workspaces with no one else in them are deleted.
+func RemoveUser(tx *gorm.DB, userID uint) error {
+	if !tx.Migrator().HasTable(&common.Workspace{}) {
+		return nil
+	}
+
+	var owned []common.Workspace
+	if err := tx.Where("owner_id = ?", userID).Find(&owned).Error; err != nil {
+		return err
+	}
+	for _, workspace := range owned {
+		successor, err := successor(tx, workspace, userID)
+		if err != nil {
+			return err
+		}
+		if successor == nil {
+			if err := deleteWorkspace(tx, workspace.ID); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := tx.Model(successor).Update("role", auth.RoleOwner).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&workspace).Update("owner_id", successor.UserID).Error; err != nil {
+			return err
+		}
+	}
+
+	return tx.Where("user_id = ?", userID).Delete(&common.WorkspaceMember{}).Error
+}
+
+// successor picks who takes over workspace when its owner leaves, or nil for
+// a personal workspace or one without other members.
+func successor(tx *gorm.DB, workspace common.Workspace, ownerID uint) (*common.WorkspaceMember, error) {
+	if workspace.Personal() {
+		return nil, nil
+	}
+	var members []common.WorkspaceMember
+	err := tx.Where("workspace_id = ? AND user_id <> ?", workspace.ID, ownerID).Order("created_at, user_id").Find(&members).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, role := range []string{auth.RoleEditor, auth.RoleViewer} {
+		for i := range members {
+			if members[i].Role == role {
+				return &members[i], nil
+			}
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,241 @@
+package workspace
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"fintrack/internal/common"
+	"fintrack/pkg/auth"
+	"fintrack/pkg/middleware"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB() *gorm.DB {
+	db, _ := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	db.AutoMigrate(&common.User{}, &common.Workspace{}, &common.WorkspaceMember{}, &common.WorkspaceInvitation{}, &common.Expense{}, &common.Report{}, &common.Budget{})
+	return db
+}
+
+func createUser(db *gorm.DB, email string, verified bool) common.User {
+	user := common.User{Email: email, Password: "x", Name: email, BaseCurrency: "EUR", EmailVerified: verified}
+	db.Create(&user)
+	return user
+}
+
+func TestPersonalWorkspace(t *testing.T) {
+	db := setupTestDB()
+	user := createUser(db, "a@example.com", true)
+
+	first, err := PersonalWorkspace(db, user.ID)
+	if err != nil {
+		t.Fatalf("Expected personal workspace, got error: %v", err)
+	}
+	if !first.Personal() || first.BaseCurrency != "EUR" || first.OwnerID != user.ID {
+		t.Errorf("Expected a personal EUR workspace owned by the user, got %+v", first)
+	}
+
+	again, _ := PersonalWorkspace(db, user.ID)
+	if again.ID != first.ID {
+		t.Errorf("Expected the same workspace, got %d and %d", first.ID, again.ID)
+	}
+
+	workspaceID, role, err := NewResolver(db).ResolveWorkspace(context.Background(), user.ID, 0)
+	if err != nil || workspaceID != first.ID || role != auth.RoleOwner {
+		t.Errorf("Expected owner of %d by default, got %d/%s/%v", first.ID, workspaceID, role, err)
+	}
+}
+
+func TestWorkspaceService_Invitations(t *testing.T) {
+	db := setupTestDB()
+	service := NewService(db, nil, "")
+	owner := createUser(db, "owner@example.com", true)
+	invitee := createUser(db, "invitee@example.com", false)
+
+	personal, _ := PersonalWorkspace(db, owner.ID)
+	if _, err := service.Invite(owner.ID, personal.ID, common.InvitationRequest{Email: invitee.Email, Role: auth.RoleEditor}); err != ErrPersonalWorkspace {
+		t.Errorf("Expected ErrPersonalWorkspace, got %v", err)
+	}
+
+	household, err := service.CreateWorkspace(owner.ID, common.WorkspaceRequest{Name: "Household"})
+	if err != nil {
+		t.Fatalf("Expected workspace, got error: %v", err)
+	}
+	if household.BaseCurrency != "EUR" {
+		t.Errorf("Expected the owner's currency, got %s", household.BaseCurrency)
+	}
+
+	invitation, err := service.Invite(owner.ID, household.ID, common.InvitationRequest{Email: "Invitee@Example.com", Role: auth.RoleViewer})
+	if err != nil {
+		t.Fatalf("Expected invitation, got error: %v", err)
+	}
+	if _, err := service.Invite(invitee.ID, household.ID, common.InvitationRequest{Email: "x@example.com", Role: auth.RoleViewer}); err != ErrWorkspaceNotFound {
+		t.Errorf("Expected ErrWorkspaceNotFound for a non-member, got %v", err)
+	}
+
+	pending, _ := service.PendingInvitations(invitee.ID)
+	if len(pending) != 1 || pending[0].Workspace == nil || pending[0].Workspace.Name != "Household" {
+		t.Fatalf("Expected 1 pending invitation to Household, got %+v", pending)
+	}
+
+	if _, err := service.AcceptInvitation(invitee.ID, invitation.ID); err != ErrEmailNotVerified {
+		t.Errorf("Expected ErrEmailNotVerified, got %v", err)
+	}
+	if _, err := service.AcceptInvitation(owner.ID, invitation.ID); err != ErrInvitationNotFound {
+		t.Errorf("Expected ErrInvitationNotFound for another user, got %v", err)
+	}
+
+	db.Model(&invitee).Update("email_verified", true)
+	member, err := service.AcceptInvitation(invitee.ID, invitation.ID)
+	if err != nil || member.Role != auth.RoleViewer {
+		t.Fatalf("Expected viewer membership, got %v", err)
+	}
+	if _, err := service.AcceptInvitation(invitee.ID, invitation.ID); err != ErrInvitationClosed {
+		t.Errorf("Expected ErrInvitationClosed, got %v", err)
+	}
+	if _, err := service.Invite(owner.ID, household.ID, common.InvitationRequest{Email: invitee.Email, Role: auth.RoleEditor}); err != ErrAlreadyMember {
+		t.Errorf("Expected ErrAlreadyMember, got %v", err)
+	}
+
+	if _, err := service.UpdateMemberRole(invitee.ID, household.ID, invitee.ID, auth.RoleEditor); err != auth.ErrInsufficientRole {
+		t.Errorf("Expected ErrInsufficientRole, got %v", err)
+	}
+	if _, err := service.UpdateMemberRole(owner.ID, household.ID, owner.ID, auth.RoleViewer); err != ErrOwnerRole {
+		t.Errorf("Expected ErrOwnerRole, got %v", err)
+	}
+	if _, err := service.UpdateMemberRole(owner.ID, household.ID, invitee.ID, auth.RoleEditor); err != nil {
+		t.Errorf("Expected role change, got error: %v", err)
+	}
+
+	second, _ := service.Invite(owner.ID, household.ID, common.InvitationRequest{Email: "later@example.com", Role: auth.RoleViewer})
+	declined := createUser(db, "later@example.com", true)
+	if err := service.DeclineInvitation(declined.ID, second.ID); err != nil {
+		t.Errorf("Expected decline, got error: %v", err)
+	}
+	if _, _, err := service.GetWorkspace(declined.ID, household.ID); err != ErrWorkspaceNotFound {
+		t.Errorf("Expected no access after declining, got %v", err)
+	}
+
+	members, _ := service.ListMembers(invitee.ID, household.ID)
+	if len(members) != 2 {
+		t.Errorf("Expected 2 members, got %d", len(members))
+	}
+	if err := service.RemoveMember(invitee.ID, household.ID, invitee.ID); err != nil {
+		t.Errorf("Expected a member to be able to leave, got %v", err)
+	}
+	if err := service.RemoveMember(owner.ID, household.ID, owner.ID); err != ErrOwnerRole {
+		t.Errorf("Expected ErrOwnerRole, got %v", err)
+	}
+}
+
+func TestWorkspaceMiddleware_Roles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupTestDB()
+	service := NewService(db, nil, "")
+	owner := createUser(db, "owner@example.com", true)
+	viewer := createUser(db, "viewer@example.com", true)
+	stranger := createUser(db, "stranger@example.com", true)
+
+	household, _ := service.CreateWorkspace(owner.ID, common.WorkspaceRequest{Name: "Household"})
+	invitation, _ := service.Invite(owner.ID, household.ID, common.InvitationRequest{Email: viewer.Email, Role: auth.RoleViewer})
+	service.AcceptInvitation(viewer.ID, invitation.ID)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		id, _ := strconv.ParseUint(c.GetHeader("X-User"), 10, 32)
+		c.Set("user_id", uint(id))
+	}, middleware.WorkspaceMiddleware(NewResolver(db)), middleware.RequireWorkspaceWrite())
+	handler := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"workspace_id": c.GetUint("workspace_id")})
+	}
+	router.GET("/expenses", handler)
+	router.POST("/expenses", handler)
+
+	cases := []struct {
+		method string
+		user   uint
+		status int
+	}{
+		{http.MethodGet, viewer.ID, http.StatusOK},
+		{http.MethodPost, viewer.ID, http.StatusForbidden},
+		{http.MethodPost, owner.ID, http.StatusOK},
+		{http.MethodGet, stranger.ID, http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, "/expenses", nil)
+		req.Header.Set("X-User", strconv.Itoa(int(tc.user)))
+		req.Header.Set(middleware.WorkspaceHeader, strconv.Itoa(int(household.ID)))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != tc.status {
+			t.Errorf("Expected %d for %s by user %d, got %d", tc.status, tc.method, tc.user, w.Code)
+		}
+	}
+}
+
+func TestMigrateAndRemoveUser(t *testing.T) {
+	db := setupTestDB()
+	owner := createUser(db, "owner@example.com", true)
+	member := createUser(db, "member@example.com", true)
+	db.Create(&common.Expense{UserID: owner.ID, Amount: common.MustParseMoney("5.00", "EUR"), Category: "Food", Date: time.Now()})
+	db.Create(&common.Budget{UserID: owner.ID, Category: "Food", Period: "monthly", Limit: common.MustParseMoney("50.00", "EUR")})
+
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Expected migration to succeed, got error: %v", err)
+	}
+	if err := Migrate(db); err != nil {
+		t.Fatalf("Expected migration to be repeatable, got error: %v", err)
+	}
+
+	personal, _ := PersonalWorkspace(db, owner.ID)
+	var expense common.Expense
+	db.Where("user_id = ?", owner.ID).First(&expense)
+	if expense.WorkspaceID != personal.ID {
+		t.Errorf("Expected the expense in workspace %d, got %d", personal.ID, expense.WorkspaceID)
+	}
+	var budget common.Budget
+	db.Where("user_id = ?", owner.ID).First(&budget)
+	if budget.WorkspaceID != personal.ID {
+		t.Errorf("Expected the budget in workspace %d, got %d", personal.ID, budget.WorkspaceID)
+	}
+
+	service := NewService(db, nil, "")
+	household, _ := service.CreateWorkspace(owner.ID, common.WorkspaceRequest{Name: "Household"})
+	db.Create(&common.WorkspaceMember{WorkspaceID: household.ID, UserID: member.ID, Role: auth.RoleEditor})
+	empty, _ := service.CreateWorkspace(owner.ID, common.WorkspaceRequest{Name: "Side project"})
+	memberPersonal, _ := PersonalWorkspace(db, member.ID)
+	db.Create(&common.Expense{WorkspaceID: household.ID, UserID: member.ID, Amount: common.MustParseMoney("7.00", "EUR"), Category: "Food", Date: time.Now()})
+
+	if err := RemoveUser(db, owner.ID); err != nil {
+		t.Fatalf("Expected RemoveUser to succeed, got error: %v", err)
+	}
+
+	var count int64
+	db.Model(&common.Workspace{}).Where("id IN ?", []uint{personal.ID, empty.ID}).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected the personal and memberless workspaces to be deleted, got %d", count)
+	}
+	db.Model(&common.Expense{}).Where("user_id = ?", owner.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected the personal expenses to be deleted, got %d", count)
+	}
+	db.Model(&common.Expense{}).Where("workspace_id = ?", household.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected the shared workspace's expenses to remain, got %d", count)
+	}
+	workspaceID, role, err := NewResolver(db).ResolveWorkspace(context.Background(), member.ID, household.ID)
+	if err != nil || workspaceID != household.ID || role != auth.RoleOwner {
+		t.Errorf("Expected the member to own the shared workspace, got %d %q, %v", workspaceID, role, err)
+	}
+	db.Model(&common.Workspace{}).Where("id = ? AND owner_id = ?", household.ID, member.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected the shared workspace's owner to change, got %d", count)
+	}
+	if _, _, err := NewResolver(db).ResolveWorkspace(context.Background(), member.ID, memberPersonal.ID); err != nil {
+		t.Errorf("Expected the member's own workspace to remain, got %v", err)
+	}
+}
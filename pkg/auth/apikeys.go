@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// APIKeyPrefix starts every API key so the middleware can tell keys from
+// JWTs and leaked keys are easy to scan for.
+const APIKeyPrefix = "ftk_"
+
+// Scopes an API key can be granted. Sessions from a login are not scoped.
+const (
+	ScopeExpensesRead  = "expenses:read"
+	ScopeExpensesWrite = "expenses:write"
+	ScopeBudgetsRead   = "budgets:read"
+	ScopeBudgetsWrite  = "budgets:write"
+	ScopeReportsRead   = "reports:read"
+	ScopeReportsWrite  = "reports:write"
+)
+
+var AllScopes = []string{
+	ScopeExpensesRead,
+	ScopeExpensesWrite,
+	ScopeBudgetsRead,
+	ScopeBudgetsWrite,
+	ScopeReportsRead,
+	ScopeReportsWrite,
+}
+
+var ErrInvalidAPIKey = errors.New("invalid API key")
+
+// APIKeyPrincipal is who an API key acts for and what it may do.
+type APIKeyPrincipal struct {
+	KeyID  uint
+	UserID uint
+	Scopes []string
+}
+
+// APIKeyVerifier resolves a presented API key, returning ErrInvalidAPIKey for
+// unknown, revoked or expired keys.
+type APIKeyVerifier interface {
+	VerifyAPIKey(ctx context.Context, key string) (*APIKeyPrincipal, error)
+}
+
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
+
+func ValidScope(scope string) bool {
+	for _, s := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether scopes grants scope. A write scope implies read
+// access to the same resource.
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+		if strings.HasSuffix(scope, ":read") && s == strings.TrimSuffix(scope, ":read")+":write" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+	"github.com/redis/go-redis/v9"
+)
+
+const attemptKeyPrefix = "failed_attempts:"
+
+// AttemptCounter counts failures per key over a fixed window that starts at
+// the first failure. It is shared through Redis; without a client it falls
+// back to process memory, which only suits tests and single-instance
+// development. When a Redis call fails it falls back to process memory as
+// well, so an outage weakens the limits to per-instance ones instead of
+// turning every login into an error or lifting them altogether.
+type AttemptCounter struct {
+	client *redis.Client
+	window time.Duration
+
+	mu       sync.Mutex
+	counters map[string]*attempts
+}
+
+type attempts struct {
+	count   int64
+	resetAt time.Time
+}
+
+func NewAttemptCounter(client *redis.Client, window time.Duration) *AttemptCounter {
+	return &AttemptCounter{
+		client:   client,
+		window:   window,
+		counters: make(map[string]*attempts),
+	}
+}
+
+// Fail records a failure for key and returns the failures in the current
+// window and how long until the window ends.
+func (a *AttemptCounter) Fail(ctx context.Context, key string) (int64, time.Duration, error) {
+	if a.client != nil {
+		pipe := a.client.TxPipeline()
+		incr := pipe.Incr(ctx, attemptKeyPrefix+key)
+		pipe.ExpireNX(ctx, attemptKeyPrefix+key, a.window)
+		ttl := pipe.PTTL(ctx, attemptKeyPrefix+key)
+		if _, err := pipe.Exec(ctx); err == nil {
+			return incr.Val(), ttl.Val(), nil
+		}
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	a.prune(now)
+	counter, ok := a.counters[key]
+	if !ok {
+		counter = &attempts{resetAt: now.Add(a.window)}
+		a.counters[key] = counter
+	}
+	counter.count++
+	return counter.count, counter.resetAt.Sub(now), nil
+}
+
+// Count returns the failures for key in the current window and how long
+// until the window ends. Failures recorded in memory while Redis was failing
+// still count once it is back.
+func (a *AttemptCounter) Count(ctx context.Context, key string) (int64, time.Duration, error) {
+	count, ttl := a.local(key)
+	if a.client == nil {
+		return count, ttl, nil
+	}
+
+	pipe := a.client.Pipeline()
+	get := pipe.Get(ctx, attemptKeyPrefix+key)
+	pttl := pipe.PTTL(ctx, attemptKeyPrefix+key)
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return count, ttl, nil
+	}
+	shared, err := get.Int64()
+	if err != nil || shared <= count {
+		return count, ttl, nil
+	}
+	return shared, pttl.Val(), nil
+}
+
+func (a *AttemptCounter) Reset(ctx context.Context, key string) error {
+	a.mu.Lock()
+	delete(a.counters, key)
+	a.mu.Unlock()
+
+	if a.client != nil {
+		// A counter a failed delete leaves behind runs out with its window;
+		// that is not worth failing the login over.
+		a.client.Del(ctx, attemptKeyPrefix+key)
+	}
+	return nil
+}
+
+func (a *AttemptCounter) local(key string) (int64, time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := time.Now()
+	counter, ok := a.counters[key]
+	if !ok || !counter.resetAt.After(now) {
+		return 0, 0
+	}
+	return counter.count, counter.resetAt.Sub(now)
+}
+
+func (a *AttemptCounter) prune(now time.Time) {
+	for key, counter := range a.counters {
+		if !counter.resetAt.After(now) {
+			delete(a.counters, key)
+		}
+	}
+}
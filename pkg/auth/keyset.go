@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// JWKSRefetchInterval limits how often an unknown kid can force a fetch,
+	// so tokens with made-up kids cannot be used to hammer the user service.
+	JWKSRefetchInterval = 10 * time.Second
+	maxJWKSSize         = 1 << 20
+)
+
+// KeySet resolves the key a token was signed with from its kid.
+type KeySet interface {
+	PublicKey(ctx context.Context, kid string) (PublicKey, error)
+}
+
+// StaticKeySet is a fixed set of keys, typically read from a file.
+type StaticKeySet struct {
+	keys map[string]PublicKey
+}
+
+func NewStaticKeySet(keys map[string]PublicKey) *StaticKeySet {
+	return &StaticKeySet{keys: keys}
+}
+
+func NewFileKeySet(path string) (*StaticKeySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return NewStaticKeySet(keys), nil
+}
+
+func (s *StaticKeySet) PublicKey(ctx context.Context, kid string) (PublicKey, error) {
+	key, ok := s.keys[kid]
+	if !ok {
+		return PublicKey{}, ErrUnknownKey
+	}
+	return key, nil
+}
+
+// RemoteKeySet fetches a JWKS document over HTTP and caches it for ttl. An
+// unknown kid triggers an early refresh so freshly rotated keys are picked up
+// without waiting for the cache to expire. If a refresh fails the previously
+// fetched keys stay in use.
+type RemoteKeySet struct {
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+func NewRemoteKeySet(url string, ttl time.Duration) *RemoteKeySet {
+	return &RemoteKeySet{
+		url:    url,
+		ttl:    ttl,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func (r *RemoteKeySet) PublicKey(ctx context.Context, kid string) (PublicKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	key, ok := r.keys[kid]
+	expired := now.Sub(r.fetchedAt) > r.ttl
+	if (expired || !ok) && now.Sub(r.attemptedAt) >= JWKSRefetchInterval {
+		r.attemptedAt = now
+		keys, err := r.fetch(ctx)
+		if err != nil && r.keys == nil {
+			return PublicKey{}, err
+		}
+		if err == nil {
+			r.keys = keys
+			r.fetchedAt = now
+		}
+		key, ok = r.keys[kid]
+	}
+
+	if !ok {
+		return PublicKey{}, ErrUnknownKey
+	}
+	return key, nil
+}
+
+func (r *RemoteKeySet) fetch(ctx context.Context) (map[string]PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetch JWKS: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch JWKS: unexpected status %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+	if err != nil {
+		return nil, fmt.Errorf("fetch JWKS: %w", err)
+	}
+	return ParseJWKS(data)
+}
+
+// LoadKeySet reads the keys from file when one is configured and otherwise
+// fetches them from url.
+func LoadKeySet(url, file string, ttl time.Duration) (KeySet, error) {
+	if file != "" {
+		return NewFileKeySet(file)
+	}
+	return NewRemoteKeySet(url, ttl), nil
+}
+
+// Keyfunc resolves a token's verification key from keys by its kid, and only
+// accepts the algorithm that key was published for.
+func Keyfunc(ctx context.Context, keys KeySet) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		if kid == "" {
+			return nil, ErrUnknownKey
+		}
+		key, err := keys.PublicKey(ctx, kid)
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != key.Alg {
+			return nil, jwt.ErrTokenSignatureInvalid
+		}
+		return key.Key, nil
+	}
+}
+
+// ValidMethods restricts parsing to the algorithms keys can be published for.
+var ValidMethods = jwt.WithValidMethods([]string{AlgRS256, AlgEdDSA})
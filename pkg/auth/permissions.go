@@ -0,0 +1,58 @@
+package auth
+
+import "sort"
+
+// Account roles are granted system-wide by an administrator, unlike
+// workspace roles. Ordinary users hold none.
+const (
+	UserRoleAdmin   = "admin"
+	UserRoleSupport = "support"
+)
+
+// Permissions guard administrative routes; roles grant them.
+const (
+	PermUsersRead  = "users:read"
+	PermUsersWrite = "users:write"
+	PermStatsRead  = "stats:read"
+)
+
+var AllUserRoles = []string{UserRoleAdmin, UserRoleSupport}
+
+var rolePermissions = map[string][]string{
+	UserRoleAdmin:   {PermUsersRead, PermUsersWrite, PermStatsRead},
+	UserRoleSupport: {PermUsersRead, PermStatsRead},
+}
+
+func ValidUserRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// HasPermission reports whether any of roles grants permission. Unknown
+// roles grant nothing.
+func HasPermission(roles []string, permission string) bool {
+	for _, role := range roles {
+		for _, p := range rolePermissions[role] {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PermissionsFor lists the distinct permissions roles grant, sorted.
+func PermissionsFor(roles []string) []string {
+	seen := make(map[string]bool)
+	permissions := []string{}
+	for _, role := range roles {
+		for _, p := range rolePermissions[role] {
+			if !seen[p] {
+				seen[p] = true
+				permissions = append(permissions, p)
+			}
+		}
+	}
+	sort.Strings(permissions)
+	return permissions
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+	"github.com/redis/go-redis/v9"
+)
+
+const revokedKeyPrefix = "revoked_jti:"
+
+// RevocationList records access tokens, by jti, that must be rejected before
+// they expire. It is shared through Redis; without a client it falls back to
+// process memory, which only suits tests and single-instance development.
+type RevocationList struct {
+	client *redis.Client
+
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+func NewRevocationList(client *redis.Client) *RevocationList {
+	return &RevocationList{
+		client:  client,
+		revoked: make(map[string]time.Time),
+	}
+}
+
+// Revoke rejects jti until expiresAt, after which the token is invalid anyway.
+func (l *RevocationList) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if ttl <= 0 {
+		return nil
+	}
+
+	if l.client != nil {
+		return l.client.Set(ctx, revokedKeyPrefix+jti, 1, ttl).Err()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	for id, until := range l.revoked {
+		if !until.After(now) {
+			delete(l.revoked, id)
+		}
+	}
+	l.revoked[jti] = expiresAt
+	return nil
+}
+
+func (l *RevocationList) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	if l.client != nil {
+		n, err := l.client.Exists(ctx, revokedKeyPrefix+jti).Result()
+		return n > 0, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	until, ok := l.revoked[jti]
+	return ok && until.After(time.Now()), nil
+}
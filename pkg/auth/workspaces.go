@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+// Roles a user can hold in a workspace, from most to least privileged.
+const (
+	RoleOwner  = "owner"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+var (
+	ErrNotWorkspaceMember = errors.New("not a member of this workspace")
+	ErrInsufficientRole   = errors.New("your role in this workspace does not allow this")
+)
+
+// WorkspaceResolver returns the workspace a request acts on and the user's
+// role in it. A zero workspaceID selects the user's personal workspace;
+// workspaces the user does not belong to give ErrNotWorkspaceMember.
+type WorkspaceResolver interface {
+	ResolveWorkspace(ctx context.Context, userID, workspaceID uint) (uint, string, error)
+}
+
+func ValidRole(role string) bool {
+	return role == RoleOwner || role == RoleEditor || role == RoleViewer
+}
+
+// RoleAtLeast reports whether role grants everything minimum does.
+func RoleAtLeast(role, minimum string) bool {
+	return roleRank(role) >= roleRank(minimum)
+}
+
+func roleRank(role string) int {
+	switch role {
+	case RoleOwner:
+		return 3
+	case RoleEditor:
+		return 2
+	case RoleViewer:
+		return 1
+	}
+	return 0
+}
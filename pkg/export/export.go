@@ -0,0 +1,261 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	FormatCSV   = "csv"
+	FormatXLSX  = "xlsx"
+	FormatJSONL = "jsonl"
+)
+
+var ErrUnsupportedFormat = errors.New("format must be one of csv, xlsx or jsonl")
+
+// Number is a value written as a numeric cell (XLSX) or a bare JSON number
+// (JSONL). It must already be a valid decimal, e.g. Money.String().
+type Number string
+
+// JSON is a value embedded as-is in JSONL output and as text elsewhere.
+type JSON string
+
+// Writer streams a table. The first Write is the header; later records must
+// have the same length. Close flushes the output and must always be called.
+// Exports stream into a response whose status line is already sent, so a
+// failed Write or Close can only cut the file short; callers log it.
+type Writer interface {
+	Write(record []interface{}) error
+	Close() error
+}
+
+// Supported reports whether format is one NewWriter accepts.
+func Supported(format string) bool {
+	return format == FormatCSV || format == FormatXLSX || format == FormatJSONL
+}
+
+// NewWriter returns a Writer for format that writes to w.
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return &csvWriter{w: csv.NewWriter(w)}, nil
+	case FormatXLSX:
+		return newXLSXWriter(w)
+	case FormatJSONL:
+		return &jsonlWriter{w: bufio.NewWriter(w)}, nil
+	}
+	return nil, ErrUnsupportedFormat
+}
+
+// ContentType is the MIME type of format.
+func ContentType(format string) string {
+	switch format {
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case FormatJSONL:
+		return "application/x-ndjson"
+	}
+	return "text/csv"
+}
+
+func text(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case Number:
+		return string(v)
+	case JSON:
+		return string(v)
+	case fmt.Stringer:
+		return v.String()
+	}
+	return fmt.Sprint(value)
+}
+
+func numeric(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case Number:
+		return string(v), true
+	case int:
+		return strconv.Itoa(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case uint:
+		return strconv.FormatUint(uint64(v), 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	}
+	return "", false
+}
+
+// formulaPrefixes are the leading characters that make a spreadsheet treat a
+// CSV cell as a formula.
+const formulaPrefixes = "=+-@\t\r"
+
+// csvWriter prefixes text cells that a spreadsheet would read as a formula
+// with a quote, so a description like =HYPERLINK(...) stays text. Numeric
+// values are written as they are, negative ones included.
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) Write(record []interface{}) error {
+	fields := make([]string, len(record))
+	for i, value := range record {
+		fields[i] = text(value)
+		if _, ok := numeric(value); !ok && fields[i] != "" && strings.IndexByte(formulaPrefixes, fields[i][0]) >= 0 {
+			fields[i] = "'" + fields[i]
+		}
+	}
+	return c.w.Write(fields)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonlWriter struct {
+	w      *bufio.Writer
+	header []string
+}
+
+func (j *jsonlWriter) Write(record []interface{}) error {
+	if j.header == nil {
+		j.header = make([]string, len(record))
+		for i, value := range record {
+			j.header[i] = text(value)
+		}
+		return nil
+	}
+
+	// Keys are written in header order, which a map would not preserve.
+	j.w.WriteByte('{')
+	for i, value := range record {
+		if i > 0 {
+			j.w.WriteByte(',')
+		}
+		key, _ := json.Marshal(j.header[i])
+		j.w.Write(key)
+		j.w.WriteByte(':')
+
+		var encoded []byte
+		switch v := value.(type) {
+		case Number:
+			encoded = []byte(v)
+		case JSON:
+			encoded = []byte(v)
+		default:
+			var err error
+			if encoded, err = json.Marshal(value); err != nil {
+				return err
+			}
+		}
+		if _, err := j.w.Write(encoded); err != nil {
+			return err
+		}
+	}
+	j.w.WriteByte('}')
+	return j.w.WriteByte('\n')
+}
+
+func (j *jsonlWriter) Close() error {
+	return j.w.Flush()
+}
+
+// xlsxWriter writes a single-sheet workbook. The sheet is the last zip entry
+// so rows can be streamed into it; strings are stored inline to avoid having
+// to build a shared string table in memory.
+type xlsxWriter struct {
+	zip   *zip.Writer
+	sheet *bufio.Writer
+	rows  int
+}
+
+var xlsxParts = []struct{ name, body string }{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+func newXLSXWriter(w io.Writer) (*xlsxWriter, error) {
+	z := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		f, err := z.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.body); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := z.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	sheet := bufio.NewWriter(f)
+	sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	return &xlsxWriter{zip: z, sheet: sheet}, nil
+}
+
+func (x *xlsxWriter) Write(record []interface{}) error {
+	x.rows++
+	fmt.Fprintf(x.sheet, `<row r="%d">`, x.rows)
+	for i, value := range record {
+		ref := columnName(i) + strconv.Itoa(x.rows)
+		if n, ok := numeric(value); ok {
+			fmt.Fprintf(x.sheet, `<c r="%s"><v>%s</v></c>`, ref, n)
+			continue
+		}
+		fmt.Fprintf(x.sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, escapeXML(text(value)))
+	}
+	_, err := x.sheet.WriteString("</row>")
+	return err
+}
+
+func (x *xlsxWriter) Close() error {
+	x.sheet.WriteString("</sheetData></worksheet>")
+	if err := x.sheet.Flush(); err != nil {
+		return err
+	}
+	return x.zip.Close()
+}
+
+// columnName converts a 0-based index to A, B, ..., Z, AA, ...
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+var xmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+// escapeXML escapes markup and drops control characters XML cannot carry.
+func escapeXML(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		return r
+	}, s)
+	return xmlEscaper.Replace(s)
+}
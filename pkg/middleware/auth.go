@@ -1,14 +1,25 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
+	"fintrack/pkg/auth"
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
+// AuthMiddleware accepts access tokens signed by one of keys, identified by
+// the kid header, whose jti is not on revocations, and API keys known to
+// apiKeys, sent as a bearer token or in X-API-Key. A nil revocations skips
+// the check; a nil apiKeys rejects API keys.
+func AuthMiddleware(keys auth.KeySet, revocations *auth.RevocationList, apiKeys auth.APIKeyVerifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if apiKey := c.GetHeader("X-API-Key"); apiKey != "" {
+			authenticateAPIKey(c, apiKeys, apiKey)
+			return
+		}
+
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
@@ -22,10 +33,12 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 			c.Abort()
 			return
 		}
+		if auth.IsAPIKey(tokenString) {
+			authenticateAPIKey(c, apiKeys, tokenString)
+			return
+		}
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(jwtSecret), nil
-		})
+		token, err := jwt.Parse(tokenString, auth.Keyfunc(c.Request.Context(), keys), auth.ValidMethods)
 
 		if err != nil || !token.Valid {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
@@ -33,11 +46,99 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 			return
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			c.Set("user_id", uint(claims["user_id"].(float64)))
-			c.Set("email", claims["email"].(string))
+		claims, ok := token.Claims.(jwt.MapClaims)
+		userID, hasUser := claims["user_id"].(float64)
+		jti, hasJTI := claims["jti"].(string)
+		exp, _ := claims.GetExpirationTime()
+		if !ok || !hasUser || !hasJTI || exp == nil || claims["typ"] != "access" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Abort()
+			return
+		}
+
+		if revocations != nil {
+			revoked, err := revocations.IsRevoked(c.Request.Context(), jti)
+			if err != nil {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Unable to verify token"})
+				c.Abort()
+				return
+			}
+			if revoked {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+				c.Abort()
+				return
+			}
+		}
+
+		email, _ := claims["email"].(string)
+		var roles []string
+		if list, ok := claims["roles"].([]interface{}); ok {
+			for _, role := range list {
+				if role, ok := role.(string); ok {
+					roles = append(roles, role)
+				}
+			}
+		}
+		c.Set("user_id", uint(userID))
+		c.Set("email", email)
+		c.Set("roles", roles)
+		c.Set("jti", jti)
+		c.Set("token_expires_at", exp.Time)
+
+		c.Next()
+	}
+}
+
+func authenticateAPIKey(c *gin.Context, apiKeys auth.APIKeyVerifier, key string) {
+	if apiKeys == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "API keys are not accepted here"})
+		c.Abort()
+		return
+	}
+
+	principal, err := apiKeys.VerifyAPIKey(c.Request.Context(), key)
+	if errors.Is(err, auth.ErrInvalidAPIKey) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		c.Abort()
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Unable to verify API key"})
+		c.Abort()
+		return
+	}
+
+	c.Set("user_id", principal.UserID)
+	c.Set("api_key_id", principal.KeyID)
+	c.Set("scopes", principal.Scopes)
+
+	c.Next()
+}
+
+// RequireScopes limits API keys on a route group to read for GET, HEAD and
+// OPTIONS requests and write for everything else. Login sessions carry no
+// scopes and pass.
+func RequireScopes(read, write string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, scoped := c.Get("scopes")
+		if !scoped {
+			c.Next()
+			return
+		}
+
+		required := write
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			required = read
+		}
+
+		scopes, _ := value.([]string)
+		if !auth.HasScope(scopes, required) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API key lacks the " + required + " scope"})
+			c.Abort()
+			return
 		}
 
 		c.Next()
 	}
-}
\ No newline at end of file
+}
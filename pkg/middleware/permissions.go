@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+	"fintrack/pkg/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission lets a request through only when the roles carried in its
+// access token grant permission. It must run after AuthMiddleware. API keys
+// carry no roles and are always refused.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, apiKey := c.Get("api_key_id"); apiKey {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot be used for this route"})
+			c.Abort()
+			return
+		}
+
+		if !auth.HasPermission(c.GetStringSlice("roles"), permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Missing the " + permission + " permission"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
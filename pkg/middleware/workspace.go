@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"fintrack/pkg/auth"
+	"github.com/gin-gonic/gin"
+)
+
+// WorkspaceHeader selects the workspace a request acts on; without it the
+// caller's personal workspace is used.
+const WorkspaceHeader = "X-Workspace-ID"
+
+// WorkspaceMiddleware resolves the workspace for the authenticated user and
+// sets workspace_id and workspace_role. It must run after AuthMiddleware.
+func WorkspaceMiddleware(workspaces auth.WorkspaceResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var requested uint
+		if header := c.GetHeader(WorkspaceHeader); header != "" {
+			id, err := strconv.ParseUint(header, 10, 32)
+			if err != nil || id == 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid workspace ID"})
+				c.Abort()
+				return
+			}
+			requested = uint(id)
+		}
+
+		workspaceID, role, err := workspaces.ResolveWorkspace(c.Request.Context(), c.GetUint("user_id"), requested)
+		if errors.Is(err, auth.ErrNotWorkspaceMember) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Unable to resolve workspace"})
+			c.Abort()
+			return
+		}
+
+		c.Set("workspace_id", workspaceID)
+		c.Set("workspace_role", role)
+
+		c.Next()
+	}
+}
+
+// RequireWorkspaceWrite lets viewers through only for GET, HEAD and OPTIONS
+// requests; editors and owners may do anything.
+func RequireWorkspaceWrite() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+
+		if !auth.RoleAtLeast(c.GetString("workspace_role"), auth.RoleEditor) {
+			c.JSON(http.StatusForbidden, gin.H{"error": auth.ErrInsufficientRole.Error()})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
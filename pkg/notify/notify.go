@@ -0,0 +1,38 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+	"github.com/redis/go-redis/v9"
+)
+
+// Channel is the Redis pub/sub channel every service publishes user events to.
+const Channel = "notifications"
+
+type Notification struct {
+	UserID uint        `json:"user_id"`
+	Event  string      `json:"event"`
+	Data   interface{} `json:"data"`
+	Time   time.Time   `json:"time"`
+}
+
+// Publish sends event for userID on Channel. A nil client drops the event,
+// which keeps services usable without Redis in tests.
+func Publish(ctx context.Context, client *redis.Client, userID uint, event string, data interface{}) error {
+	if client == nil {
+		return nil
+	}
+
+	payload, err := json.Marshal(Notification{
+		UserID: userID,
+		Event:  event,
+		Data:   data,
+		Time:   time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return client.Publish(ctx, Channel, payload).Err()
+}
@@ -157,8 +157,14 @@ func formatExpenseData(expenses []ExpenseData) string {
 	categoryTotals := make(map[string]float64)
 	monthlyTotals := make(map[string]float64)
 	
+	// "Food", "food" and "Food " are one category; keep the first spelling seen.
+	categoryNames := make(map[string]string)
 	for _, expense := range expenses {
-		categoryTotals[expense.Category] += expense.Amount
+		key := strings.ToLower(strings.Join(strings.Fields(expense.Category), " "))
+		if _, ok := categoryNames[key]; !ok {
+			categoryNames[key] = strings.TrimSpace(expense.Category)
+		}
+		categoryTotals[categoryNames[key]] += expense.Amount
 		
 		// Extract month from date
 		if len(expense.Date) >= 7 {
@@ -52,13 +52,6 @@ func main() {
 		c.JSON(http.StatusOK, gin.H{"status": "healthy", "service": "user-service"})
 	})
 
-	// Debug endpoint to view all users
-	r.GET("/debug/users", func(c *gin.Context) {
-		usersMutex.RLock()
-		c.JSON(http.StatusOK, gin.H{"users": users, "count": len(users)})
-		usersMutex.RUnlock()
-	})
-
 	api := r.Group("/api/v1/users")
 	
 	api.POST("/register", func(c *gin.Context) {
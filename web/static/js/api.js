@@ -23,7 +23,31 @@ function getAuthHeaders() {
     };
 }
 
-async function apiRequest(url, options = {}) {
+// Exchange the stored refresh token for a new access token. Refresh tokens
+// are single use, so the rotated one replaces it.
+async function refreshAccessToken() {
+    const refreshToken = localStorage.getItem('refresh_token');
+    if (!refreshToken) {
+        return false;
+    }
+
+    const response = await fetch(`${API_BASE_URL.USER}/users/refresh`, {
+        method: 'POST',
+        headers: {'Content-Type': 'application/json'},
+        body: JSON.stringify({refresh_token: refreshToken})
+    });
+    if (!response.ok) {
+        localStorage.removeItem('refresh_token');
+        return false;
+    }
+
+    const data = await response.json();
+    localStorage.setItem('token', data.token);
+    localStorage.setItem('refresh_token', data.refresh_token);
+    return true;
+}
+
+async function apiRequest(url, options = {}, retried = false) {
     const config = {
         headers: getAuthHeaders(),
         ...options
@@ -32,9 +56,14 @@ async function apiRequest(url, options = {}) {
     try {
         const response = await fetch(url, config);
         
+        if (response.status === 401 && !retried && await refreshAccessToken()) {
+            return apiRequest(url, options, true);
+        }
+
         if (response.status === 401) {
             // Token expired or invalid
             localStorage.removeItem('token');
+            localStorage.removeItem('refresh_token');
             localStorage.removeItem('user');
             window.location.href = '/login';
             return null;